@@ -2,6 +2,7 @@ package processing
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
@@ -23,7 +24,6 @@ func ResolveVar(node *ast.Var, documentstack *nodestack.NodeStack) (ast.Node, er
 
 func CompileNodeFromStack(node ast.Node, documentstack *nodestack.NodeStack, vm *jsonnet.VM) (ast.Node, error) {
 	tree := nodetree.BuildTree(nil, node)
-	logrus.Errorf("TREE: %s", tree)
 
 	compileNode := node
 
@@ -66,12 +66,10 @@ func CompileNodeFromStack(node ast.Node, documentstack *nodestack.NodeStack, vm
 		}
 	}
 
-	logrus.Errorf("Evaluating node %T", compileNode)
 	evalResult, err := vm.Evaluate(compileNode)
 	if err != nil {
 		return nil, fmt.Errorf("could not evaluate node: %w", err)
 	}
-	logrus.Errorf("######### Result: %s\n", evalResult)
 
 	newNode, err := jsonnet.SnippetToAST("", evalResult)
 	if err != nil {
@@ -92,3 +90,86 @@ func (p *Processor) CompileNode(root ast.Node, node ast.Node) (ast.Node, error)
 func (p *Processor) CompileString(data string) (ast.Node, error) {
 	return jsonnet.SnippetToAST("", data)
 }
+
+// evalField is the hidden field of the objects built by NodeInScope
+const evalField = "__evalItem"
+
+// NodeInScope returns the expression at the location and the same expression bound to its enclosing locals, so it can be
+// evaluated on its own. Inside of objects, the expression is evaluated as a hidden field of a copy of the object to bind `self`,
+// `$` and the object locals. Parameters without a default value can't be determined and raise an error when they are used
+func NodeInScope(root ast.Node, location ast.Location) (ast.Node, ast.Node, error) {
+	stack, err := FindNodeByPosition(root, location)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stack.IsEmpty() {
+		return nil, nil, fmt.Errorf("no node found at %s", location.String())
+	}
+	node := stack.Peek()
+	path := NodePath(root, node)
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("no node found at %s", location.String())
+	}
+
+	if object, ok := node.(*ast.DesugaredObject); ok {
+		// Field names don't have a location. The name of a field evaluates the field
+		for _, field := range object.Fields {
+			if InRange(location, field.LocRange) {
+				node = field.Body
+				path = append(path, node)
+				break
+			}
+		}
+	}
+	path = path[:len(path)-1]
+	if len(path) > 0 {
+		// The field name of `a.b` evaluates `a.b`
+		if index, ok := path[len(path)-1].(*ast.Index); ok && index.Index == node {
+			node = index
+			path = path[:len(path)-1]
+		}
+	}
+
+	expression, child := node, node
+	for i := len(path) - 1; i >= 0; i-- {
+		switch parent := path[i].(type) {
+		case *ast.Local:
+			clone := *parent
+			clone.Body = expression
+			expression = &clone
+		case *ast.Function:
+			binds := ast.LocalBinds{}
+			for _, param := range parent.Parameters {
+				body := param.DefaultArg
+				if body == nil {
+					body = &ast.Error{Expr: &ast.LiteralString{Value: fmt.Sprintf("Unknown value of parameter %s", param.Name)}}
+				}
+				binds = append(binds, ast.LocalBind{Variable: param.Name, Body: body})
+			}
+			if len(binds) > 0 {
+				expression = &ast.Local{Binds: binds, Body: expression}
+			}
+		case *ast.DesugaredObject:
+			if slices.ContainsFunc(parent.Fields, func(field ast.DesugaredObjectField) bool { return field.Name == child }) {
+				// Field names are evaluated outside of the object
+				break
+			}
+			clone := *parent
+			clone.Fields = append(slices.Clone(parent.Fields), ast.DesugaredObjectField{
+				Name: &ast.LiteralString{Value: evalField},
+				Body: expression,
+				Hide: ast.ObjectFieldHidden,
+			})
+			var target ast.Node = &clone
+			// `self` of `base + { ... }` includes the fields of base
+			if i > 0 {
+				if binary, ok := path[i-1].(*ast.Binary); ok && binary.Op == ast.BopPlus && binary.Right == parent {
+					target = &ast.Binary{Left: binary.Left, Op: ast.BopPlus, Right: &clone}
+				}
+			}
+			expression = &ast.Index{Target: target, Index: &ast.LiteralString{Value: evalField}}
+		}
+		child = path[i]
+	}
+	return node, expression, nil
+}
@@ -1,6 +1,7 @@
 package processing
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-jsonnet"
@@ -120,3 +121,87 @@ func TestCompile(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeInScope(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		location ast.Location
+		expected string
+		// The error is expected to contain this message
+		expectedError string
+	}{
+		{
+			name:     "enclosing locals",
+			content:  "local a = 1;\nlocal f(x) = local b = a + 1; b * 2;\nf(3)",
+			location: ast.Location{Line: 2, Column: 33},
+			expected: "4",
+		},
+		{
+			name:     "field name of an index",
+			content:  "local a = { b: { c: 1 } };\na.b.c",
+			location: ast.Location{Line: 2, Column: 3},
+			expected: "{\n   \"c\": 1\n}",
+		},
+		{
+			name:     "self and dollar",
+			content:  "{\n  a: 1,\n  b: { c: self.d + $.a, d: 2 },\n}",
+			location: ast.Location{Line: 3, Column: 18},
+			expected: "3",
+		},
+		{
+			name:     "object locals",
+			content:  "{\n  local x = self.a * 2,\n  a: 2,\n  b: x,\n}",
+			location: ast.Location{Line: 4, Column: 6},
+			expected: "4",
+		},
+		{
+			name:     "field name evaluates the field",
+			content:  "{\n  a: 2,\n  b: self.a + 1,\n}",
+			location: ast.Location{Line: 3, Column: 3},
+			expected: "3",
+		},
+		{
+			name:     "self includes the left side of +",
+			content:  "{ a: 1 } + { b: self.a }",
+			location: ast.Location{Line: 1, Column: 22},
+			expected: "1",
+		},
+		{
+			name:     "parameter defaults",
+			content:  "local f(x, y=2) = y * 3;\nf(1)",
+			location: ast.Location{Line: 1, Column: 21},
+			expected: "6",
+		},
+		{
+			name:          "parameter without default",
+			content:       "local f(x, y=2) = x * y;\nf(1)",
+			location:      ast.Location{Line: 1, Column: 20},
+			expectedError: "Unknown value of parameter x",
+		},
+		{
+			name:          "comprehension variable",
+			content:       "[x * 2 for x in [1, 2]]",
+			location:      ast.Location{Line: 1, Column: 2},
+			expectedError: "Unknown value of parameter x",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := jsonnet.SnippetToAST("test.jsonnet", tc.content)
+			require.NoError(t, err)
+
+			_, expression, err := NodeInScope(root, tc.location)
+			require.NoError(t, err)
+
+			result, err := jsonnet.MakeVM().Evaluate(expression)
+			if tc.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, strings.TrimSuffix(result, "\n"))
+		})
+	}
+}
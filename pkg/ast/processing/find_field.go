@@ -80,7 +80,7 @@ func (p *Processor) FindRangesFromIndexList(stack *nodestack.NodeStack, indexLis
 			foundDesugaredObjects = p.FindTopLevelObjects(tmpStack)
 		case *ast.Import:
 			filename := bodyNode.File.Value
-			foundDesugaredObjects = p.FindTopLevelObjectsInFile(filename, "")
+			foundDesugaredObjects = p.FindTopLevelObjectsInFile(filename, string(bodyNode.Loc().File.DiagnosticFileName))
 		case *ast.Index:
 			tempStack := nodestack.NewNodeStack(bodyNode)
 			indexList = append(tempStack.BuildIndexList(), indexList...)
@@ -0,0 +1,60 @@
+package processing
+
+import (
+	"path/filepath"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	log "github.com/sirupsen/logrus"
+)
+
+// FindImports returns all import, importstr and importbin nodes of the AST
+func FindImports(root ast.Node) []ast.Node {
+	if root == nil {
+		return nil
+	}
+	var imports []ast.Node
+	for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+		switch node.(type) {
+		case *ast.Import, *ast.ImportStr, *ast.ImportBin:
+			imports = append(imports, node)
+		}
+	}
+	return imports
+}
+
+// ImportPath returns the path of an import, importstr or importbin node
+func ImportPath(node ast.Node) (string, bool) {
+	switch node := node.(type) {
+	case *ast.Import:
+		return node.File.Value, true
+	case *ast.ImportStr:
+		return node.File.Value, true
+	case *ast.ImportBin:
+		return node.File.Value, true
+	}
+	return "", false
+}
+
+// ResolveImports returns the absolute paths of all files imported by the AST of filename.
+// Imports that can't be resolved are skipped
+func (p *Processor) ResolveImports(filename string, root ast.Node) []string {
+	var resolved []string
+	seen := map[string]bool{}
+	for _, node := range FindImports(root) {
+		path, _ := ImportPath(node)
+		foundAt, err := p.vm.ResolveImport(filename, path)
+		if err != nil {
+			log.Debugf("Unable to resolve import %s of %s: %v", path, filename, err)
+			continue
+		}
+		if abs, err := filepath.Abs(foundAt); err == nil {
+			foundAt = abs
+		}
+		if !seen[foundAt] {
+			seen[foundAt] = true
+			resolved = append(resolved, foundAt)
+		}
+	}
+	return resolved
+}
@@ -35,3 +35,13 @@ func RangeGreaterOrEqual(a ast.LocationRange, b ast.LocationRange) bool {
 
 	return true
 }
+
+// RangesOverlap checks if the ranges share at least one location
+func RangesOverlap(a ast.LocationRange, b ast.LocationRange) bool {
+	return !locationBefore(a.End, b.Begin) && !locationBefore(b.End, a.Begin)
+}
+
+// locationBefore checks if a is strictly before b
+func locationBefore(a, b ast.Location) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,125 @@
+package processing
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+)
+
+// NodePath returns all nodes from root to target. Unlike FindNodeByPosition it includes nodes without a location,
+// e.g. the functions generated for comprehensions
+func NodePath(root, target ast.Node) []ast.Node {
+	if root == target {
+		return []ast.Node{root}
+	}
+	if root == nil {
+		return nil
+	}
+	for _, child := range toolutils.Children(root) {
+		if path := NodePath(child, target); path != nil {
+			return append([]ast.Node{root}, path...)
+		}
+	}
+	return nil
+}
+
+// Binds checks if the node declares the identifier for its children. Locals and object locals bind their variables,
+// functions their parameters
+func Binds(node ast.Node, id ast.Identifier) bool {
+	switch node := node.(type) {
+	case *ast.Local:
+		return slices.ContainsFunc(node.Binds, func(bind ast.LocalBind) bool { return bind.Variable == id })
+	case *ast.Function:
+		return slices.ContainsFunc(node.Parameters, func(param ast.Parameter) bool { return param.Name == id })
+	case *ast.DesugaredObject:
+		return slices.ContainsFunc(node.Locals, func(bind ast.LocalBind) bool { return bind.Variable == id })
+	}
+	return false
+}
+
+// FindBinder returns the innermost node binding the variable or nil if it is free in root, e.g. std
+func FindBinder(root ast.Node, variable *ast.Var) ast.Node {
+	path := NodePath(root, variable)
+	for i := len(path) - 2; i >= 0; i-- {
+		if Binds(path[i], variable.Id) {
+			return path[i]
+		}
+	}
+	return nil
+}
+
+// FindBinders returns the binder of every variable in root like FindBinder, but in a single pass. Free variables map to nil
+func FindBinders(root ast.Node) map[*ast.Var]ast.Node {
+	return findBinders(root, nil)
+}
+
+// FindBindersInRange is FindBinders for the variables overlapping the range. Nodes outside of it are not visited
+func FindBindersInRange(root ast.Node, rng ast.LocationRange) map[*ast.Var]ast.Node {
+	return findBinders(root, &rng)
+}
+
+func findBinders(root ast.Node, rng *ast.LocationRange) map[*ast.Var]ast.Node {
+	binders := map[*ast.Var]ast.Node{}
+	var visit func(node ast.Node, scope map[ast.Identifier]ast.Node)
+	visit = func(node ast.Node, scope map[ast.Identifier]ast.Node) {
+		// The scope only depends on the ancestors. Nodes without a location, e.g. desugared ones, are always visited
+		if rng != nil && node.Loc() != nil && node.Loc().Begin.IsSet() && !RangesOverlap(*node.Loc(), *rng) {
+			return
+		}
+		if variable, ok := node.(*ast.Var); ok {
+			binders[variable] = scope[variable.Id]
+		}
+		if ids := boundIdentifiers(node); len(ids) > 0 {
+			scope = maps.Clone(scope)
+			for _, id := range ids {
+				scope[id] = node
+			}
+		}
+		for _, child := range toolutils.Children(node) {
+			visit(child, scope)
+		}
+	}
+	visit(root, map[ast.Identifier]ast.Node{})
+	return binders
+}
+
+// boundIdentifiers returns the identifiers the node declares for its children, see Binds
+func boundIdentifiers(node ast.Node) []ast.Identifier {
+	var ids []ast.Identifier
+	switch node := node.(type) {
+	case *ast.Local:
+		for _, bind := range node.Binds {
+			ids = append(ids, bind.Variable)
+		}
+	case *ast.Function:
+		for _, param := range node.Parameters {
+			ids = append(ids, param.Name)
+		}
+	case *ast.DesugaredObject:
+		for _, bind := range node.Locals {
+			ids = append(ids, bind.Variable)
+		}
+	}
+	return ids
+}
+
+// FindScopeReferences returns the variables referring to the identifier bound by binder.
+// Variables of the same name that are bound again in between refer to something else and are skipped
+func FindScopeReferences(binder ast.Node, id ast.Identifier) []*ast.Var {
+	var references []*ast.Var
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		if variable, ok := node.(*ast.Var); ok && variable.Id == id && variable.LocRange.Begin.IsSet() {
+			references = append(references, variable)
+		}
+		for _, child := range toolutils.Children(node) {
+			if !Binds(child, id) {
+				visit(child)
+			}
+		}
+	}
+	visit(binder)
+	return references
+}
@@ -0,0 +1,70 @@
+package processing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindScopeReferences(t *testing.T) {
+	root, err := jsonnet.SnippetToAST("test.jsonnet", "local a = 1;\n[a, function(a) a, [a for a in [a]], { local a = 2, b: a }]")
+	require.NoError(t, err)
+
+	var variables []*ast.Var
+	for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+		if variable, ok := node.(*ast.Var); ok && variable.Id == "a" {
+			variables = append(variables, variable)
+		}
+	}
+
+	var outer []ast.Location
+	for _, variable := range FindScopeReferences(root, "a") {
+		outer = append(outer, variable.LocRange.Begin)
+		// All references are bound by the outer local
+		assert.Equal(t, root, FindBinder(root, variable))
+	}
+	assert.Equal(t, []ast.Location{{Line: 2, Column: 2}, {Line: 2, Column: 33}}, outer)
+
+	for _, variable := range variables {
+		binder := FindBinder(root, variable)
+		require.NotNil(t, binder)
+		assert.Contains(t, FindScopeReferences(binder, "a"), variable)
+	}
+}
+
+func TestFindBinders(t *testing.T) {
+	root, err := jsonnet.SnippetToAST("test.jsonnet", "local a = 1, f(x) = x + a;\n{ local b = a, c: [b for b in [f(b)]], d: std.length([]), e(a):: a + self.c }")
+	require.NoError(t, err)
+
+	binders := FindBinders(root)
+	count := 0
+	for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+		if variable, ok := node.(*ast.Var); ok {
+			count++
+			assert.Equal(t, FindBinder(root, variable), binders[variable], "binder of %s at %v", variable.Id, variable.LocRange)
+		}
+	}
+	assert.Len(t, binders, count)
+}
+
+func TestFindBindersInRange(t *testing.T) {
+	root, err := jsonnet.SnippetToAST("test.jsonnet", "local a = 1, f(x) = x + a;\n{ local b = a, c: [b for b in [f(b)]], d: std.length([]), e(a):: a + self.c }")
+	require.NoError(t, err)
+
+	rng := ast.LocationRange{Begin: ast.Location{Line: 2, Column: 16}, End: ast.Location{Line: 2, Column: 40}}
+	binders := FindBindersInRange(root, rng)
+	var found []string
+	for variable, binder := range binders {
+		if !variable.LocRange.Begin.IsSet() {
+			continue
+		}
+		found = append(found, fmt.Sprintf("%s %d", variable.Id, variable.LocRange.Begin.Column))
+		assert.Equal(t, FindBinder(root, variable), binder, "binder of %s at %v", variable.Id, variable.LocRange)
+	}
+	assert.ElementsMatch(t, []string{"b 20", "f 32", "b 34"}, found)
+}
@@ -1,6 +1,7 @@
 package processing
 
 import (
+	"path/filepath"
 	"reflect"
 
 	"github.com/google/go-jsonnet/ast"
@@ -11,13 +12,30 @@ import (
 func (p *Processor) FindTopLevelObjectsInFile(filename, importedFrom string) []*ast.DesugaredObject {
 	v, ok := p.cache.GetTopLevelObject(filename, importedFrom)
 	if !ok {
-		rootNode, _, _ := p.vm.ImportAST(importedFrom, filename)
+		rootNode, foundAt, _ := p.vm.ImportAST(importedFrom, filename)
+		foundAt = p.recordImports(foundAt, rootNode)
 		v = p.FindTopLevelObjects(nodestack.NewNodeStack(rootNode))
-		p.cache.PutTopLevelObject(filename, importedFrom, v)
+		p.cache.PutTopLevelObject(filename, importedFrom, foundAt, v)
 	}
 	return v
 }
 
+// recordImports adds the imports of a file to the import graph of the cache.
+// The top level objects depend on the imported files, so the graph is needed to invalidate them once one of those changes.
+// Files are only resolved again once they changed. Returns the absolute path of the file
+func (p *Processor) recordImports(foundAt string, rootNode ast.Node) string {
+	if foundAt == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(foundAt); err == nil {
+		foundAt = abs
+	}
+	if !p.cache.HasImports(foundAt) {
+		p.cache.SetImports(foundAt, p.ResolveImports(foundAt, rootNode))
+	}
+	return foundAt
+}
+
 // Find all ast.DesugaredObject's from NodeStack
 func (p *Processor) FindTopLevelObjects(stack *nodestack.NodeStack) []*ast.DesugaredObject {
 	visitedLocations := map[*ast.LocationRange]bool{}
@@ -42,7 +60,8 @@ func (p *Processor) FindTopLevelObjects(stack *nodestack.NodeStack) []*ast.Desug
 			stack.Push(curr.Body)
 		case *ast.Import:
 			filename := curr.File.Value
-			rootNode, _, _ := p.vm.ImportAST(string(curr.Loc().File.DiagnosticFileName), filename)
+			rootNode, foundAt, _ := p.vm.ImportAST(string(curr.Loc().File.DiagnosticFileName), filename)
+			p.recordImports(foundAt, rootNode)
 			stack.Push(rootNode)
 		case *ast.Index:
 			indexValue, indexIsString := curr.Index.(*ast.LiteralString)
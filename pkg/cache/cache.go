@@ -3,11 +3,14 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 )
 
@@ -25,19 +28,57 @@ type Document struct {
 	Diagnostics []protocol.Diagnostic
 }
 
+// ApplyChanges applies the content changes of a DidChange notification to the document text in order.
+// A change without a range replaces the whole document.
+func (d *Document) ApplyChanges(changes []protocol.TextDocumentContentChangeEvent) error {
+	text := d.Item.Text
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		start, err := position.ProtocolToOffset(text, change.Range.Start)
+		if err != nil {
+			return fmt.Errorf("invalid change start: %w", err)
+		}
+		end, err := position.ProtocolToOffset(text, change.Range.End)
+		if err != nil {
+			return fmt.Errorf("invalid change end: %w", err)
+		}
+		if end < start {
+			return fmt.Errorf("change range end %v is before start %v", change.Range.End, change.Range.Start)
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	d.Item.Text = text
+	return nil
+}
+
 // Cache caches documents.
 type Cache struct {
 	mu              sync.RWMutex
 	docs            map[protocol.DocumentURI]*Document
 	topLevelObjects map[string][]*ast.DesugaredObject
+	// Resolved filename -> keys of topLevelObjects containing objects of that file
+	topLevelObjectKeys map[string]map[string]struct{}
+
+	// Import graph of resolved filenames. importers is the reverse of imports
+	imports   map[string]map[string]struct{}
+	importers map[string]map[string]struct{}
+	// Files whose imports are recorded, including the ones without imports
+	recordedImports map[string]struct{}
 }
 
 // New returns a document cache.
 func New() *Cache {
 	return &Cache{
-		mu:              sync.RWMutex{},
-		docs:            make(map[protocol.DocumentURI]*Document),
-		topLevelObjects: make(map[string][]*ast.DesugaredObject),
+		mu:                 sync.RWMutex{},
+		docs:               make(map[protocol.DocumentURI]*Document),
+		topLevelObjects:    make(map[string][]*ast.DesugaredObject),
+		topLevelObjectKeys: make(map[string]map[string]struct{}),
+		imports:            make(map[string]map[string]struct{}),
+		importers:          make(map[string]map[string]struct{}),
+		recordedImports:    make(map[string]struct{}),
 	}
 }
 
@@ -46,7 +87,8 @@ func (c *Cache) Remove(uri protocol.DocumentURI) {
 	defer c.mu.Unlock()
 
 	delete(c.docs, uri)
-	c.topLevelObjects = make(map[string][]*ast.DesugaredObject)
+	// The file on disk might differ from the closed document
+	c.invalidate(uri.SpanURI().Filename())
 }
 
 // Put adds or replaces a document in the cache.
@@ -62,14 +104,120 @@ func (c *Cache) Put(doc *Document) error {
 	}
 	c.docs[uri] = doc
 
-	// Invalidate the TopLevelObject cache
-	// We can't easily invalidate the cache for a single file (hard to figure out where the import actually leads),
-	// so we just clear the whole thing
-	c.topLevelObjects = make(map[string][]*ast.DesugaredObject)
+	c.invalidate(uri.SpanURI().Filename())
 
 	return nil
 }
 
+// Invalidate removes all cached data derived from the file and from all files importing it directly or indirectly.
+func (c *Cache) Invalidate(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(filename)
+	// The imports of the file may have changed
+	delete(c.recordedImports, filename)
+}
+
+// InvalidateAll removes all cached data derived from files, e.g. because imports resolve differently
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.topLevelObjects = make(map[string][]*ast.DesugaredObject)
+	c.topLevelObjectKeys = make(map[string]map[string]struct{})
+	c.recordedImports = make(map[string]struct{})
+}
+
+func (c *Cache) invalidate(filename string) {
+	for _, file := range append(c.transitiveImporters(filename), filename) {
+		for key := range c.topLevelObjectKeys[file] {
+			delete(c.topLevelObjects, key)
+		}
+		delete(c.topLevelObjectKeys, file)
+	}
+}
+
+// SetImports replaces the files imported by filename. All paths are resolved filenames.
+func (c *Cache) SetImports(filename string, imports []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for imported := range c.imports[filename] {
+		delete(c.importers[imported], filename)
+		if len(c.importers[imported]) == 0 {
+			delete(c.importers, imported)
+		}
+	}
+	delete(c.imports, filename)
+	c.recordedImports[filename] = struct{}{}
+
+	for _, imported := range imports {
+		if c.imports[filename] == nil {
+			c.imports[filename] = make(map[string]struct{})
+		}
+		c.imports[filename][imported] = struct{}{}
+		if c.importers[imported] == nil {
+			c.importers[imported] = make(map[string]struct{})
+		}
+		c.importers[imported][filename] = struct{}{}
+	}
+}
+
+// HasImports checks if the imports of filename are recorded and the file didn't change since.
+func (c *Cache) HasImports(filename string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.recordedImports[filename]
+	return ok
+}
+
+// GetImports returns the files directly imported by filename.
+func (c *Cache) GetImports(filename string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(c.imports[filename]))
+}
+
+// GetImporters returns the files directly importing filename.
+func (c *Cache) GetImporters(filename string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(c.importers[filename]))
+}
+
+// GetTransitiveImporters returns all files importing filename either directly or through other files.
+func (c *Cache) GetTransitiveImporters(filename string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	importers := c.transitiveImporters(filename)
+	slices.Sort(importers)
+	return importers
+}
+
+func (c *Cache) transitiveImporters(filename string) []string {
+	visited := map[string]struct{}{filename: {}}
+	var importers []string
+	queue := []string{filename}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for importer := range c.importers[current] {
+			if _, ok := visited[importer]; ok {
+				continue
+			}
+			visited[importer] = struct{}{}
+			importers = append(importers, importer)
+			queue = append(queue, importer)
+		}
+	}
+	return importers
+}
+
 // Get retrieves a document from the cache.
 func (c *Cache) Get(uri protocol.DocumentURI) (*Document, error) {
 	c.mu.RLock()
@@ -83,6 +231,14 @@ func (c *Cache) Get(uri protocol.DocumentURI) (*Document, error) {
 	return doc, nil
 }
 
+// URIs returns the URIs of all cached documents.
+func (c *Cache) URIs() []protocol.DocumentURI {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Collect(maps.Keys(c.docs))
+}
+
 func (c *Cache) GetContents(uri protocol.DocumentURI, position protocol.Range) (string, error) {
 	text := ""
 	doc, err := c.Get(uri)
@@ -142,10 +298,21 @@ func (c *Cache) GetTopLevelObject(filename, importedFrom string) ([]*ast.Desugar
 	return v, ok
 }
 
-func (c *Cache) PutTopLevelObject(filename, importedFrom string, objects []*ast.DesugaredObject) {
+// PutTopLevelObject caches the top level objects of an import. foundAt is the resolved filename of the import
+// and is used to invalidate the entry once the file or one of its imports changes.
+// Unresolved imports are not cached, since any new file along the search paths can resolve them.
+func (c *Cache) PutTopLevelObject(filename, importedFrom, foundAt string, objects []*ast.DesugaredObject) {
+	if foundAt == "" {
+		return
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	cacheKey := importedFrom + ":" + filename
 	c.topLevelObjects[cacheKey] = objects
+	if c.topLevelObjectKeys[foundAt] == nil {
+		c.topLevelObjectKeys[foundAt] = make(map[string]struct{})
+	}
+	c.topLevelObjectKeys[foundAt][cacheKey] = struct{}{}
 }
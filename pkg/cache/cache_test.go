@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportGraph(t *testing.T) {
+	c := New()
+	c.SetImports("/main.jsonnet", []string{"/lib.libsonnet", "/other.libsonnet"})
+	c.SetImports("/lib.libsonnet", []string{"/base.libsonnet"})
+	c.SetImports("/unrelated.jsonnet", []string{"/other.libsonnet"})
+
+	assert.Equal(t, []string{"/lib.libsonnet", "/other.libsonnet"}, c.GetImports("/main.jsonnet"))
+	assert.Equal(t, []string{"/lib.libsonnet"}, c.GetImporters("/base.libsonnet"))
+	assert.Equal(t, []string{"/lib.libsonnet", "/main.jsonnet"}, c.GetTransitiveImporters("/base.libsonnet"))
+	assert.Equal(t, []string{"/main.jsonnet", "/unrelated.jsonnet"}, c.GetImporters("/other.libsonnet"))
+
+	// Replacing the imports removes the old edges
+	c.SetImports("/main.jsonnet", []string{"/other.libsonnet"})
+	assert.Empty(t, c.GetImporters("/lib.libsonnet"))
+	assert.Equal(t, []string{"/lib.libsonnet"}, c.GetTransitiveImporters("/base.libsonnet"))
+}
+
+func TestHasImports(t *testing.T) {
+	c := New()
+	assert.False(t, c.HasImports("/main.jsonnet"))
+
+	// Files without imports are recorded as well
+	c.SetImports("/main.jsonnet", nil)
+	assert.True(t, c.HasImports("/main.jsonnet"))
+
+	c.Invalidate("/main.jsonnet")
+	assert.False(t, c.HasImports("/main.jsonnet"))
+
+	c.SetImports("/main.jsonnet", []string{"/lib.libsonnet"})
+	c.InvalidateAll()
+	assert.False(t, c.HasImports("/main.jsonnet"))
+}
+
+func TestImportGraphCycle(t *testing.T) {
+	c := New()
+	c.SetImports("/a.libsonnet", []string{"/b.libsonnet"})
+	c.SetImports("/b.libsonnet", []string{"/a.libsonnet"})
+
+	assert.Equal(t, []string{"/b.libsonnet"}, c.GetTransitiveImporters("/a.libsonnet"))
+}
+
+func TestInvalidate(t *testing.T) {
+	c := New()
+	c.SetImports("/main.jsonnet", []string{"/lib.libsonnet"})
+	c.SetImports("/lib.libsonnet", []string{"/base.libsonnet"})
+	c.SetImports("/unrelated.jsonnet", []string{"/other.libsonnet"})
+
+	objects := []*ast.DesugaredObject{{}}
+	c.PutTopLevelObject("main.jsonnet", "", "/main.jsonnet", objects)
+	c.PutTopLevelObject("lib.libsonnet", "/main.jsonnet", "/lib.libsonnet", objects)
+	c.PutTopLevelObject("base.libsonnet", "/lib.libsonnet", "/base.libsonnet", objects)
+	c.PutTopLevelObject("unrelated.jsonnet", "", "/unrelated.jsonnet", objects)
+	c.PutTopLevelObject("other.libsonnet", "/unrelated.jsonnet", "/other.libsonnet", objects)
+	c.PutTopLevelObject("missing.libsonnet", "/main.jsonnet", "", objects)
+
+	c.Invalidate("/lib.libsonnet")
+
+	cached := func(filename, importedFrom string) bool {
+		_, ok := c.GetTopLevelObject(filename, importedFrom)
+		return ok
+	}
+	assert.False(t, cached("main.jsonnet", ""))
+	assert.False(t, cached("lib.libsonnet", "/main.jsonnet"))
+	assert.True(t, cached("base.libsonnet", "/lib.libsonnet"))
+	assert.True(t, cached("unrelated.jsonnet", ""))
+	assert.True(t, cached("other.libsonnet", "/unrelated.jsonnet"))
+	// Unresolved imports are never cached
+	assert.False(t, cached("missing.libsonnet", "/main.jsonnet"))
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	jsonnet "github.com/koskev/tree-sitter-jsonnet/bindings/go"
 	"github.com/sirupsen/logrus"
 	sitter "github.com/tree-sitter/go-tree-sitter"
@@ -23,6 +25,7 @@ const (
 	NodeClosingSquareBracket = "]"
 	NodeSemicolon            = ";"
 	NodeFieldAccess          = "fieldaccess"
+	NodeFieldAccessSuper     = "fieldaccess_super"
 	NodeFunctionCall         = "functioncall"
 	NodeFunction             = "function"
 	NodeID                   = "id"
@@ -37,6 +40,20 @@ const (
 	NodeString               = "string"
 	NodeArgs                 = "args"
 	NodeNumber               = "number"
+	NodeFieldname            = "fieldname"
+	NodeParam                = "param"
+	NodeSuper                = "super"
+	NodeObject               = "object"
+	NodeArray                = "array"
+	NodeForLoop              = "forloop"
+	NodeObjForLoop           = "objforloop"
+	NodeForSpec              = "forspec"
+	NodeCompSpec             = "compspec"
+	NodeField                = "field"
+	NodeParams               = "params"
+	NodeAnonymousFunction    = "anonymous_function"
+	NodeImportStr            = "importstr"
+	NodeComment              = "comment"
 )
 
 func NewTree(_ context.Context, content string) (*sitter.Node, error) {
@@ -58,6 +75,16 @@ func NewTree(_ context.Context, content string) (*sitter.Node, error) {
 	return node, nil
 }
 
+// protocolPosition converts the byte offset and point of the tree into a protocol position. Unlike the byte columns of
+// tree-sitter, protocol characters are UTF-16 code units
+func protocolPosition(content string, offset uint, point sitter.Point) protocol.Position {
+	lineStart := offset - point.Column
+	return protocol.Position{
+		Line:      uint32(point.Row),
+		Character: position.OffsetToProtocol(content[lineStart:offset], int(point.Column)).Character,
+	}
+}
+
 func GetNodeAtPos(root *sitter.Node, point sitter.Point) *sitter.Node {
 	startPos := point
 	endPos := point
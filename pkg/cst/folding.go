@@ -0,0 +1,223 @@
+package cst
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+type folder struct {
+	content  string
+	ranges   []protocol.FoldingRange
+	comments []*sitter.Node
+}
+
+// FoldingRanges returns the folding ranges of objects, arrays, function bodies, local chains, imports, comments and text blocks.
+// Only the tree-sitter tree is used, so folding keeps working while the document doesn't parse
+func FoldingRanges(root *sitter.Node, content string) []protocol.FoldingRange {
+	f := &folder{content: content}
+	f.visit(root)
+	f.foldComments()
+
+	slices.SortFunc(f.ranges, func(a, b protocol.FoldingRange) int {
+		return cmp.Or(
+			cmp.Compare(a.StartLine, b.StartLine),
+			cmp.Compare(b.EndLine, a.EndLine),
+			cmp.Compare(b.Kind, a.Kind),
+		)
+	})
+	// Clients only use one range per start line. Keep the largest one, e.g. the object of `a: { b: {`
+	return slices.CompactFunc(f.ranges, func(a, b protocol.FoldingRange) bool {
+		return a.StartLine == b.StartLine
+	})
+}
+
+func (f *folder) visit(node *sitter.Node) {
+	switch {
+	case IsNodeAny(node, []NodeType{NodeObject, NodeArray, NodeForLoop}):
+		f.foldBrackets(node)
+	case IsNode(node, NodeAnonymousFunction):
+		f.foldFunctionBody(node.ChildByFieldName("body"))
+	case IsNode(node, NodeBind) && node.ChildByFieldName("params") != nil:
+		f.foldFunctionBody(node.ChildByFieldName("body"))
+	case IsNode(node, NodeField) && hasChild(node, NodeParams):
+		f.foldFunctionBody(lastNamedChild(node))
+	case IsNode(node, NodeLocalBind) && !IsNode(node.Parent(), NodeLocalBind):
+		f.foldLocalChain(node)
+	case IsNode(node, NodeString):
+		// The closing ||| stays visible
+		start := node.Child(0)
+		if IsNode(start, NodeStringStart) && strings.HasPrefix(f.text(start), "|||") && node.EndPosition().Row > node.StartPosition().Row {
+			f.addLines(node.StartPosition().Row, node.EndPosition().Row-1, "")
+		}
+	case IsNode(node, NodeComment):
+		f.comments = append(f.comments, node)
+	}
+
+	for i := range node.ChildCount() {
+		f.visit(node.Child(i))
+	}
+}
+
+// foldBrackets folds the content between the brackets. A closing bracket on its own line stays visible
+func (f *folder) foldBrackets(node *sitter.Node) {
+	count := node.ChildCount()
+	if count < 2 {
+		return
+	}
+	open, closing := node.Child(0), node.Child(count-1)
+	if open.IsNamed() || closing.IsNamed() || closing.IsMissing() {
+		return
+	}
+	start := protocolPosition(f.content, open.EndByte(), open.EndPosition())
+	end := protocolPosition(f.content, closing.StartByte(), closing.StartPosition())
+	foldingRange := protocol.FoldingRange{
+		StartLine:      start.Line,
+		StartCharacter: start.Character,
+		EndLine:        end.Line,
+		EndCharacter:   end.Character,
+	}
+	if prev := closing.PrevSibling(); prev != nil && prev.EndPosition().Row < closing.StartPosition().Row {
+		foldingRange.EndLine, foldingRange.EndCharacter = end.Line-1, 0
+	}
+	f.add(foldingRange)
+}
+
+// foldFunctionBody folds a body that starts on a new line. Bodies starting on the line of the parameters fold themselves, e.g. objects
+func (f *folder) foldFunctionBody(body *sitter.Node) {
+	if body == nil || body.PrevSibling() == nil {
+		return
+	}
+	header := body.PrevSibling()
+	if header.EndPosition().Row == body.StartPosition().Row {
+		return
+	}
+	start := protocolPosition(f.content, header.EndByte(), header.EndPosition())
+	end := protocolPosition(f.content, body.EndByte(), body.EndPosition())
+	f.add(protocol.FoldingRange{
+		StartLine:      start.Line,
+		StartCharacter: start.Character,
+		EndLine:        end.Line,
+		EndCharacter:   end.Character,
+	})
+}
+
+// foldLocalChain folds consecutive locals like `local a = 1; local b = 2; a + b`. Imports and other locals are folded separately
+func (f *folder) foldLocalChain(first *sitter.Node) {
+	var chain []*sitter.Node
+	for node := first; IsNode(node, NodeLocalBind); node = lastNamedChild(node) {
+		if semicolon(node) == nil {
+			break
+		}
+		chain = append(chain, node)
+	}
+
+	for i := 0; i < len(chain); {
+		imports := importsOnly(chain[i])
+		j := i + 1
+		for j < len(chain) && importsOnly(chain[j]) == imports {
+			j++
+		}
+		if j-i > 1 {
+			kind := ""
+			if imports {
+				kind = string(protocol.Imports)
+			}
+			f.addLines(chain[i].StartPosition().Row, semicolon(chain[j-1]).EndPosition().Row, kind)
+		}
+		i = j
+	}
+}
+
+// foldComments folds multi-line block comments and consecutive line comments
+func (f *folder) foldComments() {
+	for i := 0; i < len(f.comments); i++ {
+		comment := f.comments[i]
+		if strings.HasPrefix(f.text(comment), "/*") {
+			f.addLines(comment.StartPosition().Row, comment.EndPosition().Row, string(protocol.Comment))
+			continue
+		}
+		if !startsLine(f.content, comment) {
+			// A comment after some code
+			continue
+		}
+		last := comment
+		for i+1 < len(f.comments) {
+			next := f.comments[i+1]
+			if strings.HasPrefix(f.text(next), "/*") || next.StartPosition().Row != last.StartPosition().Row+1 || !startsLine(f.content, next) {
+				break
+			}
+			last = next
+			i++
+		}
+		f.addLines(comment.StartPosition().Row, last.StartPosition().Row, string(protocol.Comment))
+	}
+}
+
+func (f *folder) add(foldingRange protocol.FoldingRange) {
+	if foldingRange.EndLine > foldingRange.StartLine {
+		f.ranges = append(f.ranges, foldingRange)
+	}
+}
+
+func (f *folder) addLines(startLine, endLine uint, kind string) {
+	f.add(protocol.FoldingRange{StartLine: uint32(startLine), EndLine: uint32(endLine), Kind: kind})
+}
+
+func (f *folder) text(node *sitter.Node) string {
+	return f.content[node.StartByte():node.EndByte()]
+}
+
+// startsLine checks if only whitespace is in front of the node
+func startsLine(content string, node *sitter.Node) bool {
+	lineStart := strings.LastIndexByte(content[:node.StartByte()], '\n') + 1
+	return strings.TrimSpace(content[lineStart:node.StartByte()]) == ""
+}
+
+func hasChild(node *sitter.Node, nodeType NodeType) bool {
+	for i := range node.ChildCount() {
+		if IsNode(node.Child(i), nodeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastNamedChild returns the last named child that isn't a comment
+func lastNamedChild(node *sitter.Node) *sitter.Node {
+	for i := int(node.NamedChildCount()) - 1; i >= 0; i-- {
+		if child := node.NamedChild(uint(i)); !IsNode(child, NodeComment) {
+			return child
+		}
+	}
+	return nil
+}
+
+// semicolon returns the semicolon ending the binds of a local
+func semicolon(localBind *sitter.Node) *sitter.Node {
+	for i := range localBind.ChildCount() {
+		if child := localBind.Child(i); IsNode(child, NodeSemicolon) && !child.IsMissing() {
+			return child
+		}
+	}
+	return nil
+}
+
+// importsOnly checks if all binds of a local are imports
+func importsOnly(localBind *sitter.Node) bool {
+	found := false
+	for i := range localBind.ChildCount() {
+		bind := localBind.Child(i)
+		if !IsNode(bind, NodeBind) {
+			continue
+		}
+		if !IsNodeAny(lastNamedChild(bind), []NodeType{NodeImport, NodeImportStr}) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
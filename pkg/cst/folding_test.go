@@ -0,0 +1,95 @@
+package cst
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldingRanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []protocol.FoldingRange
+	}{
+		{
+			name:    "object and array",
+			content: "{\n  a: [\n    1,\n  ],\n  b: { c: 1,\n    d: 2 },\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, StartCharacter: 1, EndLine: 5},
+				{StartLine: 1, StartCharacter: 6, EndLine: 2},
+				{StartLine: 4, StartCharacter: 6, EndLine: 5, EndCharacter: 9},
+			},
+		},
+		{
+			name:    "nested objects on one line",
+			content: "{ a: {\n  b: 1,\n} }\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, StartCharacter: 1, EndLine: 2, EndCharacter: 2},
+			},
+		},
+		{
+			name:    "non-ASCII text",
+			content: "{\n  'ünï': { a: 1,\n    b: 'é' },\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, StartCharacter: 1, EndLine: 2},
+				{StartLine: 1, StartCharacter: 10, EndLine: 2, EndCharacter: 11},
+			},
+		},
+		{
+			name:    "function bodies",
+			content: "local f(x) =\n  x + 1;\n{\n  g(y):: {\n    z: y,\n  },\n  h: function(q)\n    q,\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, StartCharacter: 12, EndLine: 1, EndCharacter: 7},
+				{StartLine: 2, StartCharacter: 1, EndLine: 7},
+				{StartLine: 3, StartCharacter: 10, EndLine: 4},
+				{StartLine: 6, StartCharacter: 16, EndLine: 7, EndCharacter: 5},
+			},
+		},
+		{
+			name:    "locals and imports",
+			content: "local a = import 'a.libsonnet';\nlocal b = importstr 'b.txt';\nlocal c = 1;\nlocal d = 2;\nlocal e = import 'e.libsonnet';\na + b + c + d + e\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, EndLine: 1, Kind: string(protocol.Imports)},
+				{StartLine: 2, EndLine: 3},
+			},
+		},
+		{
+			name:    "comments",
+			content: "/* a\n b */\n// c\n// d\n{\n  a: 1, // e\n  // f\n  b: 2,\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, EndLine: 1, Kind: string(protocol.Comment)},
+				{StartLine: 2, EndLine: 3, Kind: string(protocol.Comment)},
+				{StartLine: 4, StartCharacter: 1, EndLine: 7},
+			},
+		},
+		{
+			name:    "text block",
+			content: "{\n  a: |||\n    foo\n    bar\n  |||,\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, StartCharacter: 1, EndLine: 4},
+				{StartLine: 1, EndLine: 3},
+			},
+		},
+		{
+			name:    "syntax error",
+			content: "local a = import 'a.libsonnet';\nlocal b = import 'b.libsonnet';\n{\n  a: {\n    b: a.,\n  },\n  c: [\n    1,\n  ],\n}\n",
+			expected: []protocol.FoldingRange{
+				{StartLine: 0, EndLine: 1, Kind: string(protocol.Imports)},
+				{StartLine: 2, StartCharacter: 1, EndLine: 8},
+				{StartLine: 3, StartCharacter: 6, EndLine: 4},
+				{StartLine: 6, StartCharacter: 6, EndLine: 7},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := NewTree(context.Background(), tc.content)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, FoldingRanges(root, tc.content))
+		})
+	}
+}
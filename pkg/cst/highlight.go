@@ -0,0 +1,61 @@
+package cst
+
+import (
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// ComprehensionVariables returns the variables of the for specs of the comprehension starting at the byte offset,
+// e.g. `x` of `[x for x in arr]`. Variables of nested comprehensions are not included
+func ComprehensionVariables(root *sitter.Node, offset uint) []*sitter.Node {
+	for _, node := range nodesStartingAt(root, offset) {
+		switch {
+		case IsNode(node, NodeForLoop):
+			return forSpecVariables(node)
+		case IsNode(node, NodeObject):
+			if loop := node.NamedChild(0); IsNode(loop, NodeObjForLoop) {
+				return forSpecVariables(loop)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func forSpecVariables(comprehension *sitter.Node) []*sitter.Node {
+	var variables []*sitter.Node
+	for i := range comprehension.NamedChildCount() {
+		child := comprehension.NamedChild(i)
+		switch {
+		case IsNode(child, NodeForSpec):
+			if variable := child.NamedChild(0); IsNode(variable, NodeID) {
+				variables = append(variables, variable)
+			}
+		case IsNode(child, NodeCompSpec):
+			variables = append(variables, forSpecVariables(child)...)
+		}
+	}
+	return variables
+}
+
+// SelfFieldAccess returns the name of the field accessed via `self.name`, `super.name` or `$.name` starting at the
+// byte offset. Returns nil for other expressions, e.g. `self['name']`
+func SelfFieldAccess(root *sitter.Node, offset uint) *sitter.Node {
+	for _, node := range nodesStartingAt(root, offset) {
+		switch {
+		case IsNode(node, NodeFieldAccessSuper):
+			return node.NamedChild(1)
+		case IsNode(node, NodeFieldAccess) && IsNodeAny(node.NamedChild(0), []NodeType{NodeSelf, NodeDollar}):
+			return node.ChildByFieldName("last")
+		}
+	}
+	return nil
+}
+
+// nodesStartingAt returns the named node at the byte offset and all its ancestors starting there, innermost first
+func nodesStartingAt(root *sitter.Node, offset uint) []*sitter.Node {
+	var nodes []*sitter.Node
+	for node := root.NamedDescendantForByteRange(offset, offset); node != nil && node.StartByte() == offset; node = node.Parent() {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
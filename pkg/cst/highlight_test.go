@@ -0,0 +1,117 @@
+package cst
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+func nodeTexts(nodes []*sitter.Node, content string) []string {
+	var texts []string
+	for _, node := range nodes {
+		texts = append(texts, content[node.StartByte():node.EndByte()])
+	}
+	return texts
+}
+
+func TestComprehensionVariables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		startAt  string
+		expected []string
+	}{
+		{
+			name:     "array",
+			content:  "[x + y for x in [1] for y in [2] if x > 0]",
+			startAt:  "[x",
+			expected: []string{"x", "y"},
+		},
+		{
+			name:     "object",
+			content:  "local a = 1;\n{ [k]: a for k in ['a'] }",
+			startAt:  "{",
+			expected: []string{"k"},
+		},
+		{
+			name:     "nested comprehension",
+			content:  "[[y for y in x] for x in [[1]]]",
+			startAt:  "[[",
+			expected: []string{"x"},
+		},
+		{
+			name:     "strings and comments",
+			content:  "[\n  'for a in b' // for c in d\n  for x in [1]\n]",
+			startAt:  "[",
+			expected: []string{"x"},
+		},
+		{
+			name:    "object without comprehension",
+			content: "{ a: [x for x in [1]] }",
+			startAt: "{",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := NewTree(context.Background(), tc.content)
+			require.NoError(t, err)
+			offset := uint(strings.Index(tc.content, tc.startAt))
+			assert.Equal(t, tc.expected, nodeTexts(ComprehensionVariables(root, offset), tc.content))
+		})
+	}
+}
+
+func TestSelfFieldAccess(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		startAt  string
+		expected string
+	}{
+		{
+			name:     "self",
+			content:  "{ a: 1, b: self.a.c }",
+			startAt:  "self",
+			expected: "a",
+		},
+		{
+			name:     "dollar with whitespace",
+			content:  "{ a: 1, b: $ . a }",
+			startAt:  "$",
+			expected: "a",
+		},
+		{
+			name:     "super",
+			content:  "{ a: 1 } + { a: super.a }",
+			startAt:  "super",
+			expected: "a",
+		},
+		{
+			name:    "indexing",
+			content: "{ a: 1, b: self['a'] }",
+			startAt: "self",
+		},
+		{
+			name:    "other object",
+			content: "local o = { a: 1 }; o.a",
+			startAt: "o.a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := NewTree(context.Background(), tc.content)
+			require.NoError(t, err)
+			name := SelfFieldAccess(root, uint(strings.Index(tc.content, tc.startAt)))
+			if tc.expected == "" {
+				assert.Nil(t, name)
+				return
+			}
+			require.NotNil(t, name)
+			assert.Equal(t, tc.expected, tc.content[name.StartByte():name.EndByte()])
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package cst
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	log "github.com/sirupsen/logrus"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+const (
+	// Each round may uncover new errors (e.g. removing a dangling operator leaves a missing expression)
+	maxRecoveryRounds = 5
+	// Used for missing expressions. Evaluates to something harmless and is a single token
+	placeholderExpression = "null"
+	// Used for missing names of fields, binds and parameters
+	placeholderIdentifier = "__missing"
+	// Tokens that are left over at the end of an unfinished expression
+	danglingTokens = ".,"
+)
+
+type textEdit struct {
+	start, end uint
+	text       string
+}
+
+// RecoverAST parses the content into a go-jsonnet AST. If the content contains syntax errors, the broken parts
+// are located with tree-sitter and replaced by placeholders, so the rest of the document still results in an AST.
+// All replacements try to keep the length of the original text, so locations in the AST match the original document.
+//
+// editLine is the zero based line that was last edited or -1 if unknown. Errors are most likely where the user is typing,
+// so that line is tried to be fixed first.
+//
+// The returned error is always the error of parsing the unmodified content. The AST is nil if it could not be recovered.
+func RecoverAST(ctx context.Context, filename string, content string, editLine int) (ast.Node, error) {
+	root, parseErr := jsonnet.SnippetToAST(filename, content)
+	if parseErr == nil {
+		return root, nil
+	}
+
+	for _, candidate := range editLineCandidates(content, editLine) {
+		root, err := jsonnet.SnippetToAST(filename, candidate)
+		if err == nil {
+			log.Debugf("Recovered ast of %s at line %d", filename, editLine)
+			return root, parseErr
+		}
+	}
+
+	for _, strategy := range []repairStrategy{closeBrackets, blankErrors} {
+		repaired := content
+		for range maxRecoveryRounds {
+			var changed bool
+			var err error
+			repaired, changed, err = repairContent(ctx, repaired, strategy)
+			if err != nil || !changed {
+				break
+			}
+			root, err = jsonnet.SnippetToAST(filename, repaired)
+			if err == nil {
+				log.Debugf("Recovered ast of %s", filename)
+				return root, parseErr
+			}
+		}
+	}
+
+	log.Debugf("Unable to recover ast of %s", filename)
+	return nil, parseErr
+}
+
+// editLineCandidates returns versions of the content where the edited line is completed.
+// Dangling tokens at the end of the line are removed and brackets opened on the line are closed.
+// Changes are only done at the end of the line, so no location of any other node is moved.
+func editLineCandidates(content string, editLine int) []string {
+	if editLine < 0 {
+		return nil
+	}
+	start := 0
+	for range editLine {
+		next := strings.IndexByte(content[start:], '\n')
+		if next < 0 {
+			return nil
+		}
+		start += next + 1
+	}
+	end := len(content)
+	if next := strings.IndexByte(content[start:], '\n'); next >= 0 {
+		end = start + next
+	}
+
+	line := content[start:end]
+	completed := strings.TrimRight(strings.TrimRight(line, " \t\r"), danglingTokens) + unclosedBrackets(line)
+
+	var candidates []string
+	for _, suffix := range []string{"", ",", ";"} {
+		candidate := completed + suffix
+		if len(candidate) < len(line) {
+			candidate += strings.Repeat(" ", len(line)-len(candidate))
+		}
+		if candidate != line {
+			candidates = append(candidates, content[:start]+candidate+content[end:])
+		}
+	}
+	return candidates
+}
+
+type repairStrategy int
+
+const (
+	// Closes brackets that are still open inside an error. Keeps e.g. function calls that are currently being typed
+	closeBrackets repairStrategy = iota
+	// Removes the errors completely
+	blankErrors
+)
+
+// repairContent runs one round of repairs on the content. Error nodes are fixed according to the strategy and missing nodes are inserted.
+// Returns false if nothing could be repaired.
+func repairContent(ctx context.Context, content string, strategy repairStrategy) (string, bool, error) {
+	root, err := NewTree(ctx, content)
+	if err != nil {
+		return "", false, err
+	}
+	if !root.HasError() {
+		return content, false, nil
+	}
+
+	var edits []textEdit
+	collectRepairs(root, content, strategy, &edits)
+	if len(edits) == 0 {
+		return content, false, nil
+	}
+
+	// Apply from back to front to keep the offsets valid
+	slices.SortFunc(edits, func(a, b textEdit) int {
+		return int(b.start) - int(a.start)
+	})
+	repaired := content
+	for _, edit := range edits {
+		repaired = repaired[:edit.start] + edit.text + repaired[edit.end:]
+	}
+	return repaired, repaired != content, nil
+}
+
+func collectRepairs(node *sitter.Node, content string, strategy repairStrategy, edits *[]textEdit) {
+	switch {
+	case node.IsError() && node.Parent() != nil:
+		if strategy == closeBrackets {
+			if edit, ok := closeBracketsEdit(node, content); ok {
+				*edits = append(*edits, edit)
+				return
+			}
+		}
+		*edits = append(*edits, blankEdit(node, content))
+		return
+	case node.IsError():
+		// The whole document is an error. Blanking it would leave nothing, so only remove dangling tokens at the end
+		// and let the next round figure out what is missing
+		last := node.Child(node.ChildCount() - 1)
+		if last != nil && !last.IsNamed() {
+			*edits = append(*edits, blankEdit(last, content))
+		} else if last != nil && IsNode(node.Child(0), NodeLocal) {
+			// A chain of locals without a body. Appending at the end does not move any location
+			*edits = append(*edits, textEdit{start: uint(len(content)), end: uint(len(content)), text: ";" + placeholderExpression})
+		}
+	case isMissing(node) && IsNode(node.PrevSibling(), NodeDot) && !IsNode(node.PrevSibling().PrevSibling(), NodeSuper):
+		// An index that is currently being typed (`obj.`). Drop the dot instead of inventing an index
+		*edits = append(*edits, blankEdit(node.PrevSibling(), content))
+		return
+	case isMissing(node):
+		*edits = append(*edits, insertEdit(node.StartByte(), placeholderFor(node), content))
+		return
+	}
+
+	if !node.HasError() {
+		return
+	}
+	for i := range node.ChildCount() {
+		collectRepairs(node.Child(i), content, strategy, edits)
+	}
+}
+
+// closeBracketsEdit closes all brackets that are opened inside the error node but never closed.
+// A dangling token at the end (e.g. the dot of `f(obj.`) is replaced by the closing brackets.
+func closeBracketsEdit(node *sitter.Node, content string) (textEdit, bool) {
+	text := content[node.StartByte():node.EndByte()]
+	closers := unclosedBrackets(text)
+	if closers == "" {
+		return textEdit{}, false
+	}
+
+	trimmed := strings.TrimRight(text, " \t\r\n")
+	end := node.StartByte() + uint(len(trimmed))
+	edit := insertEdit(end, closers, content)
+	// Replace the dangling tokens as well
+	edit.start = node.StartByte() + uint(len(strings.TrimRight(trimmed, danglingTokens)))
+	return edit, true
+}
+
+// unclosedBrackets returns the closing brackets for all brackets that are opened in the text but not closed
+func unclosedBrackets(text string) string {
+	closing := map[rune]rune{'(': ')', '[': ']', '{': '}'}
+
+	var open []rune
+	var quote rune
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case closing[r] != 0:
+			open = append(open, closing[r])
+		case len(open) > 0 && r == open[len(open)-1]:
+			open = open[:len(open)-1]
+		}
+	}
+
+	var closers strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		closers.WriteRune(open[i])
+	}
+	return closers.String()
+}
+
+func isMissing(node *sitter.Node) bool {
+	return node.IsMissing() || (node.ChildCount() == 0 && node.StartByte() == node.EndByte())
+}
+
+// blankEdit replaces the node with whitespace. Newlines are kept to not move any of the following lines
+func blankEdit(node *sitter.Node, content string) textEdit {
+	text := content[node.StartByte():node.EndByte()]
+	blanked := strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		return ' '
+	}, text)
+	return textEdit{
+		start: node.StartByte(),
+		end:   node.EndByte(),
+		// Multibyte runes are replaced by a single space. Keep the byte length anyway
+		text: blanked + strings.Repeat(" ", len(text)-len(blanked)),
+	}
+}
+
+// insertEdit inserts the text at the offset. Following spaces are consumed to keep the columns of the line intact where possible
+func insertEdit(offset uint, text string, content string) textEdit {
+	end := offset
+	for end < uint(len(content)) && end-offset < uint(len(text)) && (content[end] == ' ' || content[end] == '\t') {
+		end++
+	}
+	return textEdit{start: offset, end: end, text: text}
+}
+
+func placeholderFor(node *sitter.Node) string {
+	if !node.IsNamed() {
+		// Anonymous nodes are tokens like ")" or ";". Their kind is the token itself
+		return node.Kind()
+	}
+	if IsNode(node, NodeID) && isNamePosition(node) {
+		return placeholderIdentifier
+	}
+	return placeholderExpression
+}
+
+// isNamePosition checks if an identifier is used as a name instead of an expression
+func isNamePosition(node *sitter.Node) bool {
+	parent := node.Parent()
+	switch {
+	case IsNodeAny(parent, []NodeType{NodeFieldname, NodeParam}), IsNode(node.PrevSibling(), NodeDot):
+		return true
+	case IsNode(parent, NodeBind):
+		// The first child of a bind is its name, everything after the "=" is the body
+		return parent.Child(0) != nil && parent.Child(0).Id() == node.Id()
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package cst
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairContent(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{name: "dangling dot in object", content: "local myObj = {};\n{ a: myObj., b: 1 }"},
+		{name: "missing bind body", content: "local x = ;\n{}"},
+		{name: "missing closing bracket", content: "local foo(x) = x;\n{ a: foo(1, }"},
+		{name: "missing closing square bracket", content: "{ a: [1, 2 }"},
+		{name: "dangling operator", content: "local f(x) = x +;\nf(1)"},
+		{name: "missing then branch", content: "{ a: if true then }"},
+		{name: "missing field value", content: "{\n  a: 1,\n  b: {\n    c: \n  },\n  d: 3,\n}"},
+		{name: "local without body", content: "local x = std."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := RecoverAST(context.Background(), "test.jsonnet", tc.content, -1)
+			// The error of the original content is still returned
+			require.Error(t, err)
+			assert.NotNil(t, root)
+		})
+	}
+}
+
+func TestRecoverASTKeepsLocations(t *testing.T) {
+	content := "local obj = { field: 1 };\n{\n  a: obj., b: obj.field,\n}"
+	root, err := RecoverAST(context.Background(), "test.jsonnet", content, -1)
+	require.Error(t, err)
+	require.NotNil(t, root)
+
+	local, ok := root.(*ast.Local)
+	require.True(t, ok)
+	object, ok := local.Body.(*ast.DesugaredObject)
+	require.True(t, ok)
+	require.Len(t, object.Fields, 2)
+	// The field after the broken one is still at its original location
+	assert.Equal(t, ast.Location{Line: 3, Column: 12}, object.Fields[1].LocRange.Begin)
+}
+
+func TestRecoverASTValid(t *testing.T) {
+	root, err := RecoverAST(context.Background(), "test.jsonnet", "{ a: 1 }", -1)
+	require.NoError(t, err)
+	assert.NotNil(t, root)
+}
+
+func TestRecoverASTUnrecoverable(t *testing.T) {
+	root, err := RecoverAST(context.Background(), "test.jsonnet", "{ a: unknownVar }", -1)
+	require.Error(t, err)
+	assert.Nil(t, root)
+}
@@ -0,0 +1,43 @@
+package cst
+
+import (
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// AncestorRanges returns the ranges of the node at the position and all its ancestors, innermost first.
+// Ranges that are equal to the one before are skipped, e.g. a field and its member
+func AncestorRanges(root *sitter.Node, content string, pos protocol.Position) []protocol.Range {
+	offset, err := position.ProtocolToOffset(content, pos)
+	if err != nil {
+		return nil
+	}
+	node := namedNodeAt(root, uint(offset))
+	var ranges []protocol.Range
+	for ; node != nil; node = node.Parent() {
+		nodeRange := protocol.Range{
+			Start: protocolPosition(content, node.StartByte(), node.StartPosition()),
+			End:   protocolPosition(content, node.EndByte(), node.EndPosition()),
+		}
+		if len(ranges) > 0 && ranges[len(ranges)-1] == nodeRange {
+			continue
+		}
+		ranges = append(ranges, nodeRange)
+	}
+	return ranges
+}
+
+// namedNodeAt returns the smallest named node at the byte offset. A node ending at the offset is preferred, so a
+// cursor right after an identifier selects the identifier
+func namedNodeAt(root *sitter.Node, offset uint) *sitter.Node {
+	node := root.NamedDescendantForByteRange(offset, offset)
+	if offset == 0 {
+		return node
+	}
+	if candidate := root.NamedDescendantForByteRange(offset-1, offset-1); candidate != nil && candidate.EndByte() == offset &&
+		(node == nil || candidate.EndByte()-candidate.StartByte() < node.EndByte()-node.StartByte()) {
+		return candidate
+	}
+	return node
+}
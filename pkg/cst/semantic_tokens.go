@@ -0,0 +1,334 @@
+package cst
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+var (
+	// A placeholder of std.format and the % operator, e.g. `%(name)s` or `%05.2f`
+	formatSpecifierRegexp = regexp.MustCompile(`%(?:\([^)\n]*\))?[#0 +-]*(?:\*|\d+)?(?:\.(?:\*|\d+))?[hlL]?[diouxXeEfFgGcrs%]`)
+	// Documentation marking a symbol as deprecated, e.g. `// Deprecated: use b instead` or `@deprecated`
+	deprecatedRegexp = regexp.MustCompile(`(?i)\bdeprecated\b`)
+)
+
+var (
+	keywordNodes  = []NodeType{NodeLocal, NodeFunction, NodeImport, NodeImportStr, "if", "then", "else", "for", "in", "assert", "error", "tailstrict"}
+	builtinNodes  = []NodeType{NodeSelf, NodeSuper, NodeDollar, "null", "true", "false"}
+	operatorNodes = []NodeType{"additive", "multiplicative", "comparison", "equality", "bitshift", "bitand", "bitxor", "bitor", "and", "or", "unaryop"}
+	// Only operators of fields. The colon of asserts and slices is punctuation
+	fieldOperatorNodes = []NodeType{NodeColon, "::", ":::", "+"}
+)
+
+// SemanticToken is a token on a single line. References to variables have the type variable without modifiers
+// unless they are std. The server resolves them with the AST
+type SemanticToken struct {
+	Range     protocol.Range
+	Type      protocol.SemanticTokenTypes
+	Modifiers []protocol.SemanticTokenModifiers
+}
+
+type tokenizer struct {
+	root    *sitter.Node
+	content string
+	tokens  []SemanticToken
+	// Only nodes overlapping the bytes between start and end are visited
+	start, end uint
+	// Byte offsets of the line starts
+	lines []uint
+	// Names of the fields documented as deprecated via docsonnet, by the start of their object
+	deprecatedFields map[uint]map[string]bool
+}
+
+// SemanticTokens returns the tokens of comments, keywords, operators, literals and identifiers. Strings formatted with
+// the % operator or std.format are split around their format specifiers
+func SemanticTokens(root *sitter.Node, content string) []SemanticToken {
+	return SemanticTokensInRange(root, content, 0, uint(len(content)))
+}
+
+// SemanticTokensInRange returns the tokens of the nodes overlapping the bytes between start and end. Other nodes are not visited
+func SemanticTokensInRange(root *sitter.Node, content string, start, end uint) []SemanticToken {
+	t := &tokenizer{
+		root:             root,
+		content:          content,
+		start:            start,
+		end:              end,
+		deprecatedFields: map[uint]map[string]bool{},
+		lines:            []uint{0},
+	}
+	for i := range len(content) {
+		if content[i] == '\n' {
+			t.lines = append(t.lines, uint(i+1))
+		}
+	}
+	t.visit(root)
+	return t.tokens
+}
+
+func (t *tokenizer) visit(node *sitter.Node) {
+	if node.EndByte() <= t.start || node.StartByte() >= t.end {
+		return
+	}
+	switch {
+	case IsNode(node, NodeComment):
+		t.addNode(node, protocol.CommentType)
+		return
+	case IsNode(node, NodeString):
+		t.visitString(node)
+		return
+	case IsNode(node, NodeNumber):
+		t.addNode(node, protocol.NumberType)
+		return
+	case IsNode(node, NodeID):
+		t.visitID(node)
+		return
+	case IsNode(node, NodeFieldname) && IsNodeAny(node.Child(0), []NodeType{NodeID, NodeString}):
+		t.visitFieldname(node)
+		return
+	case IsNodeAny(node, operatorNodes):
+		t.addNode(node, protocol.OperatorType)
+		return
+	case node.ChildCount() == 0:
+		t.visitLeaf(node)
+		return
+	}
+
+	for i := range node.ChildCount() {
+		t.visit(node.Child(i))
+	}
+}
+
+func (t *tokenizer) visitLeaf(node *sitter.Node) {
+	switch {
+	case IsNodeAny(node, builtinNodes):
+		t.addNode(node, protocol.VariableType, protocol.ModDefaultLibrary)
+	case IsNodeAny(node, keywordNodes):
+		t.addNode(node, protocol.KeywordType)
+	case IsNode(node, "=") || (IsNodeAny(node, fieldOperatorNodes) && IsNode(node.Parent(), NodeField)):
+		t.addNode(node, protocol.OperatorType)
+	}
+}
+
+func (t *tokenizer) visitID(node *sitter.Node) {
+	parent := node.Parent()
+	switch {
+	case IsNode(parent, NodeBind) && sameNode(parent.Child(0), node):
+		t.addNode(node, bindType(parent), t.declarationModifiers(node)...)
+	case IsNode(parent, NodeParam) && sameNode(parent.ChildByFieldName("identifier"), node):
+		t.addNode(node, protocol.ParameterType, protocol.ModDeclaration)
+	case IsNode(parent, "forspec") && sameNode(parent.Child(1), node):
+		t.addNode(node, protocol.VariableType, protocol.ModDeclaration)
+	case IsNode(parent, "named_argument") && sameNode(parent.Child(0), node):
+		t.addNode(node, protocol.ParameterType)
+	case IsNode(parent, NodeFieldAccess) && sameNode(parent.ChildByFieldName("last"), node),
+		IsNode(parent, "fieldaccess_super"):
+		// The called function of `a.b()`
+		if IsNode(parent.Parent(), NodeFunctionCall) && sameNode(parent.Parent().Child(0), parent) {
+			t.addNode(node, protocol.FunctionType)
+		} else {
+			t.addNode(node, protocol.PropertyType)
+		}
+	case t.text(node) == "std":
+		t.addNode(node, protocol.VariableType, protocol.ModDefaultLibrary)
+	default:
+		t.addNode(node, protocol.VariableType)
+	}
+}
+
+// visitFieldname adds the name of a field. Computed field names are visited like expressions
+func (t *tokenizer) visitFieldname(node *sitter.Node) {
+	field := node.Parent()
+	tokenType := protocol.PropertyType
+	if field.ChildByFieldName("function") != nil || IsNode(lastNamedChild(field), NodeAnonymousFunction) {
+		tokenType = protocol.MethodType
+	}
+	modifiers := t.declarationModifiers(node)
+	if hasChild(field, "::") {
+		// Hidden fields
+		modifiers = append(modifiers, protocol.ModReadonly)
+	}
+	if strings.HasPrefix(fieldName(node, t.content), "#") {
+		// Docsonnet documentation of the field without the #
+		modifiers = append(modifiers, protocol.ModDocumentation)
+	}
+	if t.deprecatedField(field, fieldName(node, t.content)) && !slices.Contains(modifiers, protocol.ModDeprecated) {
+		modifiers = append(modifiers, protocol.ModDeprecated)
+	}
+	t.addNode(node, tokenType, modifiers...)
+}
+
+// visitString adds a string split around its format specifiers. Escape sequences are part of the string token
+func (t *tokenizer) visitString(node *sitter.Node) {
+	var specifiers [][]int
+	if content, err := GetFirstChildType(node, NodeStringContent); err == nil && isFormatString(node, t.content) {
+		for _, match := range formatSpecifierRegexp.FindAllStringIndex(t.text(content), -1) {
+			specifiers = append(specifiers, []int{int(content.StartByte()) + match[0], int(content.StartByte()) + match[1]})
+		}
+	}
+
+	start := node.StartByte()
+	for _, specifier := range specifiers {
+		t.add(start, uint(specifier[0]), protocol.StringType)
+		t.add(uint(specifier[0]), uint(specifier[1]), protocol.MacroType)
+		start = uint(specifier[1])
+	}
+	t.add(start, node.EndByte(), protocol.StringType)
+}
+
+// isFormatString checks if the string is formatted by the % operator or std.format
+func isFormatString(node *sitter.Node, content string) bool {
+	parent := node.Parent()
+	if IsNode(parent, "binary") {
+		operator := parent.ChildByFieldName("operator")
+		return sameNode(parent.ChildByFieldName("left"), node) && operator != nil && content[operator.StartByte():operator.EndByte()] == "%"
+	}
+	if IsNode(parent, NodeArgs) && sameNode(parent.NamedChild(0), node) {
+		target := parent.Parent().Child(0)
+		return target != nil && strings.Join(strings.Fields(content[target.StartByte():target.EndByte()]), "") == "std.format"
+	}
+	return false
+}
+
+// bindType returns the type of the variable declared by the bind
+func bindType(bind *sitter.Node) protocol.SemanticTokenTypes {
+	value := lastNamedChild(bind)
+	switch {
+	case bind.ChildByFieldName("params") != nil || IsNode(value, NodeAnonymousFunction):
+		return protocol.FunctionType
+	case IsNode(value, NodeImport):
+		return protocol.NamespaceType
+	}
+	return protocol.VariableType
+}
+
+// declarationModifiers returns the modifiers of a declared name. It is deprecated if a comment directly above mentions it
+func (t *tokenizer) declarationModifiers(name *sitter.Node) []protocol.SemanticTokenModifiers {
+	modifiers := []protocol.SemanticTokenModifiers{protocol.ModDeclaration}
+	for row := name.StartPosition().Row; row > 0; {
+		comment := t.commentEndingOn(row - 1)
+		if comment == nil {
+			break
+		}
+		if deprecatedRegexp.MatchString(t.text(comment)) {
+			modifiers = append(modifiers, protocol.ModDeprecated)
+			break
+		}
+		row = comment.StartPosition().Row
+	}
+	return modifiers
+}
+
+// commentEndingOn returns the comment ending on the row if it starts its line. The comments above a declaration are
+// looked up in the tree, since they might be outside of the visited range
+func (t *tokenizer) commentEndingOn(row uint) *sitter.Node {
+	if int(row) >= len(t.lines) {
+		return nil
+	}
+	lineEnd := uint(len(t.content))
+	if int(row)+1 < len(t.lines) {
+		lineEnd = t.lines[row+1] - 1
+	}
+	line := strings.TrimRight(t.content[t.lines[row]:lineEnd], " \t\r")
+	if line == "" {
+		return nil
+	}
+	// A comment ending on the row contains the last character of the line
+	last := t.lines[row] + uint(len(line)) - 1
+	comment := t.root.DescendantForByteRange(last, last+1)
+	if !IsNode(comment, NodeComment) || comment.EndPosition().Row != row || !startsLine(t.content, comment) {
+		return nil
+	}
+	return comment
+}
+
+// deprecatedField checks if the docsonnet field `#name` of the object mentions that the field is deprecated
+func (t *tokenizer) deprecatedField(field *sitter.Node, name string) bool {
+	object := field.Parent()
+	if IsNode(object, "member") {
+		object = object.Parent()
+	}
+	if !IsNode(object, NodeObject) {
+		return false
+	}
+
+	deprecated, ok := t.deprecatedFields[object.StartByte()]
+	if !ok {
+		deprecated = map[string]bool{}
+		for i := range object.NamedChildCount() {
+			docField := object.NamedChild(i).NamedChild(0)
+			if !IsNode(docField, NodeField) {
+				continue
+			}
+			docName := fieldName(docField.NamedChild(0), t.content)
+			if value := lastNamedChild(docField); strings.HasPrefix(docName, "#") && value != nil && deprecatedRegexp.MatchString(t.text(value)) {
+				deprecated[strings.TrimPrefix(docName, "#")] = true
+			}
+		}
+		t.deprecatedFields[object.StartByte()] = deprecated
+	}
+	return deprecated[name]
+}
+
+// fieldName returns the name of a fieldname node. Empty for computed names
+func fieldName(fieldname *sitter.Node, content string) string {
+	if !IsNode(fieldname, NodeFieldname) {
+		return ""
+	}
+	name := fieldname.Child(0)
+	if IsNode(name, NodeString) {
+		name, _ = GetFirstChildType(name, NodeStringContent)
+	}
+	if !IsNodeAny(name, []NodeType{NodeID, NodeStringContent}) {
+		return ""
+	}
+	return content[name.StartByte():name.EndByte()]
+}
+
+func (t *tokenizer) addNode(node *sitter.Node, tokenType protocol.SemanticTokenTypes, modifiers ...protocol.SemanticTokenModifiers) {
+	t.add(node.StartByte(), node.EndByte(), tokenType, modifiers...)
+}
+
+// add adds a token for the bytes between start and end. Tokens spanning multiple lines are split into one token per line
+func (t *tokenizer) add(start, end uint, tokenType protocol.SemanticTokenTypes, modifiers ...protocol.SemanticTokenModifiers) {
+	line, _ := slices.BinarySearch(t.lines, start+1)
+	lineStart := t.lines[line-1]
+	for start < end {
+		lineEnd := end
+		if i := strings.IndexByte(t.content[start:end], '\n'); i >= 0 {
+			lineEnd = start + uint(i)
+		}
+		if lineEnd > start {
+			// Unlike the bytes of tree-sitter, protocol characters are UTF-16 code units
+			t.tokens = append(t.tokens, SemanticToken{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(line - 1), Character: t.character(lineStart, start)},
+					End:   protocol.Position{Line: uint32(line - 1), Character: t.character(lineStart, lineEnd)},
+				},
+				Type:      tokenType,
+				Modifiers: modifiers,
+			})
+		}
+		start = lineEnd + 1
+		lineStart = start
+		line++
+	}
+}
+
+// character returns the protocol character of the byte offset on the line starting at lineStart
+func (t *tokenizer) character(lineStart, offset uint) uint32 {
+	return position.OffsetToProtocol(t.content[lineStart:offset], int(offset-lineStart)).Character
+}
+
+func (t *tokenizer) text(node *sitter.Node) string {
+	return t.content[node.StartByte():node.EndByte()]
+}
+
+// sameNode checks if both nodes are the same node
+func sameNode(child, node *sitter.Node) bool {
+	return child != nil && node != nil && child.StartByte() == node.StartByte() && child.EndByte() == node.EndByte() && child.Kind() == node.Kind()
+}
@@ -0,0 +1,108 @@
+package cst
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticTokens(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:    "locals and parameters",
+			content: "local a = import 'a.libsonnet';\nlocal f(x, y=1) = function(z) x;\nf(y=a)",
+			expected: []string{
+				"local keyword []", "a namespace [declaration]", "= operator []", "import keyword []", "'a.libsonnet' string []",
+				"local keyword []", "f function [declaration]", "x parameter [declaration]", "y parameter [declaration]", "= operator []",
+				"1 number []", "= operator []", "function keyword []", "z parameter [declaration]", "x variable []",
+				"f variable []", "y parameter []", "= operator []", "a variable []",
+			},
+		},
+		{
+			name:    "fields",
+			content: "{ a: 1, b:: self.a, 'c'+: $.b, d(x)::: super.d(x), [std.toString(1)]: null }",
+			expected: []string{
+				"a property [declaration]", ": operator []", "1 number []",
+				"b property [declaration readonly]", ":: operator []", "self variable [defaultLibrary]", "a property []",
+				"'c' property [declaration]", "+ operator []", ": operator []", "$ variable [defaultLibrary]", "b property []",
+				"d method [declaration]", "x parameter [declaration]", "::: operator []", "super variable [defaultLibrary]", "d function []", "x variable []",
+				"std variable [defaultLibrary]", "toString function []", "1 number []", ": operator []", "null variable [defaultLibrary]",
+			},
+		},
+		{
+			name:    "operators and keywords",
+			content: "assert !true || 1 + 2 * 3 == 7 : 'm';\nif 1 < 2 then [x for x in [] if x != 0] else error 'e'",
+			expected: []string{
+				"assert keyword []", "! operator []", "true variable [defaultLibrary]", "|| operator []", "1 number []", "+ operator []",
+				"2 number []", "* operator []", "3 number []", "== operator []", "7 number []", "'m' string []",
+				"if keyword []", "1 number []", "< operator []", "2 number []", "then keyword []", "x variable []", "for keyword []",
+				"x variable [declaration]", "in keyword []", "if keyword []", "x variable []", "!= operator []", "0 number []",
+				"else keyword []", "error keyword []", "'e' string []",
+			},
+		},
+		{
+			name:    "comments and text blocks",
+			content: "/* a\n b */\n# c\n{\n  a: |||\n    text\n  |||, // d\n}",
+			expected: []string{
+				"/* a comment []", " b */ comment []", "# c comment []",
+				"a property [declaration]", ": operator []", "||| string []", "    text string []", "  ||| string []", "// d comment []",
+			},
+		},
+		{
+			name:    "format strings",
+			content: "['%(a)s: %05.2f%%' % {a: 1}, std.format('%s', 1), '%s']",
+			expected: []string{
+				"' string []", "%(a)s macro []", ":  string []", "%05.2f macro []", "%% macro []", "' string []", "% operator []",
+				"a property [declaration]", ": operator []", "1 number []",
+				"std variable [defaultLibrary]", "format function []", "' string []", "%s macro []", "' string []", "1 number []",
+				"'%s' string []",
+			},
+		},
+		{
+			name:    "deprecated",
+			content: "// Deprecated: use b\nlocal a = 1;\n# Just a comment\nlocal b = 2;\n{\n  '#c':: d.fn('DEPRECATED: use e'),\n  c: a,\n  // @deprecated\n  d: b,\n  e: 1,\n}",
+			expected: []string{
+				"// Deprecated: use b comment []", "local keyword []", "a variable [declaration deprecated]", "= operator []", "1 number []",
+				"# Just a comment comment []", "local keyword []", "b variable [declaration]", "= operator []", "2 number []",
+				"'#c' property [declaration readonly documentation]", ":: operator []", "d variable []", "fn function []", "'DEPRECATED: use e' string []",
+				"c property [declaration deprecated]", ": operator []", "a variable []",
+				"// @deprecated comment []", "d property [declaration deprecated]", ": operator []", "b variable []",
+				"e property [declaration]", ": operator []", "1 number []",
+			},
+		},
+		{
+			name:    "non-ASCII",
+			content: "{ 'ä😀': 'ö', b: |||\n  😀 text\n||| }",
+			expected: []string{
+				"'ä😀' property [declaration]", ": operator []", "'ö' string []",
+				"b property [declaration]", ": operator []", "||| string []", "  😀 text string []", "||| string []",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := NewTree(context.Background(), tc.content)
+			require.NoError(t, err)
+
+			lines := strings.Split(tc.content, "\n")
+			var actual []string
+			for _, token := range SemanticTokens(root, tc.content) {
+				require.Equal(t, token.Range.Start.Line, token.Range.End.Line)
+				// Characters are UTF-16 code units
+				line := utf16.Encode([]rune(lines[token.Range.Start.Line]))
+				text := string(utf16.Decode(line[token.Range.Start.Character:token.Range.End.Character]))
+				actual = append(actual, fmt.Sprintf("%s %s %v", text, token.Type, token.Modifiers))
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
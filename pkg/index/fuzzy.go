@@ -0,0 +1,49 @@
+package index
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	fuzzyMatchScore       = 1
+	fuzzyConsecutiveBonus = 4
+	fuzzyWordStartBonus   = 8
+)
+
+// fuzzyScore matches the query as a case insensitive subsequence of the candidate.
+// Consecutive characters and characters at the start of a word (after `.`, `_` or a lower-to-upper case change)
+// score higher. Returns false if the candidate doesn't contain the query
+func fuzzyScore(query, candidate string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	score := 0
+	queryRunes := []rune(query)
+	matched := 0
+	lastMatch := -2
+	var prev rune
+	for i, r := range []rune(candidate) {
+		if matched == len(queryRunes) {
+			break
+		}
+		if unicode.ToLower(r) == unicode.ToLower(queryRunes[matched]) {
+			score += fuzzyMatchScore
+			if lastMatch == i-1 {
+				score += fuzzyConsecutiveBonus
+			}
+			if i == 0 || prev == '.' || prev == '_' || prev == '-' || (unicode.IsLower(prev) && unicode.IsUpper(r)) {
+				score += fuzzyWordStartBonus
+			}
+			lastMatch = i
+			matched++
+		}
+		prev = r
+	}
+	if matched != len(queryRunes) {
+		return 0, false
+	}
+	// Prefer shorter candidates for the same matches
+	return score*100 - utf8.RuneCountInString(candidate), true
+}
@@ -0,0 +1,358 @@
+package index
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Symbol is a definition of a file that can be used from other files
+type Symbol struct {
+	Name string
+	// Dotted path of the symbol inside its file. Fields are prefixed with the fields containing them, e.g. `api.v1.new`
+	Path           string
+	Kind           protocol.SymbolKind
+	Filename       string
+	Range          ast.LocationRange
+	SelectionRange ast.LocationRange
+}
+
+// ContainerName returns the path of the object containing the symbol
+func (s Symbol) ContainerName() string {
+	return strings.TrimSuffix(strings.TrimSuffix(s.Path, s.Name), ".")
+}
+
+type file struct {
+	symbols []Symbol
+	// All identifiers and strings used in the file. Files without an identifier can't reference it
+	identifiers map[string]struct{}
+	// The content on disk the entry was built from. Empty for open documents
+	stamp fileStamp
+	// False for entries loaded from disk that were not checked against the file yet
+	verified bool
+}
+
+// Index keeps the symbols of all jsonnet files of the workspace
+type Index struct {
+	mu    sync.RWMutex
+	files map[string]*file
+	ready atomic.Bool
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{
+		files: make(map[string]*file),
+	}
+}
+
+// Update replaces the entry of the file with the contents of the AST
+func (i *Index) Update(filename string, root ast.Node) {
+	i.update(filename, root, fileStamp{})
+}
+
+func (i *Index) update(filename string, root ast.Node, stamp fileStamp) {
+	entry := &file{
+		symbols:     collectSymbols(filename, root),
+		identifiers: collectIdentifiers(root),
+		stamp:       stamp,
+		verified:    true,
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.files[filename] = entry
+}
+
+// UpdateFile parses the file from disk and updates its entry
+func (i *Index) UpdateFile(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	return i.updateContent(filename, content, newFileStamp(info, content))
+}
+
+func (i *Index) updateContent(filename string, content []byte, stamp fileStamp) error {
+	root, err := jsonnet.SnippetToAST(filename, string(content))
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	i.update(filename, root, stamp)
+	return nil
+}
+
+// Refresh updates the entry of the file from disk unless it is still up to date.
+// Entries are up to date if the modification time and size or the hash of the content match the file
+func (i *Index) Refresh(filename string) error {
+	i.mu.RLock()
+	entry, ok := i.files[filename]
+	i.mu.RUnlock()
+	if ok && entry.verified {
+		return nil
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		i.Remove(filename)
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	if ok && entry.stamp.matchesInfo(info) {
+		i.markVerified(filename, entry.stamp)
+		return nil
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		i.Remove(filename)
+		return fmt.Errorf("reading %s: %w", filename, err)
+	}
+	stamp := newFileStamp(info, content)
+	if ok && entry.stamp.Hash == stamp.Hash {
+		// Only touched
+		i.markVerified(filename, stamp)
+		return nil
+	}
+	return i.updateContent(filename, content, stamp)
+}
+
+func (i *Index) markVerified(filename string, stamp fileStamp) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if entry, ok := i.files[filename]; ok {
+		entry.stamp = stamp
+		entry.verified = true
+	}
+}
+
+// refreshUnverified revalidates entries loaded from disk before they are used
+func (i *Index) refreshUnverified(filenames ...string) {
+	for _, filename := range filenames {
+		i.mu.RLock()
+		entry, ok := i.files[filename]
+		i.mu.RUnlock()
+		if !ok || entry.verified {
+			continue
+		}
+		if err := i.Refresh(filename); err != nil {
+			log.Debugf("Refreshing index entry: %v", err)
+		}
+	}
+}
+
+// Remove drops the file from the index
+func (i *Index) Remove(filename string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.files, filename)
+}
+
+// SetReady marks the initial indexing of the workspace as done
+func (i *Index) SetReady() {
+	i.ready.Store(true)
+}
+
+// Ready returns true once the whole workspace was indexed
+func (i *Index) Ready() bool {
+	return i.ready.Load()
+}
+
+// Contains returns true if the file is indexed
+func (i *Index) Contains(filename string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	_, ok := i.files[filename]
+	return ok
+}
+
+// Files returns all indexed files
+func (i *Index) Files() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return slices.Sorted(maps.Keys(i.files))
+}
+
+// HasIdentifier checks if the identifier is used in the file. Returns true for files that are not indexed
+func (i *Index) HasIdentifier(filename, identifier string) bool {
+	i.refreshUnverified(filename)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	entry, ok := i.files[filename]
+	if !ok {
+		return true
+	}
+	_, ok = entry.identifiers[identifier]
+	return ok
+}
+
+// Search returns up to limit symbols fuzzy matching the query, best matches first
+func (i *Index) Search(query string, limit int) []Symbol {
+	type match struct {
+		symbol Symbol
+		score  int
+	}
+	var matches []match
+
+	i.mu.RLock()
+	var unverified []string
+	for filename, entry := range i.files {
+		if !entry.verified {
+			unverified = append(unverified, filename)
+		}
+	}
+	i.mu.RUnlock()
+	i.refreshUnverified(unverified...)
+
+	i.mu.RLock()
+	for _, entry := range i.files {
+		for _, symbol := range entry.symbols {
+			nameScore, nameOk := fuzzyScore(query, symbol.Name)
+			pathScore, pathOk := fuzzyScore(query, symbol.Path)
+			if !nameOk && !pathOk {
+				continue
+			}
+			matches = append(matches, match{symbol: symbol, score: max(nameScore, pathScore)})
+		}
+	}
+	i.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(
+			cmp.Compare(b.score, a.score),
+			cmp.Compare(len(a.symbol.Path), len(b.symbol.Path)),
+			cmp.Compare(a.symbol.Path, b.symbol.Path),
+			cmp.Compare(a.symbol.Filename, b.symbol.Filename),
+		)
+	})
+
+	symbols := make([]Symbol, 0, min(len(matches), limit))
+	for _, m := range matches[:min(len(matches), limit)] {
+		symbols = append(symbols, m.symbol)
+	}
+	return symbols
+}
+
+func collectSymbols(filename string, root ast.Node) []Symbol {
+	var symbols []Symbol
+	var collectObject func(node ast.Node, prefix string)
+	collectObject = func(node ast.Node, prefix string) {
+		switch node := node.(type) {
+		case *ast.DesugaredObject:
+			processor := processing.NewProcessor(nil, nil)
+			for _, field := range node.Fields {
+				name, ok := field.Name.(*ast.LiteralString)
+				if !ok {
+					continue
+				}
+				path := name.Value
+				if prefix != "" {
+					path = prefix + "." + name.Value
+				}
+				kind := protocol.Field
+				if _, isFunction := field.Body.(*ast.Function); isFunction {
+					kind = protocol.Method
+				}
+				fieldRange := processor.FieldToRange(field)
+				symbols = append(symbols, Symbol{
+					Name:           name.Value,
+					Path:           path,
+					Kind:           kind,
+					Filename:       filename,
+					Range:          withoutSource(fieldRange.FullRange),
+					SelectionRange: withoutSource(fieldRange.SelectionRange),
+				})
+				collectObject(field.Body, path)
+			}
+		case *ast.Binary:
+			collectObject(node.Left, prefix)
+			collectObject(node.Right, prefix)
+		case *ast.Local:
+			collectObject(node.Body, prefix)
+		}
+	}
+
+	node := root
+	for node != nil {
+		switch current := node.(type) {
+		case *ast.Local:
+			for _, bind := range current.Binds {
+				kind := protocol.Variable
+				if _, isFunction := bind.Body.(*ast.Function); isFunction {
+					kind = protocol.Function
+				}
+				bindRange := processing.LocalBindToRange(bind)
+				symbols = append(symbols, Symbol{
+					Name:           string(bind.Variable),
+					Path:           string(bind.Variable),
+					Kind:           kind,
+					Filename:       filename,
+					Range:          withoutSource(bindRange.FullRange),
+					SelectionRange: withoutSource(bindRange.SelectionRange),
+				})
+			}
+			node = current.Body
+		case *ast.Function:
+			// Libraries taking a config at the root still export the fields of the returned object
+			node = current.Body
+		default:
+			collectObject(node, "")
+			node = nil
+		}
+	}
+	return symbols
+}
+
+// withoutSource drops the reference to the source of the file. Symbols outlive the AST and are persisted
+func withoutSource(locRange ast.LocationRange) ast.LocationRange {
+	locRange.File = nil
+	return locRange
+}
+
+func collectIdentifiers(root ast.Node) map[string]struct{} {
+	identifiers := map[string]struct{}{}
+	if root == nil {
+		return identifiers
+	}
+	for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+		switch node := node.(type) {
+		case *ast.Var:
+			identifiers[string(node.Id)] = struct{}{}
+		case *ast.LiteralString:
+			identifiers[node.Value] = struct{}{}
+		case *ast.Local:
+			for _, bind := range node.Binds {
+				identifiers[string(bind.Variable)] = struct{}{}
+			}
+		case *ast.DesugaredObject:
+			for _, bind := range node.Locals {
+				identifiers[string(bind.Variable)] = struct{}{}
+			}
+		case *ast.Function:
+			for _, param := range node.Parameters {
+				identifiers[string(param.Name)] = struct{}{}
+			}
+		case *ast.Apply:
+			for _, arg := range node.Arguments.Named {
+				identifiers[string(arg.Name)] = struct{}{}
+			}
+		}
+	}
+	return identifiers
+}
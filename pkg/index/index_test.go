@@ -0,0 +1,113 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFile = `local helper(x) = x;
+local version = 'v1';
+{
+  api:: {
+    v1:: {
+      new(name):: { name: name },
+      withReplicas(replicas):: { replicas: replicas },
+    },
+  },
+  [version]: helper(true),
+}
+`
+
+func newTestIndex(t *testing.T) *Index {
+	t.Helper()
+
+	root, err := jsonnet.SnippetToAST("/lib.libsonnet", testFile)
+	require.NoError(t, err)
+	index := New()
+	index.Update("/lib.libsonnet", root)
+	return index
+}
+
+func TestSymbols(t *testing.T) {
+	index := newTestIndex(t)
+
+	type symbol struct {
+		path      string
+		kind      protocol.SymbolKind
+		container string
+	}
+	var symbols []symbol
+	for _, s := range index.Search("", 100) {
+		symbols = append(symbols, symbol{path: s.Path, kind: s.Kind, container: s.ContainerName()})
+	}
+	assert.ElementsMatch(t, []symbol{
+		{path: "helper", kind: protocol.Function},
+		{path: "version", kind: protocol.Variable},
+		{path: "api", kind: protocol.Field},
+		{path: "api.v1", kind: protocol.Field, container: "api"},
+		{path: "api.v1.new", kind: protocol.Method, container: "api.v1"},
+		{path: "api.v1.withReplicas", kind: protocol.Method, container: "api.v1"},
+	}, symbols)
+}
+
+func TestSearch(t *testing.T) {
+	index := newTestIndex(t)
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "exact name",
+			query:    "new",
+			expected: []string{"api.v1.new"},
+		},
+		{
+			name:     "case insensitive word starts",
+			query:    "wr",
+			expected: []string{"api.v1.withReplicas"},
+		},
+		{
+			name:     "dotted path",
+			query:    "v1new",
+			expected: []string{"api.v1.new"},
+		},
+		{
+			name:     "prefix ranks first",
+			query:    "ap",
+			expected: []string{"api", "api.v1", "api.v1.new", "api.v1.withReplicas"},
+		},
+		{
+			name:  "no match",
+			query: "xyz",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var paths []string
+			for _, symbol := range index.Search(tc.query, 100) {
+				paths = append(paths, symbol.Path)
+			}
+			assert.Equal(t, tc.expected, paths)
+		})
+	}
+}
+
+func TestHasIdentifier(t *testing.T) {
+	index := newTestIndex(t)
+
+	assert.True(t, index.HasIdentifier("/lib.libsonnet", "replicas"))
+	assert.True(t, index.HasIdentifier("/lib.libsonnet", "helper"))
+	assert.True(t, index.HasIdentifier("/lib.libsonnet", "name"))
+	assert.False(t, index.HasIdentifier("/lib.libsonnet", "unknown"))
+	// Files that are not indexed might contain anything
+	assert.True(t, index.HasIdentifier("/other.libsonnet", "unknown"))
+
+	index.Remove("/lib.libsonnet")
+	assert.False(t, index.Contains("/lib.libsonnet"))
+}
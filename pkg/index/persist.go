@@ -0,0 +1,133 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bump when the persisted format or the collected data changes. Indexes of other versions are discarded
+const persistVersion = 1
+
+// fileStamp identifies the content of a file
+type fileStamp struct {
+	ModTime time.Time
+	Size    int64
+	Hash    string
+}
+
+func newFileStamp(info fs.FileInfo, content []byte) fileStamp {
+	hash := sha256.Sum256(content)
+	return fileStamp{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Hash:    hex.EncodeToString(hash[:]),
+	}
+}
+
+func (s fileStamp) matchesInfo(info fs.FileInfo) bool {
+	return s.Hash != "" && s.ModTime.Equal(info.ModTime()) && s.Size == info.Size()
+}
+
+type persistedFile struct {
+	Stamp       fileStamp
+	Symbols     []Symbol
+	Identifiers []string
+}
+
+type persistedIndex struct {
+	Version int
+	Files   map[string]persistedFile
+}
+
+// Save writes all entries built from files on disk to path
+func (i *Index) Save(path string) error {
+	persisted := persistedIndex{
+		Version: persistVersion,
+		Files:   make(map[string]persistedFile),
+	}
+	i.mu.RLock()
+	for filename, entry := range i.files {
+		if entry.stamp.Hash == "" {
+			// Open documents might not match the file on disk
+			continue
+		}
+		identifiers := make([]string, 0, len(entry.identifiers))
+		for identifier := range entry.identifiers {
+			identifiers = append(identifiers, identifier)
+		}
+		persisted.Files[filename] = persistedFile{
+			Stamp:       entry.stamp,
+			Symbols:     entry.symbols,
+			Identifiers: identifiers,
+		}
+	}
+	i.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating index directory: %w", err)
+	}
+	// Write to a temporary file first to never leave a partially written index behind
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating index file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := gob.NewEncoder(tmpFile).Encode(persisted); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("encoding index: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("writing index: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("writing index: %w", err)
+	}
+	return nil
+}
+
+// Load adds the entries saved at path to the index. Existing entries are kept.
+// Loaded entries are revalidated against the files once they are used
+func (i *Index) Load(path string) error {
+	indexFile, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening index: %w", err)
+	}
+	defer indexFile.Close()
+
+	var persisted persistedIndex
+	if err := gob.NewDecoder(indexFile).Decode(&persisted); err != nil {
+		return fmt.Errorf("decoding index: %w", err)
+	}
+	if persisted.Version != persistVersion {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for filename, persistedEntry := range persisted.Files {
+		if _, ok := i.files[filename]; ok {
+			continue
+		}
+		identifiers := make(map[string]struct{}, len(persistedEntry.Identifiers))
+		for _, identifier := range persistedEntry.Identifiers {
+			identifiers[identifier] = struct{}{}
+		}
+		i.files[filename] = &file{
+			symbols:     persistedEntry.Symbols,
+			identifiers: identifiers,
+			stamp:       persistedEntry.Stamp,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchPaths(index *Index, query string) []string {
+	var paths []string
+	for _, symbol := range index.Search(query, 100) {
+		paths = append(paths, symbol.Path)
+	}
+	return paths
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	libFile := filepath.Join(dir, "lib.libsonnet")
+	require.NoError(t, os.WriteFile(libFile, []byte(testFile), 0o600))
+	indexFile := filepath.Join(dir, "cache", "index.gob")
+
+	index := New()
+	require.NoError(t, index.Refresh(libFile))
+	// Open documents are not persisted
+	index.Update(filepath.Join(dir, "open.jsonnet"), nil)
+	require.NoError(t, index.Save(indexFile))
+
+	loaded := New()
+	require.NoError(t, loaded.Load(indexFile))
+	assert.True(t, loaded.Contains(libFile))
+	assert.False(t, loaded.Contains(filepath.Join(dir, "open.jsonnet")))
+	assert.Equal(t, []string{"api.v1.withReplicas"}, searchPaths(loaded, "withReplicas"))
+	assert.True(t, loaded.HasIdentifier(libFile, "replicas"))
+	assert.False(t, loaded.HasIdentifier(libFile, "unknown"))
+
+	// Loading a missing index is not an error
+	require.NoError(t, New().Load(filepath.Join(dir, "missing.gob")))
+}
+
+func TestLoadRevalidates(t *testing.T) {
+	dir := t.TempDir()
+	libFile := filepath.Join(dir, "lib.libsonnet")
+	require.NoError(t, os.WriteFile(libFile, []byte(testFile), 0o600))
+	indexFile := filepath.Join(dir, "index.gob")
+
+	index := New()
+	require.NoError(t, index.Refresh(libFile))
+	require.NoError(t, index.Save(indexFile))
+
+	// Change the file while the server is not running
+	require.NoError(t, os.WriteFile(libFile, []byte("{ changed: 'unknown' }"), 0o600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(libFile, modTime, modTime))
+
+	loaded := New()
+	require.NoError(t, loaded.Load(indexFile))
+	assert.True(t, loaded.HasIdentifier(libFile, "unknown"))
+	assert.Equal(t, []string{"changed"}, searchPaths(loaded, "changed"))
+	assert.Empty(t, searchPaths(loaded, "withReplicas"))
+
+	// Deleted files are dropped
+	require.NoError(t, loaded.Save(indexFile))
+	require.NoError(t, os.Remove(libFile))
+	loaded = New()
+	require.NoError(t, loaded.Load(indexFile))
+	assert.Empty(t, searchPaths(loaded, "changed"))
+	assert.False(t, loaded.Contains(libFile))
+}
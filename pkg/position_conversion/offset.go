@@ -0,0 +1,56 @@
+package position
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// ProtocolToOffset converts a protocol position into a byte offset of text.
+// The character of a protocol position is counted in UTF-16 code units. Characters past the end of
+// a line are clamped to the end of that line, as required by the LSP spec.
+func ProtocolToOffset(text string, pos protocol.Position) (int, error) {
+	offset := 0
+	for line := uint32(0); line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return 0, fmt.Errorf("line %d out of range", pos.Line)
+		}
+		offset += next + 1
+	}
+
+	var units uint32
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += uint32(utf16Len(r))
+		offset += size
+	}
+	return offset, nil
+}
+
+// OffsetToProtocol converts a byte offset of text into a protocol position counted in UTF-16 code units.
+func OffsetToProtocol(text string, offset int) protocol.Position {
+	offset = min(max(offset, 0), len(text))
+	pos := protocol.Position{}
+	for _, r := range text[:offset] {
+		if r == '\n' {
+			pos.Line++
+			pos.Character = 0
+			continue
+		}
+		pos.Character += uint32(utf16Len(r))
+	}
+	return pos
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
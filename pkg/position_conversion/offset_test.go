@@ -0,0 +1,36 @@
+package position
+
+import (
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolToOffset(t *testing.T) {
+	text := "local a = 'ä';\nlocal b = '😀';\n{}"
+	testCases := []struct {
+		name     string
+		pos      protocol.Position
+		expected int
+	}{
+		{name: "start", pos: protocol.Position{Line: 0, Character: 0}, expected: 0},
+		{name: "after two byte rune", pos: protocol.Position{Line: 0, Character: 12}, expected: 13},
+		{name: "second line", pos: protocol.Position{Line: 1, Character: 0}, expected: 16},
+		{name: "after surrogate pair", pos: protocol.Position{Line: 1, Character: 13}, expected: 31},
+		{name: "past line end is clamped", pos: protocol.Position{Line: 1, Character: 100}, expected: 33},
+		{name: "end of document", pos: protocol.Position{Line: 2, Character: 2}, expected: len(text)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			offset, err := ProtocolToOffset(text, tc.pos)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, offset)
+			assert.Equal(t, tc.pos.Line, OffsetToProtocol(text, offset).Line)
+		})
+	}
+
+	_, err := ProtocolToOffset(text, protocol.Position{Line: 5})
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+var namedArgumentRegexp = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*=\s*$`)
+
+// callArgument is an argument of a function call
+type callArgument struct {
+	// Empty for positional arguments
+	name string
+	// Index of the parameter in the declaration of the function
+	paramIndex int
+	// Offsets of the argument including its name
+	start, end int
+	exprText   string
+}
+
+// callArguments are the arguments of a function call in the order they are written
+type callArguments struct {
+	params []ast.Identifier
+	args   []callArgument
+}
+
+func (s *Server) callArgumentActions(doc *cache.Document, pos protocol.Position) []protocol.CodeAction {
+	call, err := s.findCallArguments(doc, pos)
+	if err != nil {
+		return nil
+	}
+	newAction := func(title, fix string) protocol.CodeAction {
+		return protocol.CodeAction{
+			Title: title,
+			Kind:  protocol.RefactorRewrite,
+			Data: codeActionData{
+				Fix:   fix,
+				URI:   doc.Item.URI,
+				Range: protocol.Range{Start: pos, End: pos},
+			},
+		}
+	}
+
+	var actions []protocol.CodeAction
+	if call.hasPositional() {
+		actions = append(actions, newAction("Convert to named arguments", fixNamedArguments))
+	}
+	if call.hasNamed() && call.canBePositional() {
+		actions = append(actions, newAction("Convert to positional arguments", fixPositionalArguments))
+	}
+	if !call.inDeclarationOrder() && !call.hasPositional() {
+		actions = append(actions, newAction("Reorder named arguments", fixReorderArguments))
+	}
+	return actions
+}
+
+func (s *Server) callArgumentEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	call, err := s.findCallArguments(doc, data.Range.Start)
+	if err != nil {
+		return nil, err
+	}
+	if data.Fix == fixPositionalArguments && !call.canBePositional() {
+		return nil, fmt.Errorf("arguments can't be positional")
+	}
+
+	ordered := slices.Clone(call.args)
+	slices.SortStableFunc(ordered, func(a, b callArgument) int { return cmp.Compare(a.paramIndex, b.paramIndex) })
+
+	var edits []protocol.TextEdit
+	text := doc.Item.Text
+	// The arguments are written into the places of the existing ones to keep the formatting
+	for i, slot := range call.args {
+		arg := ordered[i]
+		newText := arg.exprText
+		switch {
+		case data.Fix == fixNamedArguments,
+			data.Fix == fixReorderArguments && arg.name != "":
+			newText = fmt.Sprintf("%s=%s", call.params[arg.paramIndex], arg.exprText)
+		}
+		if newText == text[slot.start:slot.end] {
+			continue
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: position.OffsetToProtocol(text, slot.start),
+				End:   position.OffsetToProtocol(text, slot.end),
+			},
+			NewText: newText,
+		})
+	}
+	return edits, nil
+}
+
+// findCallArguments returns the arguments of the innermost function call at the position
+func (s *Server) findCallArguments(doc *cache.Document, pos protocol.Position) (*callArguments, error) {
+	if doc.AST == nil {
+		return nil, fmt.Errorf("%s", errorParsingDocument)
+	}
+	stack, err := processing.FindNodeByPosition(doc.AST, position.ProtocolToAST(pos))
+	if err != nil {
+		return nil, err
+	}
+	var apply *ast.Apply
+	for i := len(stack.Stack) - 1; i >= 0 && apply == nil; i-- {
+		// Desugared operators like `%` are calls without a location
+		if node, ok := stack.Stack[i].(*ast.Apply); ok && node.Target.Loc().Begin.IsSet() {
+			apply = node
+		}
+	}
+	if apply == nil {
+		return nil, fmt.Errorf("no function call at %v", pos)
+	}
+	if len(apply.Arguments.Positional)+len(apply.Arguments.Named) == 0 {
+		return nil, fmt.Errorf("function call has no arguments")
+	}
+
+	function, err := s.getFunctionCallTarget(doc.AST, apply.Target, doc.Item.URI)
+	if err != nil {
+		return nil, err
+	}
+	call := &callArguments{}
+	for _, param := range function.Parameters {
+		call.params = append(call.params, param.Name)
+	}
+	if len(apply.Arguments.Positional) > len(call.params) {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	text := doc.Item.Text
+	exprOffsets := func(expr ast.Node) (int, int, error) {
+		if !expr.Loc().Begin.IsSet() {
+			return 0, 0, fmt.Errorf("argument has no location")
+		}
+		start, err := position.ProtocolToOffset(text, position.ASTToProtocol(expr.Loc().Begin))
+		if err != nil {
+			return 0, 0, err
+		}
+		end, err := position.ProtocolToOffset(text, position.ASTToProtocol(expr.Loc().End))
+		return start, end, err
+	}
+	for i, arg := range apply.Arguments.Positional {
+		start, end, err := exprOffsets(arg.Expr)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, callArgument{paramIndex: i, start: start, end: end, exprText: text[start:end]})
+	}
+	for _, arg := range apply.Arguments.Named {
+		start, end, err := exprOffsets(arg.Arg)
+		if err != nil {
+			return nil, err
+		}
+		paramIndex := slices.Index(call.params, arg.Name)
+		if paramIndex < 0 {
+			return nil, fmt.Errorf("unknown parameter %s", arg.Name)
+		}
+		match := namedArgumentRegexp.FindStringSubmatchIndex(text[:start])
+		if match == nil || text[match[2]:match[3]] != string(arg.Name) {
+			return nil, fmt.Errorf("unable to find name of argument %s", arg.Name)
+		}
+		call.args = append(call.args, callArgument{name: string(arg.Name), paramIndex: paramIndex, start: match[0], end: end, exprText: text[start:end]})
+	}
+	return call, nil
+}
+
+func (c *callArguments) hasPositional() bool {
+	return slices.ContainsFunc(c.args, func(arg callArgument) bool { return arg.name == "" })
+}
+
+func (c *callArguments) hasNamed() bool {
+	return slices.ContainsFunc(c.args, func(arg callArgument) bool { return arg.name != "" })
+}
+
+func (c *callArguments) inDeclarationOrder() bool {
+	return slices.IsSortedFunc(c.args, func(a, b callArgument) int { return cmp.Compare(a.paramIndex, b.paramIndex) })
+}
+
+// canBePositional checks if the arguments cover the first parameters without a gap. Skipped parameters need a name
+func (c *callArguments) canBePositional() bool {
+	for i := range c.args {
+		if !slices.ContainsFunc(c.args, func(arg callArgument) bool { return arg.paramIndex == i }) {
+			return false
+		}
+	}
+	return true
+}
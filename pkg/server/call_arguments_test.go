@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallArguments(t *testing.T) {
+	const function = "local f(x, name, enabled=false) = x;\n"
+	testCases := []struct {
+		name        string
+		fileContent string
+		cursorAt    string
+		// Title of the action to expected document
+		expected map[string]string
+	}{
+		{
+			name:        "positional to named",
+			fileContent: function + "f(1, 'a', true)\n",
+			cursorAt:    "f(1",
+			expected: map[string]string{
+				"Convert to named arguments": function + "f(x=1, name='a', enabled=true)\n",
+			},
+		},
+		{
+			name:        "named to positional and reordered",
+			fileContent: function + "f(enabled=true, x=1, name='a')\n",
+			cursorAt:    "f(en",
+			expected: map[string]string{
+				"Convert to positional arguments": function + "f(1, 'a', true)\n",
+				"Reorder named arguments":         function + "f(x=1, name='a', enabled=true)\n",
+			},
+		},
+		{
+			name:        "mixed",
+			fileContent: function + "f(1, enabled=true)\n",
+			cursorAt:    "f(1",
+			expected: map[string]string{
+				"Convert to named arguments": function + "f(x=1, enabled=true)\n",
+			},
+		},
+		{
+			name:        "multiline formatting is kept",
+			fileContent: function + "f(\n  name='a',\n  x=1,\n)\n",
+			cursorAt:    "f(\n",
+			expected: map[string]string{
+				"Convert to positional arguments": function + "f(\n  1,\n  'a',\n)\n",
+				"Reorder named arguments":         function + "f(\n  x=1,\n  name='a',\n)\n",
+			},
+		},
+		{
+			name:        "innermost call",
+			fileContent: function + "f(1, f(2, 'b'))\n",
+			cursorAt:    "f(2",
+			expected: map[string]string{
+				"Convert to named arguments": function + "f(1, f(x=2, name='b'))\n",
+			},
+		},
+		{
+			name:        "std function",
+			fileContent: "std.substr('abc', 0, 1)\n",
+			cursorAt:    "substr",
+			expected: map[string]string{
+				"Convert to named arguments": "std.substr(str='abc', from=0, len=1)\n",
+			},
+		},
+		{
+			name:        "too many arguments",
+			fileContent: function + "f(1, 2, 3, 4)\n",
+			cursorAt:    "f(1",
+			expected:    map[string]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, []stdlib.Function{{Name: "substr", Params: []string{"str", "from", "len"}}}, tc.fileContent)
+			assertCallArgumentActions(t, server, fileURI, tc.fileContent, tc.cursorAt, tc.expected)
+		})
+	}
+}
+
+func TestCallArgumentsImported(t *testing.T) {
+	server := testServer(t, nil)
+	fileURI, content := newTestFixture(t, "call-arguments").open(t, server, "main.jsonnet")
+	assertCallArgumentActions(t, server, fileURI, content, "new", map[string]string{
+		"Convert to named arguments": "local lib = import 'lib.libsonnet';\nlib.new(name='a', replicas=3)\n",
+	})
+}
+
+func assertCallArgumentActions(t *testing.T, server *Server, fileURI protocol.DocumentURI, content, cursorAt string, expected map[string]string) {
+	t.Helper()
+	params := &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Range:        rangeOf(t, content, cursorAt),
+		Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorRewrite}},
+	}
+	params.Range.End = params.Range.Start
+	actions, err := server.CodeAction(context.Background(), params)
+	require.NoError(t, err)
+
+	results := map[string]string{}
+	for _, action := range actions {
+		assert.Equal(t, protocol.RefactorRewrite, action.Kind)
+		results[action.Title] = applyTextEdits(t, content, action.Edit.Changes[fileURI])
+	}
+	assert.Equal(t, expected, results)
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) PrepareCallHierarchy(_ context.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareCallHierarchy: %s: %w", errorRetrievingDocument, err)
+	}
+	if doc.AST == nil {
+		log.Errorf("PrepareCallHierarchy: %s", errorParsingDocument)
+		return nil, nil
+	}
+
+	location := position.ProtocolToAST(params.Position)
+	if item, ok := declarationItem(doc.AST, doc.Item.URI, location); ok {
+		if item.Kind != protocol.Function && item.Kind != protocol.Method {
+			return nil, nil
+		}
+		return []protocol.CallHierarchyItem{item}, nil
+	}
+
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareCallHierarchy: %w", err)
+	}
+	for _, node := range stack.Stack {
+		apply, ok := node.(*ast.Apply)
+		if !ok || !apply.Target.Loc().Begin.IsSet() || !processing.InRange(location, *apply.Target.Loc()) {
+			continue
+		}
+		item, err := s.calleeItem(doc.AST, apply.Target, doc.Item.URI)
+		if err != nil {
+			log.Debugf("PrepareCallHierarchy: %v", err)
+			return nil, nil
+		}
+		return []protocol.CallHierarchyItem{item}, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) OutgoingCalls(_ context.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
+	_, root, err := s.getAst(params.Item.URI.SpanURI().Filename(), "")
+	if err != nil {
+		return nil, utils.LogErrorf("OutgoingCalls: getting ast: %w", err)
+	}
+	body := declarationBody(root, position.ProtocolToAST(params.Item.SelectionRange.Start))
+
+	var calls []protocol.CallHierarchyOutgoingCall
+	for _, node := range nodetree.BuildTree(nil, body).GetAllChildren() {
+		apply, ok := node.(*ast.Apply)
+		if !ok || !apply.Target.Loc().Begin.IsSet() {
+			// Desugared operators, e.g. `%`
+			continue
+		}
+		callee, err := s.calleeItem(root, apply.Target, params.Item.URI)
+		if err != nil {
+			// e.g. functions of the standard library
+			log.Debugf("OutgoingCalls: %v", err)
+			continue
+		}
+		fromRange := position.RangeASTToProtocol(*apply.Target.Loc())
+		found := false
+		for i := range calls {
+			if sameItem(calls[i].To, callee) {
+				calls[i].FromRanges = append(calls[i].FromRanges, fromRange)
+				found = true
+			}
+		}
+		if !found {
+			calls = append(calls, protocol.CallHierarchyOutgoingCall{To: callee, FromRanges: []protocol.Range{fromRange}})
+		}
+	}
+	return calls, nil
+}
+
+func (s *Server) IncomingCalls(_ context.Context, params *protocol.CallHierarchyIncomingCallsParams) ([]protocol.CallHierarchyIncomingCall, error) {
+	files, err := s.workspaceFiles(params.Item.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("IncomingCalls: %w", err)
+	}
+
+	var calls []protocol.CallHierarchyIncomingCall
+	for _, filename := range files {
+		if params.Item.Kind != protocol.File && !s.mayUseIdentifier(filename, params.Item.Name) {
+			// Reading and parsing every file is slow. Skip the ones that can't call the function
+			continue
+		}
+		_, root, err := s.getAst(filename, "")
+		if err != nil {
+			log.Debugf("IncomingCalls: getting ast for %s: %v", filename, err)
+			continue
+		}
+		uri := protocol.URIFromPath(filename)
+		for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+			apply, ok := node.(*ast.Apply)
+			if !ok || !apply.Target.Loc().Begin.IsSet() {
+				continue
+			}
+			if name, _ := calleeName(apply.Target); name != params.Item.Name {
+				continue
+			}
+			callee, err := s.calleeItem(root, apply.Target, uri)
+			if err != nil || !sameItem(callee, params.Item) {
+				continue
+			}
+
+			caller := enclosingItem(root, uri, apply)
+			fromRange := position.RangeASTToProtocol(*apply.Target.Loc())
+			found := false
+			for i := range calls {
+				if sameItem(calls[i].From, caller) {
+					calls[i].FromRanges = append(calls[i].FromRanges, fromRange)
+					found = true
+				}
+			}
+			if !found {
+				calls = append(calls, protocol.CallHierarchyIncomingCall{From: caller, FromRanges: []protocol.Range{fromRange}})
+			}
+		}
+	}
+	return calls, nil
+}
+
+// calleeItem returns the item of the function called by target
+func (s *Server) calleeItem(root ast.Node, target ast.Node, uri protocol.DocumentURI) (protocol.CallHierarchyItem, error) {
+	function, link, err := s.findFunctionDefinition(root, target, uri)
+	if err != nil {
+		return protocol.CallHierarchyItem{}, fmt.Errorf("resolving call of %s: %w", target.Loc().String(), err)
+	}
+	name, kind := calleeName(target)
+	return callHierarchyItem(name, kind, link.TargetURI, link.TargetRange, link.TargetSelectionRange, function), nil
+}
+
+// calleeName returns the name of the called function: the variable, the last index or the imported file
+func calleeName(target ast.Node) (string, protocol.SymbolKind) {
+	switch target := target.(type) {
+	case *ast.Var:
+		return string(target.Id), protocol.Function
+	case *ast.Index:
+		if index, ok := target.Index.(*ast.LiteralString); ok {
+			return index.Value, protocol.Method
+		}
+	case *ast.Import:
+		return filepath.Base(target.File.Value), protocol.File
+	}
+	return "<function>", protocol.Function
+}
+
+// declarationItem returns the item of the local or field whose name is at the location
+func declarationItem(root ast.Node, uri protocol.DocumentURI, location ast.Location) (protocol.CallHierarchyItem, bool) {
+	stack, err := processing.FindNodeByPosition(root, location)
+	if err != nil {
+		return protocol.CallHierarchyItem{}, false
+	}
+	if bind, _ := bindAtName(stack, location); bind != nil {
+		return bindItem(uri, *bind), true
+	}
+	if field, _ := fieldAtName(stack, location); field != nil {
+		return fieldItem(uri, *field), true
+	}
+	return protocol.CallHierarchyItem{}, false
+}
+
+// declarationBody returns the body of the local or field whose name is at the location. The whole file if there is none
+func declarationBody(root ast.Node, location ast.Location) ast.Node {
+	stack, err := processing.FindNodeByPosition(root, location)
+	if err != nil {
+		return root
+	}
+	if bind, _ := bindAtName(stack, location); bind != nil {
+		return bind.Body
+	}
+	if field, _ := fieldAtName(stack, location); field != nil {
+		return field.Body
+	}
+	return root
+}
+
+// enclosingItem returns the item of the innermost local or field containing the node. The file if there is none
+func enclosingItem(root ast.Node, uri protocol.DocumentURI, node ast.Node) protocol.CallHierarchyItem {
+	path := processing.NodePath(root, node)
+	for i := len(path) - 2; i >= 0; i-- {
+		var binds ast.LocalBinds
+		switch node := path[i].(type) {
+		case *ast.DesugaredObject:
+			for _, field := range node.Fields {
+				if _, ok := field.Name.(*ast.LiteralString); ok && field.Body == path[i+1] && field.LocRange.Begin.IsSet() {
+					return fieldItem(uri, field)
+				}
+			}
+			binds = node.Locals
+		case *ast.Local:
+			binds = node.Binds
+		}
+		for _, bind := range binds {
+			if begin := bindNameLocation(bind); bind.Body == path[i+1] && begin.IsSet() {
+				return bindItem(uri, bind)
+			}
+		}
+	}
+	return fileItem(root, uri)
+}
+
+// fileItem returns the item of a whole file
+func fileItem(root ast.Node, uri protocol.DocumentURI) protocol.CallHierarchyItem {
+	fileRange := position.RangeASTToProtocol(*root.Loc())
+	return protocol.CallHierarchyItem{
+		Name:           filepath.Base(uri.SpanURI().Filename()),
+		Kind:           protocol.File,
+		URI:            uri,
+		Range:          fileRange,
+		SelectionRange: protocol.Range{Start: fileRange.Start, End: fileRange.Start},
+	}
+}
+
+func bindItem(uri protocol.DocumentURI, bind ast.LocalBind) protocol.CallHierarchyItem {
+	objectRange := processing.LocalBindToRange(bind)
+	kind := protocol.Variable
+	if _, ok := bind.Body.(*ast.Function); ok {
+		kind = protocol.Function
+	}
+	return callHierarchyItem(string(bind.Variable), kind, uri, position.RangeASTToProtocol(objectRange.FullRange), position.RangeASTToProtocol(objectRange.SelectionRange), bind.Body)
+}
+
+func fieldItem(uri protocol.DocumentURI, field ast.DesugaredObjectField) protocol.CallHierarchyItem {
+	objectRange := processing.NewProcessor(nil, nil).FieldToRange(field)
+	kind := protocol.Field
+	if _, ok := field.Body.(*ast.Function); ok {
+		kind = protocol.Method
+	}
+	return callHierarchyItem(objectRange.FieldName, kind, uri, position.RangeASTToProtocol(objectRange.FullRange), position.RangeASTToProtocol(objectRange.SelectionRange), field.Body)
+}
+
+// callHierarchyItem creates an item. The signature is added for functions
+func callHierarchyItem(name string, kind protocol.SymbolKind, uri protocol.DocumentURI, fullRange, selectionRange protocol.Range, body ast.Node) protocol.CallHierarchyItem {
+	item := protocol.CallHierarchyItem{
+		Name:           name,
+		Kind:           kind,
+		URI:            uri,
+		Range:          fullRange,
+		SelectionRange: selectionRange,
+	}
+	if function, ok := body.(*ast.Function); ok {
+		var params []string
+		for _, param := range function.Parameters {
+			params = append(params, string(param.Name))
+		}
+		item.Detail = fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+	}
+	return item
+}
+
+// sameItem checks if both items refer to the same definition
+func sameItem(a, b protocol.CallHierarchyItem) bool {
+	return a.URI.SpanURI().Filename() == b.URI.SpanURI().Filename() && a.Range.Start == b.Range.Start
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func prepareCallHierarchy(t *testing.T, server *Server, uri protocol.DocumentURI, content, cursorAt string) []protocol.CallHierarchyItem {
+	t.Helper()
+	items, err := server.PrepareCallHierarchy(context.Background(), &protocol.CallHierarchyPrepareParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     rangeOf(t, content, cursorAt).Start,
+		},
+	})
+	require.NoError(t, err)
+	return items
+}
+
+func TestPrepareCallHierarchy(t *testing.T) {
+	testCases := []struct {
+		name           string
+		inLib          bool
+		cursorAt       string
+		expectedName   string
+		expectedKind   protocol.SymbolKind
+		expectedDetail string
+		expectedInLib  bool
+	}{
+		{
+			name:           "local function declaration",
+			cursorAt:       "f(a)",
+			expectedName:   "f",
+			expectedKind:   protocol.Function,
+			expectedDetail: "f(a)",
+		},
+		{
+			name:           "method declaration",
+			inLib:          true,
+			cursorAt:       "twice",
+			expectedName:   "twice",
+			expectedKind:   protocol.Method,
+			expectedDetail: "twice(x)",
+			expectedInLib:  true,
+		},
+		{
+			name:           "call of a local function",
+			cursorAt:       "f(1)",
+			expectedName:   "f",
+			expectedKind:   protocol.Function,
+			expectedDetail: "f(a)",
+		},
+		{
+			name:           "call of an imported method",
+			cursorAt:       "new(a)",
+			expectedName:   "new",
+			expectedKind:   protocol.Method,
+			expectedDetail: "new(x)",
+			expectedInLib:  true,
+		},
+		{
+			name:     "local without function",
+			cursorAt: "lib =",
+		},
+		{
+			name:     "stdlib",
+			cursorAt: "length",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			fixture := newTestFixture(t, "call-hierarchy")
+			libURI, libContent := fixture.open(t, server, "lib.libsonnet")
+			mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+			uri, content := mainURI, mainContent
+			if tc.inLib {
+				uri, content = libURI, libContent
+			}
+
+			items := prepareCallHierarchy(t, server, uri, content, tc.cursorAt)
+			if tc.expectedName == "" {
+				assert.Empty(t, items)
+				return
+			}
+			require.Len(t, items, 1)
+			assert.Equal(t, tc.expectedName, items[0].Name)
+			assert.Equal(t, tc.expectedKind, items[0].Kind)
+			assert.Equal(t, tc.expectedDetail, items[0].Detail)
+			expectedURI := mainURI
+			if tc.expectedInLib {
+				expectedURI = libURI
+			}
+			assert.Equal(t, expectedURI.SpanURI().Filename(), items[0].URI.SpanURI().Filename())
+		})
+	}
+}
+
+func TestIncomingCalls(t *testing.T) {
+	server := testServer(t, nil)
+	fixture := newTestFixture(t, "call-hierarchy")
+	libURI, libContent := fixture.open(t, server, "lib.libsonnet")
+	fixture.open(t, server, "main.jsonnet")
+	items := prepareCallHierarchy(t, server, libURI, libContent, "new(x)")
+	require.Len(t, items, 1)
+
+	calls, err := server.IncomingCalls(context.Background(), &protocol.CallHierarchyIncomingCallsParams{Item: items[0]})
+	require.NoError(t, err)
+
+	callers := map[string]int{}
+	for _, call := range calls {
+		callers[filepath.Base(call.From.URI.SpanURI().Filename())+":"+call.From.Name] = len(call.FromRanges)
+	}
+	assert.Equal(t, map[string]int{
+		"lib.libsonnet:twice": 2,
+		"main.jsonnet:f":      1,
+	}, callers)
+}
+
+func TestOutgoingCalls(t *testing.T) {
+	server := testServer(t, nil)
+	fixture := newTestFixture(t, "call-hierarchy")
+	libURI, _ := fixture.open(t, server, "lib.libsonnet")
+	mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+	items := prepareCallHierarchy(t, server, mainURI, mainContent, "f(a)")
+	require.Len(t, items, 1)
+
+	calls, err := server.OutgoingCalls(context.Background(), &protocol.CallHierarchyOutgoingCallsParams{Item: items[0]})
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "new", calls[0].To.Name)
+	assert.Equal(t, libURI.SpanURI().Filename(), calls[0].To.URI.SpanURI().Filename())
+	assert.Equal(t, []protocol.Range{rangeOf(t, mainContent, "lib.new")}, calls[0].FromRanges)
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	fixRemoveUnusedVariable = "removeUnusedVariable"
+	fixReplaceField         = "replaceField"
+	fixAddImport            = "addImport"
+	fixExtractLocal         = "extractLocal"
+	fixInlineLocal          = "inlineLocal"
+	fixNamedArguments       = "namedArguments"
+	fixPositionalArguments  = "positionalArguments"
+	fixReorderArguments     = "reorderArguments"
+	fixExtractFile          = "extractFile"
+
+	// Fields further away are most likely not what the user meant
+	maxFieldSuggestionDistance = 3
+	maxFieldSuggestions        = 3
+	maxImportSuggestions       = 5
+)
+
+var (
+	unusedVariableRegexp  = regexp.MustCompile(`^Unused variable: (\S+)`)
+	unknownVariableRegexp = regexp.MustCompile(`^Unknown variable: (\S+)`)
+	unknownFieldRegexp    = regexp.MustCompile(`Field does not exist: (\S+)`)
+	identifierRegexp      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	importLineRegexp      = regexp.MustCompile(`^local\s+\w+\s*=\s*import(str|bin)?\s+('[^']*'|"[^"]*")\s*;`)
+)
+
+// codeActionData is sent to the client with each code action. It contains everything needed to compute the edit in codeAction/resolve
+type codeActionData struct {
+	Fix string               `json:"fix"`
+	URI protocol.DocumentURI `json:"uri"`
+	// Range of the diagnostic the action fixes or the selection of a refactoring
+	Range protocol.Range `json:"range"`
+	// Name of the variable or field the diagnostic is about or the name of a new local
+	Name string `json:"name"`
+	// The suggested field or the path to import
+	Replacement string `json:"replacement,omitempty"`
+	// Apply the refactoring to all occurrences
+	All bool `json:"all,omitempty"`
+}
+
+func (s *Server) CodeAction(_ context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("CodeAction: %s: %w", errorRetrievingDocument, err)
+	}
+
+	var actions []protocol.CodeAction
+	if codeActionKindRequested(params.Context.Only, protocol.QuickFix) {
+		for _, diag := range params.Context.Diagnostics {
+			actions = append(actions, s.quickFixes(doc, diag)...)
+		}
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.RefactorExtract) {
+		actions = append(actions, extractLocalActions(doc, params.Range)...)
+		actions = append(actions, s.extractFileActions(doc, params.Range.Start)...)
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.RefactorInline) {
+		actions = append(actions, s.inlineLocalActions(doc, params.Range.Start)...)
+	}
+	if codeActionKindRequested(params.Context.Only, protocol.RefactorRewrite) {
+		actions = append(actions, s.callArgumentActions(doc, params.Range.Start)...)
+	}
+
+	if s.clientResolvesCodeActionEdits() {
+		return actions, nil
+	}
+	resolved := make([]protocol.CodeAction, 0, len(actions))
+	for _, action := range actions {
+		if err := s.resolveCodeActionEdit(&action); err != nil {
+			log.Errorf("CodeAction: %v", err)
+			continue
+		}
+		resolved = append(resolved, action)
+	}
+	return resolved, nil
+}
+
+func (s *Server) ResolveCodeAction(_ context.Context, action *protocol.CodeAction) (*protocol.CodeAction, error) {
+	if err := s.resolveCodeActionEdit(action); err != nil {
+		return nil, utils.LogErrorf("ResolveCodeAction: %w", err)
+	}
+	return action, nil
+}
+
+// codeActionKindRequested checks if the client asked for the kind. Kinds are hierarchical, e.g. `refactor` includes `refactor.extract`
+func codeActionKindRequested(only []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(string(kind), string(requested)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) clientResolvesCodeActionEdits() bool {
+	resolveSupport := s.clientCapabilities.TextDocument.CodeAction.ResolveSupport
+	return resolveSupport != nil && slices.Contains(resolveSupport.Properties, "edit")
+}
+
+func (s *Server) resolveCodeActionEdit(action *protocol.CodeAction) error {
+	// The data is either still our struct or was decoded from json into a map
+	raw, err := json.Marshal(action.Data)
+	if err != nil {
+		return fmt.Errorf("encoding code action data: %w", err)
+	}
+	var data codeActionData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("decoding code action data: %w", err)
+	}
+
+	doc, err := s.cache.Get(data.URI)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errorRetrievingDocument, err)
+	}
+
+	var edits []protocol.TextEdit
+	switch data.Fix {
+	case fixRemoveUnusedVariable:
+		edits, err = removeUnusedVariableEdits(doc, data)
+	case fixReplaceField:
+		edits, err = replaceFieldEdits(doc, data)
+	case fixAddImport:
+		edits = addImportEdits(doc, data)
+	case fixExtractLocal:
+		edits, err = extractLocalEdits(doc, data)
+	case fixInlineLocal:
+		edits, err = s.inlineLocalEdits(doc, data)
+	case fixNamedArguments, fixPositionalArguments, fixReorderArguments:
+		edits, err = s.callArgumentEdits(doc, data)
+	case fixExtractFile:
+		edits, err = s.extractFileEdits(doc, data)
+	default:
+		err = fmt.Errorf("unknown fix %q", data.Fix)
+	}
+	if err != nil {
+		return err
+	}
+
+	action.Edit = s.buildWorkspaceEdit(map[protocol.DocumentURI][]protocol.TextEdit{data.URI: edits})
+	return nil
+}
+
+// quickFixes returns the code actions fixing the diagnostic. Edits are computed on resolve
+func (s *Server) quickFixes(doc *cache.Document, diag protocol.Diagnostic) []protocol.CodeAction {
+	newAction := func(title string, data codeActionData) protocol.CodeAction {
+		data.URI = doc.Item.URI
+		data.Range = diag.Range
+		return protocol.CodeAction{
+			Title:       title,
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Data:        data,
+		}
+	}
+
+	var actions []protocol.CodeAction
+	if match := unusedVariableRegexp.FindStringSubmatch(diag.Message); match != nil {
+		action := newAction(fmt.Sprintf("Remove unused variable `%s`", match[1]), codeActionData{Fix: fixRemoveUnusedVariable, Name: match[1]})
+		action.IsPreferred = true
+		actions = append(actions, action)
+	}
+	if match := unknownFieldRegexp.FindStringSubmatch(diag.Message); match != nil {
+		for _, field := range s.suggestFields(doc, diag.Range, match[1]) {
+			actions = append(actions, newAction(fmt.Sprintf("Did you mean `%s`?", field), codeActionData{Fix: fixReplaceField, Name: match[1], Replacement: field}))
+		}
+	}
+	if match := unknownVariableRegexp.FindStringSubmatch(diag.Message); match != nil {
+		for _, importPath := range s.findImportCandidates(doc, match[1]) {
+			actions = append(actions, newAction(fmt.Sprintf("Add `local %s = import '%s'`", match[1], importPath), codeActionData{Fix: fixAddImport, Name: match[1], Replacement: importPath}))
+		}
+	}
+	return actions
+}
+
+// suggestFields returns the fields of the indexed object that are closest to the missing field
+func (s *Server) suggestFields(doc *cache.Document, rng protocol.Range, name string) []string {
+	if doc.AST == nil {
+		return nil
+	}
+	// The error covers the whole index expression. The deepest node at its end is the index itself
+	end := position.ProtocolToAST(rng.End)
+	end.Column--
+	stack, err := processing.FindNodeByPosition(doc.AST, end)
+	if err != nil || stack.IsEmpty() {
+		return nil
+	}
+	index, ok := stack.Peek().(*ast.Index)
+	if !ok {
+		return nil
+	}
+
+	var candidates []string
+	if target, ok := index.Target.(*ast.Var); ok && string(target.Id) == utils.StdIdentifier {
+		for _, function := range s.stdlib {
+			candidates = append(candidates, function.Name)
+		}
+	} else {
+		for _, item := range s.createCompletionItems(stack, rng.End, false) {
+			if item.Kind != protocol.SnippetCompletion {
+				candidates = append(candidates, item.Label)
+			}
+		}
+	}
+	return closestNames(name, candidates)
+}
+
+func closestNames(name string, candidates []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var matches []candidate
+	for _, c := range candidates {
+		distance := utils.EditDistance(name, c)
+		if c != name && distance <= maxFieldSuggestionDistance && distance < len(name) {
+			matches = append(matches, candidate{name: c, distance: distance})
+		}
+	}
+	slices.SortFunc(matches, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.name, b.name))
+	})
+	matches = slices.CompactFunc(matches, func(a, b candidate) bool { return a.name == b.name })
+
+	var names []string
+	for _, match := range matches[:min(len(matches), maxFieldSuggestions)] {
+		names = append(names, match.name)
+	}
+	return names
+}
+
+// findImportCandidates returns the import paths of indexed files named like the variable (`name.libsonnet` or `name/main.libsonnet`)
+func (s *Server) findImportCandidates(doc *cache.Document, name string) []string {
+	filename := doc.Item.URI.SpanURI().Filename()
+	searchPaths := s.importJPaths(filename)
+
+	var candidates []string
+	for _, file := range s.index.Files() {
+		base := filepath.Base(file)
+		stem := strings.TrimSuffix(base, filepath.Ext(base))
+		if file == filename || (stem != name && (base != "main.libsonnet" || filepath.Base(filepath.Dir(file)) != name)) {
+			continue
+		}
+		if importPath := shortestImportPath(file, searchPaths); importPath != "" {
+			candidates = append(candidates, importPath)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+	})
+	candidates = slices.Compact(candidates)
+	return candidates[:min(len(candidates), maxImportSuggestions)]
+}
+
+// shortestImportPath returns the shortest path the file can be imported with from one of the search paths.
+// Relative search paths are relative to the working directory, like the jpaths
+func shortestImportPath(file string, searchPaths []string) string {
+	shortest := ""
+	for _, searchPath := range searchPaths {
+		searchPath, err := filepath.Abs(searchPath)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(searchPath, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if shortest == "" || len(rel) < len(shortest) {
+			shortest = rel
+		}
+	}
+	return filepath.ToSlash(shortest)
+}
+
+func addImportEdits(doc *cache.Document, data codeActionData) []protocol.TextEdit {
+	insertAt := protocol.Position{Line: uint32(importInsertLine(doc.Item.Text))}
+	return []protocol.TextEdit{{
+		Range:   protocol.Range{Start: insertAt, End: insertAt},
+		NewText: fmt.Sprintf("local %s = import '%s';\n", data.Name, data.Replacement),
+	}}
+}
+
+// importInsertLine returns the line after the imports at the top of the document
+func importInsertLine(text string) int {
+	insertLine := 0
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case importLineRegexp.MatchString(trimmed):
+			insertLine = i + 1
+		case trimmed == "", strings.HasPrefix(trimmed, "//"), strings.HasPrefix(trimmed, "#"):
+			continue
+		default:
+			return insertLine
+		}
+	}
+	return insertLine
+}
+
+func replaceFieldEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	start, err := position.ProtocolToOffset(doc.Item.Text, data.Range.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := position.ProtocolToOffset(doc.Item.Text, data.Range.End)
+	if err != nil {
+		return nil, err
+	}
+	nameStart := strings.LastIndex(doc.Item.Text[start:end], data.Name)
+	if nameStart < 0 {
+		return nil, fmt.Errorf("field %s not found in %s", data.Name, doc.Item.Text[start:end])
+	}
+	nameStart += start
+	nameEnd := nameStart + len(data.Name)
+
+	newText := data.Replacement
+	if !identifierRegexp.MatchString(data.Replacement) && nameStart > 0 && doc.Item.Text[nameStart-1] == '.' {
+		// Fields that are no identifiers can't be used with a dot
+		nameStart--
+		newText = fmt.Sprintf("['%s']", data.Replacement)
+	}
+	return []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: position.OffsetToProtocol(doc.Item.Text, nameStart),
+			End:   position.OffsetToProtocol(doc.Item.Text, nameEnd),
+		},
+		NewText: newText,
+	}}, nil
+}
+
+func removeUnusedVariableEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	if doc.AST == nil {
+		return nil, fmt.Errorf("%s", errorParsingDocument)
+	}
+	begin := position.ProtocolToAST(data.Range.Start)
+
+	var binds ast.LocalBinds
+	bindIndex := -1
+	objectLocal := false
+	for _, node := range nodetree.BuildTree(nil, doc.AST).GetAllChildren() {
+		switch node := node.(type) {
+		case *ast.Local:
+			binds, objectLocal = node.Binds, false
+		case *ast.DesugaredObject:
+			binds, objectLocal = node.Locals, true
+		default:
+			continue
+		}
+		bindIndex = slices.IndexFunc(binds, func(bind ast.LocalBind) bool {
+			return string(bind.Variable) == data.Name && bind.LocRange.Begin == begin
+		})
+		if bindIndex >= 0 {
+			break
+		}
+	}
+	if bindIndex < 0 {
+		return nil, fmt.Errorf("unable to find bind of %s", data.Name)
+	}
+
+	text := doc.Item.Text
+	bind := binds[bindIndex]
+	start, err := position.ProtocolToOffset(text, position.ASTToProtocol(bind.LocRange.Begin))
+	if err != nil {
+		return nil, err
+	}
+	end, err := position.ProtocolToOffset(text, position.ASTToProtocol(bind.LocRange.End))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case objectLocal || len(binds) == 1:
+		// Remove the whole `local x = ...;` including the separator
+		localStart := strings.LastIndex(text[:start], "local")
+		if localStart < 0 || strings.TrimSpace(text[localStart+len("local"):start]) != "" {
+			return nil, fmt.Errorf("unable to find local keyword of %s", data.Name)
+		}
+		start = localStart
+		if after := skipWhitespace(text, end); after < len(text) && (text[after] == ';' || (objectLocal && text[after] == ',')) {
+			end = after + 1
+		}
+	case bindIndex == 0:
+		// `local unused = 1, other = 2;`. Keep the local keyword for the other binds
+		if after := skipWhitespace(text, end); after < len(text) && text[after] == ',' {
+			end = skipWhitespace(text, after+1)
+		}
+	default:
+		// Remove the comma separating the bind from the previous one
+		if comma := strings.LastIndex(text[:start], ","); comma >= 0 {
+			start = comma
+		}
+	}
+
+	start, end = expandToLines(text, start, end)
+	return []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: position.OffsetToProtocol(text, start),
+			End:   position.OffsetToProtocol(text, end),
+		},
+	}}, nil
+}
+
+func skipWhitespace(text string, offset int) int {
+	for offset < len(text) && strings.ContainsRune(" \t\r\n", rune(text[offset])) {
+		offset++
+	}
+	return offset
+}
+
+// expandToLines extends the range to whole lines if nothing else is left on them
+func expandToLines(text string, start, end int) (int, int) {
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+	lineEnd := len(text)
+	if next := strings.IndexByte(text[end:], '\n'); next >= 0 {
+		lineEnd = end + next
+	}
+	if strings.TrimSpace(text[lineStart:start]) != "" || strings.TrimSpace(text[end:lineEnd]) != "" {
+		return start, end
+	}
+	if lineEnd < len(text) {
+		lineEnd++
+	}
+	return lineStart, lineEnd
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyTextEdits applies the edits of a single document
+func applyTextEdits(t *testing.T, text string, edits []protocol.TextEdit) string {
+	t.Helper()
+
+	edits = slices.Clone(edits)
+	slices.SortFunc(edits, func(a, b protocol.TextEdit) int {
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return int(b.Range.Start.Line) - int(a.Range.Start.Line)
+		}
+		return int(b.Range.Start.Character) - int(a.Range.Start.Character)
+	})
+	for _, edit := range edits {
+		start, err := position.ProtocolToOffset(text, edit.Range.Start)
+		require.NoError(t, err)
+		end, err := position.ProtocolToOffset(text, edit.Range.End)
+		require.NoError(t, err)
+		text = text[:start] + edit.NewText + text[end:]
+	}
+	return text
+}
+
+func TestCodeActionQuickFixes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fileContent   string
+		lint          bool
+		expectedTitle []string
+		expected      string
+	}{
+		{
+			name:          "remove unused local",
+			fileContent:   "local unused = 'test';\n{}\n",
+			lint:          true,
+			expectedTitle: []string{"Remove unused variable `unused`"},
+			expected:      "{}\n",
+		},
+		{
+			name:          "remove first of multiple binds",
+			fileContent:   "local unused = 1, used = 2;\nused\n",
+			lint:          true,
+			expectedTitle: []string{"Remove unused variable `unused`"},
+			expected:      "local used = 2;\nused\n",
+		},
+		{
+			name:          "remove second of multiple binds",
+			fileContent:   "local used = 1, unused = 2;\nused\n",
+			lint:          true,
+			expectedTitle: []string{"Remove unused variable `unused`"},
+			expected:      "local used = 1;\nused\n",
+		},
+		{
+			name:          "remove object local",
+			fileContent:   "{\n  local unused = 1,\n  a: 2,\n}\n",
+			lint:          true,
+			expectedTitle: []string{"Remove unused variable `unused`"},
+			expected:      "{\n  a: 2,\n}\n",
+		},
+		{
+			name:          "did you mean field",
+			fileContent:   "local obj = { foo: 1, bar: 2 };\n{ a: obj.fooo }\n",
+			expectedTitle: []string{"Did you mean `foo`?"},
+			expected:      "local obj = { foo: 1, bar: 2 };\n{ a: obj.foo }\n",
+		},
+		{
+			name:          "did you mean std function",
+			fileContent:   "{ a: std.lenght([]) }\n",
+			expectedTitle: []string{"Did you mean `length`?"},
+			expected:      "{ a: std.length([]) }\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, []stdlib.Function{{Name: "length"}, {Name: "lines"}}, tc.fileContent)
+			server.configuration.Diagnostics.EnableEvalDiagnostics = true
+			doc, err := server.cache.Get(fileURI)
+			require.NoError(t, err)
+
+			diags := server.getEvalDiags(doc)
+			if tc.lint {
+				diags = server.getLintDiags(doc)
+			}
+			require.NotEmpty(t, diags)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Range:        diags[0].Range,
+				Context:      protocol.CodeActionContext{Diagnostics: diags, Only: []protocol.CodeActionKind{protocol.QuickFix}},
+			})
+			require.NoError(t, err)
+
+			var titles []string
+			for _, action := range actions {
+				titles = append(titles, action.Title)
+			}
+			require.Equal(t, tc.expectedTitle, titles)
+			assert.Equal(t, tc.expected, applyTextEdits(t, doc.Item.Text, actions[0].Edit.Changes[fileURI]))
+		})
+	}
+}
+
+func TestCodeActionAddImport(t *testing.T) {
+	dir := t.TempDir()
+	libFile := filepath.Join(dir, "lib", "mylib.libsonnet")
+	require.NoError(t, os.MkdirAll(filepath.Dir(libFile), 0o755))
+	require.NoError(t, os.WriteFile(libFile, []byte("{ x: 1 }"), 0o600))
+	mainFile := filepath.Join(dir, "main.jsonnet")
+	content := "// Header\nlocal other = import 'other.libsonnet';\n\n{ a: mylib.x }\n"
+	require.NoError(t, os.WriteFile(mainFile, []byte(content), 0o600))
+
+	server := testServer(t, nil)
+	server.configuration.JPaths = []string{filepath.Join(dir, "lib")}
+	server.indexWorkspace(server.configuration.JPaths)
+	fileURI := serverOpenTestFile(t, server, mainFile)
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+
+	diags := server.getEvalDiags(doc)
+	require.Len(t, diags, 1)
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Context:      protocol.CodeActionContext{Diagnostics: diags},
+	})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "Add `local mylib = import 'mylib.libsonnet'`", actions[0].Title)
+	assert.Equal(t,
+		"// Header\nlocal other = import 'other.libsonnet';\nlocal mylib = import 'mylib.libsonnet';\n\n{ a: mylib.x }\n",
+		applyTextEdits(t, content, actions[0].Edit.Changes[fileURI]))
+
+	// Only requesting refactorings doesn't return quick fixes
+	actions, err = server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Context:      protocol.CodeActionContext{Diagnostics: diags, Only: []protocol.CodeActionKind{protocol.Refactor}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, actions)
+}
+
+func TestCodeActionResolve(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "local unused = 'test';\n{}\n")
+	server.clientCapabilities.TextDocument.CodeAction.ResolveSupport = &protocol.PResolveSupportPCodeAction{Properties: []string{"edit"}}
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Context:      protocol.CodeActionContext{Diagnostics: server.getLintDiags(doc)},
+	})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Empty(t, actions[0].Edit.Changes)
+
+	// The action is sent to the client and back
+	raw, err := json.Marshal(actions[0])
+	require.NoError(t, err)
+	var action protocol.CodeAction
+	require.NoError(t, json.Unmarshal(raw, &action))
+
+	resolved, err := server.ResolveCodeAction(context.Background(), &action)
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", applyTextEdits(t, doc.Item.Text, resolved.Edit.Changes[fileURI]))
+}
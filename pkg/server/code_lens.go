@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// testFileSuffixes are the suffixes of test files. Their top-level fields are tests, e.g. `testFoo: std.assertEqual(a, b)`
+var testFileSuffixes = []string{"_test.jsonnet", "_test.libsonnet"}
+
+// codeLensResult are the lenses evaluated for a version of a document
+type codeLensResult struct {
+	version int32
+	lenses  []protocol.CodeLens
+}
+
+// CodeLens evaluates the top-level fields and local functions of the document. In test files, the top-level fields are run
+// as tests instead. The lenses are evaluated right away, since the protocol package can't send a lens without a command.
+// They are kept until the document or a watched file changes
+func (s *Server) CodeLens(_ context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	filename := params.TextDocument.URI.SpanURI().Filename()
+	if !s.configurationFor(filename).EnableCodeLens {
+		return []protocol.CodeLens{}, nil
+	}
+
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("CodeLens: %s: %w", errorRetrievingDocument, err)
+	}
+
+	if doc.AST == nil {
+		log.Errorf("CodeLens: %s", errorParsingDocument)
+		return nil, nil
+	}
+	if err := parseError(doc); err != nil {
+		return nil, utils.LogErrorf("CodeLens: %s: %w", errorParsingDocument, err)
+	}
+
+	s.codeLensMutex.Lock()
+	previous, ok := s.codeLensResults[params.TextDocument.URI]
+	s.codeLensMutex.Unlock()
+	if ok && previous.version == doc.Item.Version {
+		return previous.lenses, nil
+	}
+
+	lenses := s.evaluateCodeLenses(doc.AST, filename)
+	s.codeLensMutex.Lock()
+	s.codeLensResults[params.TextDocument.URI] = codeLensResult{version: doc.Item.Version, lenses: lenses}
+	s.codeLensMutex.Unlock()
+	return lenses, nil
+}
+
+// forgetCodeLenses drops the lenses of the document. Without a document, the lenses of all documents are dropped
+func (s *Server) forgetCodeLenses(uri protocol.DocumentURI) {
+	s.codeLensMutex.Lock()
+	defer s.codeLensMutex.Unlock()
+	if uri == "" {
+		clear(s.codeLensResults)
+		return
+	}
+	delete(s.codeLensResults, uri)
+}
+
+func (s *Server) evaluateCodeLenses(root ast.Node, filename string) []protocol.CodeLens {
+	vm := s.getVM(filename)
+	lenses := []protocol.CodeLens{}
+	binds, body := topLevelLocals(root)
+	for _, bind := range binds {
+		// Functions are called without arguments
+		function, ok := bind.Body.(*ast.Function)
+		if !ok || !allParametersOptional(function) {
+			continue
+		}
+		result, err := vm.Evaluate(withTopLevelLocals(root, &ast.Apply{Target: &ast.Var{Id: bind.Variable}}))
+		lenses = append(lenses, protocol.CodeLens{
+			Range:   position.RangeASTToProtocol(nameRange(bindNameLocation(bind), bind.Variable)),
+			Command: evalExpressionCommand(evalLensTitle(result, err), filename, string(bind.Variable)+"()", true),
+		})
+	}
+
+	object, ok := body.(*ast.DesugaredObject)
+	if !ok {
+		return lenses
+	}
+	test := isTestFile(filename)
+	passed, failed := 0, 0
+	for _, field := range object.Fields {
+		name, ok := field.Name.(*ast.LiteralString)
+		if !ok || !field.LocRange.Begin.IsSet() {
+			continue
+		}
+		result, err := vm.Evaluate(&ast.Index{Target: root, Index: &ast.LiteralString{Value: name.Value}})
+		title := evalLensTitle(result, err)
+		if test {
+			title = testLensTitle(result, err)
+			if err == nil && strings.TrimSpace(result) != "false" {
+				passed++
+			} else {
+				failed++
+			}
+		}
+		lenses = append(lenses, protocol.CodeLens{
+			Range:   position.RangeASTToProtocol(nameRange(field.LocRange.Begin, ast.Identifier(fieldNameText(field)))),
+			Command: evalExpressionCommand(title, filename, fieldPath(name.Value), false),
+		})
+	}
+	if test && passed+failed > 0 {
+		lenses = append(lenses, protocol.CodeLens{
+			Range: position.RangeASTToProtocol(ast.LocationRange{Begin: object.LocRange.Begin, End: object.LocRange.Begin}),
+			// Evaluates all tests
+			Command: protocol.Command{
+				Title:     fmt.Sprintf("Tests: %d passed, %d failed", passed, failed),
+				Command:   "jsonnet.evalFile",
+				Arguments: []json.RawMessage{mustMarshal(filename)},
+			},
+		})
+	}
+	return lenses
+}
+
+// isTestFile checks if the file follows the naming convention of test files
+func isTestFile(filename string) bool {
+	for _, suffix := range testFileSuffixes {
+		if strings.HasSuffix(filepath.Base(filename), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// topLevelLocals returns the binds of the locals at the start of the document and the expression after them
+func topLevelLocals(root ast.Node) ([]ast.LocalBind, ast.Node) {
+	var binds []ast.LocalBind
+	for {
+		local, ok := root.(*ast.Local)
+		if !ok {
+			return binds, root
+		}
+		binds = append(binds, local.Binds...)
+		root = local.Body
+	}
+}
+
+// withTopLevelLocals returns body in the scope of the locals at the start of the document. The document is not modified
+func withTopLevelLocals(root ast.Node, body ast.Node) ast.Node {
+	local, ok := root.(*ast.Local)
+	if !ok {
+		return body
+	}
+	clone := *local
+	clone.Body = withTopLevelLocals(local.Body, body)
+	return &clone
+}
+
+func allParametersOptional(function *ast.Function) bool {
+	for _, param := range function.Parameters {
+		if param.DefaultArg == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldNameText returns the name of the field as written in the document, including quotes
+func fieldNameText(field ast.DesugaredObjectField) string {
+	name := field.Name.(*ast.LiteralString)
+	if name.Kind == ast.StringDouble || name.Kind == ast.StringSingle || !identifierRegexp.MatchString(name.Value) {
+		return fmt.Sprintf("%q", name.Value)
+	}
+	return name.Value
+}
+
+// fieldPath returns the expression of jsonnet.evalExpression selecting the field
+func fieldPath(name string) string {
+	if identifierRegexp.MatchString(name) {
+		return name
+	}
+	quoted, _ := json.Marshal(name)
+	return "[" + string(quoted) + "]"
+}
+
+// evalLensTitle shows the size of the result or the error
+func evalLensTitle(result string, err error) string {
+	if err != nil {
+		return "Evaluate (error: " + errorSummary(err) + ")"
+	}
+	size := len(strings.TrimSuffix(result, "\n"))
+	if size < 1024 {
+		return fmt.Sprintf("Evaluate (%d B)", size)
+	}
+	return fmt.Sprintf("Evaluate (%.1f KiB)", float64(size)/1024)
+}
+
+// testLensTitle shows if the test passed. Tests fail if they don't evaluate or evaluate to false
+func testLensTitle(result string, err error) string {
+	switch {
+	case err != nil:
+		return "✗ Test failed: " + errorSummary(err)
+	case strings.TrimSpace(result) == "false":
+		return "✗ Test failed: evaluated to false"
+	}
+	return "✓ Test passed"
+}
+
+// errorSummary returns the first line of an evaluation error
+func errorSummary(err error) string {
+	summary, _, _ := strings.Cut(err.Error(), "\n")
+	summary = strings.TrimPrefix(summary, "RUNTIME ERROR: ")
+	if len(summary) > 100 {
+		summary = summary[:100] + "..."
+	}
+	return summary
+}
+
+func evalExpressionCommand(title, filename, expression string, inTopLevelLocals bool) protocol.Command {
+	command := protocol.Command{
+		Title:     title,
+		Command:   "jsonnet.evalExpression",
+		Arguments: []json.RawMessage{mustMarshal(filename), mustMarshal(expression)},
+	}
+	if inTopLevelLocals {
+		command.Arguments = append(command.Arguments, mustMarshal(true))
+	}
+	return command
+}
+
+func mustMarshal(value any) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// evalInTopLevelLocals evaluates the expression in the scope of the locals at the start of the file
+func (s *Server) evalInTopLevelLocals(fileName, expression string) (string, error) {
+	var text string
+	if doc, err := s.cache.Get(protocol.URIFromPath(fileName)); err == nil {
+		text = doc.Item.Text
+	} else {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return "", err
+		}
+		text = string(content)
+	}
+	root, err := jsonnet.SnippetToAST(fileName, text)
+	if err != nil {
+		return "", err
+	}
+	_, body := topLevelLocals(root)
+	offset, err := position.ProtocolToOffset(text, position.ASTToProtocol(body.Loc().Begin))
+	if err != nil {
+		return "", err
+	}
+	return s.getVM(fileName).EvaluateAnonymousSnippet(fileName, text[:offset]+expression)
+}
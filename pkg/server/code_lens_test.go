@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeLens(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filename string
+		expected []string
+	}{
+		{
+			name:     "fields and local functions",
+			filename: "fields.jsonnet",
+			expected: []string{
+				"0:6 Evaluate (13 B) jsonnet.evalExpression[fields.jsonnet f() true]",
+				"3:2 Evaluate (13 B) jsonnet.evalExpression[fields.jsonnet a]",
+				"4:2 Evaluate (5 B) jsonnet.evalExpression[fields.jsonnet [\"b-c\"]]",
+				"5:2 Evaluate (error: broken) jsonnet.evalExpression[fields.jsonnet d]",
+			},
+		},
+		{
+			name:     "tests",
+			filename: "fields_test.jsonnet",
+			expected: []string{
+				"2:2 ✓ Test passed jsonnet.evalExpression[fields_test.jsonnet testPass]",
+				"3:2 ✗ Test failed: Assertion failed. 1 != 2 jsonnet.evalExpression[fields_test.jsonnet testFail]",
+				"4:2 ✗ Test failed: evaluated to false jsonnet.evalExpression[fields_test.jsonnet testFalse]",
+				"1:0 Tests: 1 passed, 2 failed jsonnet.evalFile[fields_test.jsonnet]",
+			},
+		},
+		{
+			name:     "not an object",
+			filename: "array.jsonnet",
+			expected: []string{"0:6 Evaluate (1 B) jsonnet.evalExpression[array.jsonnet f() true]"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			fixture := newTestFixture(t, "code-lens")
+			fileURI, _ := fixture.open(t, server, tc.filename)
+			params := &protocol.CodeLensParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}}
+
+			lenses, err := server.CodeLens(context.Background(), params)
+			require.NoError(t, err)
+			assert.Empty(t, lenses)
+
+			server.configuration.EnableCodeLens = true
+			lenses, err = server.CodeLens(context.Background(), params)
+			require.NoError(t, err)
+
+			var actual []string
+			for _, lens := range lenses {
+				var args []any
+				for _, arg := range lens.Command.Arguments {
+					var value any
+					require.NoError(t, json.Unmarshal(arg, &value))
+					if value == fixture.path(tc.filename) {
+						value = tc.filename
+					}
+					args = append(args, value)
+				}
+				actual = append(actual, fmt.Sprintf("%d:%d %s %s%v", lens.Range.Start.Line, lens.Range.Start.Character, lens.Command.Title, lens.Command.Command, args))
+
+				// The command of the lens evaluates the same expression
+				if strings.HasPrefix(lens.Command.Title, "Evaluate (") && !strings.Contains(lens.Command.Title, "error") {
+					_, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: lens.Command.Command, Arguments: lens.Command.Arguments})
+					assert.NoError(t, err)
+				}
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCodeLensCache(t *testing.T) {
+	server := testServer(t, nil)
+	server.configuration.EnableCodeLens = true
+	fixture := newTestFixture(t, "code-lens")
+	fileURI, _ := fixture.open(t, server, "cache.jsonnet")
+	libFilename := fixture.path("lib.libsonnet")
+
+	titles := func() []string {
+		lenses, err := server.CodeLens(context.Background(), &protocol.CodeLensParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}})
+		require.NoError(t, err)
+		var titles []string
+		for _, lens := range lenses {
+			titles = append(titles, lens.Command.Title)
+		}
+		return titles
+	}
+	assert.Equal(t, []string{"Evaluate (1 B)"}, titles())
+
+	// The lenses of a version are only evaluated once
+	require.NoError(t, os.WriteFile(libFilename, []byte("100"), 0o600))
+	assert.Equal(t, []string{"Evaluate (1 B)"}, titles())
+
+	require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: protocol.URIFromPath(libFilename), Type: protocol.Changed}},
+	}))
+	assert.Equal(t, []string{"Evaluate (3 B)"}, titles())
+
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{\n  a: 'abc',\n}\n"}},
+	}))
+	assert.Equal(t, []string{"Evaluate (5 B)"}, titles())
+}
+
+func TestCodeLensParseError(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "{\n  a: 1,\n}\n")
+	server.configuration.EnableCodeLens = true
+	// The repaired AST doesn't match the text of the document
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{\n  a: 1,\n  b: \n}\n"}},
+	}))
+
+	_, err := server.CodeLens(context.Background(), &protocol.CodeLensParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}})
+	assert.ErrorContains(t, err, errorParsingDocument)
+}
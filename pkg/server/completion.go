@@ -64,7 +64,7 @@ func (s *Server) Completion(_ context.Context, params *protocol.CompletionParams
 		indexParts := strings.Split(info.Index, "/")
 		currentPath := strings.Join(indexParts[:len(indexParts)-1], "/")
 		//		currentIndex := indexParts[len(indexParts)-1]
-		importPaths := s.configuration.JPaths
+		importPaths := s.jpaths(doc.Item.URI.SpanURI().Filename())
 		currentFileDir := filepath.Dir(doc.Item.URI.SpanURI().Filename())
 		importPaths = append(importPaths, currentFileDir)
 		for _, jpath := range importPaths {
@@ -91,10 +91,9 @@ func (s *Server) Completion(_ context.Context, params *protocol.CompletionParams
 		}
 		return &protocol.CompletionList{IsIncomplete: false, Items: items}, nil
 	case cst.CompleteExtVar:
-		log.Errorf("ext var %+v", s.configuration.ExtVars)
-		log.Errorf("ext code %+v", s.configuration.ExtCode)
+		extVars, extCode := s.extVars(doc.Item.URI.SpanURI().Filename())
 		var items []protocol.CompletionItem
-		for key, value := range s.configuration.ExtVars {
+		for key, value := range extVars {
 			items = append(items, protocol.CompletionItem{
 				Label:      key,
 				Kind:       protocol.ValueCompletion,
@@ -102,7 +101,7 @@ func (s *Server) Completion(_ context.Context, params *protocol.CompletionParams
 				InsertText: key,
 			})
 		}
-		for key, value := range s.configuration.ExtCode {
+		for key, value := range extCode {
 			items = append(items, protocol.CompletionItem{
 				Label:      key,
 				Kind:       protocol.ValueCompletion,
@@ -13,12 +13,12 @@ import (
 
 	"github.com/google/go-jsonnet/formatter"
 	"github.com/jdbaldry/go-language-server-protocol/jsonrpc2"
-	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	"github.com/mitchellh/mapstructure"
 	log "github.com/sirupsen/logrus"
 )
 
-var extCodeSuffix = ".extcode.jsonnet"
+// ExtCodeSuffix is the suffix of files loaded as ext code
+var ExtCodeSuffix = ".extcode.jsonnet"
 
 type InlayFunctionArgs struct {
 	// Show inlay hints for parameters even if the names are the same
@@ -65,7 +65,7 @@ type CompletionConfig struct {
 
 type PathConfig struct {
 	ExtCode ExtCodeConfig `json:"ext_code"`
-	// A list of folders relative to all workspaces to add the the jpath
+	// A list of folders relative to all workspaces to add the the jpath of the documents in the workspace
 	RelativeJPaths []string `json:"relative_jpaths"`
 }
 
@@ -76,6 +76,18 @@ type DiagnosticConfig struct {
 	EnableLintDiagnostics bool `json:"enable_lint_diagnostics"`
 }
 
+type IndexConfig struct {
+	// Persist the workspace index, so the next start doesn't have to parse every file again. Enabled if not set
+	EnablePersistence *bool `json:"enable_persistence"`
+	// Directory to store the index in. Defaults to the user cache directory
+	CacheDir string `json:"cache_dir"`
+}
+
+// PersistenceEnabled checks if the index is persisted. Settings without an index block keep the default
+func (c IndexConfig) PersistenceEnabled() bool {
+	return c.EnablePersistence == nil || *c.EnablePersistence
+}
+
 type Configuration struct {
 	// The log level to use (logrus format)
 	LogLevel log.Level `json:"log_level"`
@@ -100,10 +112,16 @@ type Configuration struct {
 
 	Completion CompletionConfig `json:"completion"`
 
-	workspaces []protocol.WorkspaceFolder
+	Index IndexConfig `json:"index"`
+
+	// Enables code lenses evaluating the top-level fields and local functions of documents and the tests of test files
+	EnableCodeLens bool `json:"enable_code_lens"`
+
+	relativeJPaths []string
 }
 
 func NewDefaultConfiguration() *Configuration {
+	enabled := true
 	// TODO: Since (the json implementation of) go is incomplete, we need to properly define defaults for the config. Maybe hijack the schema?
 	return &Configuration{
 		LogLevel:          log.ErrorLevel,
@@ -115,12 +133,14 @@ func NewDefaultConfiguration() *Configuration {
 		Completion: CompletionConfig{
 			EnableKeywords: true,
 		},
+		Index: IndexConfig{
+			EnablePersistence: &enabled,
+		},
 	}
 }
 
-func NewConfiguration(data any, workspaces []protocol.WorkspaceFolder) (*Configuration, error) {
+func NewConfiguration(data any) (*Configuration, error) {
 	settings := Configuration{}
-	settings.workspaces = workspaces
 	configBytes, err := json.Marshal(data)
 	if err != nil {
 		return nil, fmt.Errorf("marshalling extcode config: %w", err)
@@ -163,25 +183,44 @@ func (c *Configuration) UnmarshalJSON(data []byte) error {
 		}
 		c.LogLevel = level
 	}
-	c.buildJPaths(aux.Paths.RelativeJPaths)
-	extCode, err := c.loadExtCodeFiles(aux.Paths.ExtCode)
+	c.relativeJPaths = aux.Paths.RelativeJPaths
+	c.ExtCode, err = extCodeIn("./", c.ExtCode, aux.Paths.ExtCode)
+	return err
+}
+
+// ExtCodeIn returns the ext code of the settings merged with the ext code files of the directory.
+// With find_upwards, the files of its parents are used as well
+func ExtCodeIn(settings any, dir string) (map[string]string, error) {
+	var aux struct {
+		ExtCode map[string]string `json:"ext_code"`
+		Paths   PathConfig        `json:"paths"`
+	}
+	data, err := json.Marshal(settings)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("marshalling settings: %w", err)
 	}
-	if c.ExtCode == nil {
-		c.ExtCode = make(map[string]string)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return nil, fmt.Errorf("unmarshalling settings: %w", err)
 	}
-	maps.Copy(c.ExtCode, extCode)
-
-	return nil
+	return extCodeIn(dir, aux.ExtCode, aux.Paths.ExtCode)
 }
 
-func (c *Configuration) buildJPaths(relativePaths []string) {
-	for _, folder := range c.workspaces {
-		for _, name := range relativePaths {
-			c.JPaths = append(c.JPaths, fmt.Sprintf("%s/%s", folder.Name, name))
-		}
+func extCodeIn(dir string, settingsExtCode map[string]string, config ExtCodeConfig) (map[string]string, error) {
+	extCode, err := loadExtCodeFiles(dir, config)
+	if err != nil {
+		return nil, err
 	}
+	result := maps.Clone(settingsExtCode)
+	if result == nil {
+		result = make(map[string]string)
+	}
+	maps.Copy(result, extCode)
+	return result, nil
+}
+
+// RelativeJPaths returns the jpaths relative to the workspace folders
+func (c *Configuration) RelativeJPaths() []string {
+	return c.relativeJPaths
 }
 
 func parseFormattingOpts(unparsed any) (formatter.Options, error) {
@@ -209,6 +248,29 @@ func parseFormattingOpts(unparsed any) (formatter.Options, error) {
 	return opts, nil
 }
 
+// FormattingSettings returns the settings the formatting options are parsed from
+func FormattingSettings(opts formatter.Options) (map[string]any, error) {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	settings["StringStyle"] = map[formatter.StringStyle]string{
+		formatter.StringStyleDouble: "double",
+		formatter.StringStyleSingle: "single",
+		formatter.StringStyleLeave:  "leave",
+	}[opts.StringStyle]
+	settings["CommentStyle"] = map[formatter.CommentStyle]string{
+		formatter.CommentStyleHash:  "hash",
+		formatter.CommentStyleSlash: "slash",
+		formatter.CommentStyleLeave: "leave",
+	}[opts.CommentStyle]
+	return settings, nil
+}
+
 func stringStyleDecodeFunc(_, to reflect.Type, unparsed any) (any, error) {
 	if to != reflect.TypeOf(formatter.StringStyleDouble) {
 		return unparsed, nil
@@ -252,9 +314,7 @@ func commentStyleDecodeFunc(_, to reflect.Type, unparsed any) (any, error) {
 	}
 }
 
-func (c *Configuration) loadExtCodeFiles(config ExtCodeConfig) (map[string]string, error) {
-	currentPath := "./"
-
+func loadExtCodeFiles(currentPath string, config ExtCodeConfig) (map[string]string, error) {
 	fileMap := map[string]string{}
 
 	var err error
@@ -263,16 +323,16 @@ func (c *Configuration) loadExtCodeFiles(config ExtCodeConfig) (map[string]strin
 		if err != nil {
 			return nil, fmt.Errorf("getting abs path for %s: %w", currentPath, err)
 		}
-		files, err := c.findNextExtCodeFile(currentPath)
+		files, err := findNextExtCodeFile(currentPath)
 		if err == nil {
 			for _, found := range files {
-				paramName := strings.TrimSuffix(found, extCodeSuffix)
+				paramName := strings.TrimSuffix(found, ExtCodeSuffix)
 				// WTF GO!? No simple "has" function?
 				if _, exists := fileMap[paramName]; exists {
 					// Skip existing config as the lower ones should have precedence
 					continue
 				}
-				content, err := os.ReadFile(found)
+				content, err := os.ReadFile(filepath.Join(currentPath, found))
 				if err != nil {
 					return nil, fmt.Errorf("reading extcode file %s: %w", found, err)
 				}
@@ -290,7 +350,7 @@ func (c *Configuration) loadExtCodeFiles(config ExtCodeConfig) (map[string]strin
 	return fileMap, nil
 }
 
-func (c *Configuration) findNextExtCodeFile(currentPath string) ([]string, error) {
+func findNextExtCodeFile(currentPath string) ([]string, error) {
 	foundFiles := []string{}
 	cwd, err := filepath.Abs(currentPath)
 	if err != nil {
@@ -303,7 +363,7 @@ func (c *Configuration) findNextExtCodeFile(currentPath string) ([]string, error
 	// Am I just spoiled or is go just this stupid? Again this would be a simple "filter" in almost any other language
 	for {
 		idx := slices.IndexFunc(files, func(entry os.DirEntry) bool {
-			return !entry.IsDir() && strings.HasSuffix(entry.Name(), extCodeSuffix)
+			return !entry.IsDir() && strings.HasSuffix(entry.Name(), ExtCodeSuffix)
 		})
 
 		if idx < 0 {
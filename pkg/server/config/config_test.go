@@ -2,17 +2,19 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/google/go-jsonnet/formatter"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfig(t *testing.T) {
 	testCases := []struct {
-		name       string
-		config     string
-		workspaces []protocol.WorkspaceFolder
+		name   string
+		config string
 
 		expectError    bool
 		expectedConfig Configuration
@@ -46,23 +48,16 @@ func TestConfig(t *testing.T) {
 				"jpath": ["/test"]
 			}
 			`,
-			workspaces: []protocol.WorkspaceFolder{{Name: "/test"}, {Name: "/test2"}},
 			expectedConfig: Configuration{
-				JPaths: []string{
-					"/test",
-					"/test/lib",
-					"/test/vendor",
-					"/test2/lib",
-					"/test2/vendor",
-				},
+				JPaths:         []string{"/test"},
+				relativeJPaths: []string{"lib", "vendor"},
 			},
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			conf := Configuration{workspaces: tc.workspaces}
-			tc.expectedConfig.workspaces = tc.workspaces
+			conf := Configuration{}
 			err := json.Unmarshal([]byte(tc.config), &conf)
 			assert.NoError(t, err)
 			if tc.expectError {
@@ -85,3 +80,53 @@ func TestConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestExtCodeFilesUpwards(t *testing.T) {
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(subDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "parent"+ExtCodeSuffix), []byte("1"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "both"+ExtCodeSuffix), []byte("2"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(subDir, "both"+ExtCodeSuffix), []byte("3"), 0o600))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(subDir))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	conf := Configuration{}
+	require.NoError(t, json.Unmarshal([]byte(`{"ext_code": {"settings": "4", "both": "5"}, "paths": {"ext_code": {"find_upwards": true}}}`), &conf))
+	assert.Equal(t, map[string]string{"settings": "4", "parent": "1", "both": "3"}, conf.ExtCode)
+}
+
+func TestIndexPersistenceDefault(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings map[string]any
+		expected bool
+	}{
+		{name: "no index block", settings: map[string]any{"log_level": "info"}, expected: true},
+		{name: "not set", settings: map[string]any{"index": map[string]any{"cache_dir": "/tmp"}}, expected: true},
+		{name: "disabled", settings: map[string]any{"index": map[string]any{"enable_persistence": false}}, expected: false},
+		{name: "enabled", settings: map[string]any{"index": map[string]any{"enable_persistence": true}}, expected: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := NewConfiguration(tc.settings)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, conf.Index.PersistenceEnabled())
+		})
+	}
+}
+
+func TestFormattingSettings(t *testing.T) {
+	opts := formatter.DefaultOptions()
+	opts.Indent = 4
+	opts.StringStyle = formatter.StringStyleDouble
+	opts.CommentStyle = formatter.CommentStyleLeave
+
+	settings, err := FormattingSettings(opts)
+	require.NoError(t, err)
+	parsed, err := parseFormattingOpts(settings)
+	require.NoError(t, err)
+	assert.Equal(t, opts, parsed)
+}
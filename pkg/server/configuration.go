@@ -13,7 +13,7 @@ import (
 //
 //nolint:gocyclo
 func (s *Server) DidChangeConfiguration(_ context.Context, params *protocol.DidChangeConfigurationParams) error {
-	settings, err := config.NewConfiguration(params.Settings, s.initParams.WorkspaceFolders)
+	settings, err := config.NewConfiguration(params.Settings)
 	if err != nil {
 		return err
 	}
@@ -21,6 +21,12 @@ func (s *Server) DidChangeConfiguration(_ context.Context, params *protocol.DidC
 	log.SetLevel(settings.LogLevel)
 	log.SetLevel(log.ErrorLevel)
 	s.configuration = *settings
+	s.settings = params.Settings
+	s.resetProjectConfigs()
+	s.refreshWorkspaceFolders()
+	s.cache.InvalidateAll()
+	s.forgetCodeLenses("")
+	go s.indexWorkspace(s.indexFolders())
 
 	log.Infof("configuration updated: %+v", s.configuration)
 
@@ -1133,3 +1133,23 @@ func TestDefinitionFail(t *testing.T) {
 		})
 	}
 }
+
+func TestDefinitionSameImportInDifferentFolders(t *testing.T) {
+	server := NewServer("any", "test version", nil, config.Configuration{})
+	for _, folder := range []string{"a", "b"} {
+		filename := filepath.Join("testdata", "same-import", folder, "main.jsonnet")
+		serverOpenTestFile(t, server, filename)
+		links, err := server.definitionLink(&protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: protocol.URIFromPath(filename)},
+				Position:     protocol.Position{Line: 1, Character: 5},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		// Each file resolves the import relative to itself
+		expected, err := filepath.Abs(filepath.Join("testdata", "same-import", folder, "lib.libsonnet"))
+		require.NoError(t, err)
+		assert.Equal(t, expected, links[0].TargetURI.SpanURI().Filename())
+	}
+}
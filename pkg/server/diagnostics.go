@@ -99,6 +99,7 @@ func (s *Server) diagnosticsLoop() {
 						return
 					}
 
+					enableLint := s.configurationFor(uri.SpanURI().Filename()).Diagnostics.EnableLintDiagnostics
 					diags := []protocol.Diagnostic{}
 					evalChannel := make(chan []protocol.Diagnostic, 1)
 					go func() {
@@ -106,7 +107,7 @@ func (s *Server) diagnosticsLoop() {
 					}()
 
 					lintChannel := make(chan []protocol.Diagnostic, 1)
-					if s.configuration.Diagnostics.EnableLintDiagnostics {
+					if enableLint {
 						go func() {
 							lintChannel <- s.getLintDiags(doc)
 						}()
@@ -114,7 +115,7 @@ func (s *Server) diagnosticsLoop() {
 
 					diags = append(diags, <-evalChannel...)
 
-					if s.configuration.Diagnostics.EnableLintDiagnostics {
+					if enableLint {
 						err = s.client.PublishDiagnostics(context.Background(), &protocol.PublishDiagnosticsParams{
 							URI:         uri,
 							Diagnostics: diags,
@@ -150,7 +151,7 @@ func (s *Server) diagnosticsLoop() {
 }
 
 func (s *Server) getEvalDiags(doc *cache.Document) (diags []protocol.Diagnostic) {
-	if doc.Err == nil && s.configuration.Diagnostics.EnableEvalDiagnostics {
+	if doc.Err == nil && s.configurationFor(doc.Item.URI.SpanURI().Filename()).Diagnostics.EnableEvalDiagnostics {
 		vm := s.getVM(doc.Item.URI.SpanURI().Filename())
 		doc.Val, doc.Err = vm.EvaluateAnonymousSnippet(doc.Item.URI.SpanURI().Filename(), doc.Item.Text)
 	}
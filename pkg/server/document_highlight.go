@@ -0,0 +1,332 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+	sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+func (s *Server) DocumentHighlight(ctx context.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("DocumentHighlight: %s: %w", errorRetrievingDocument, err)
+	}
+	if doc.AST == nil {
+		log.Errorf("DocumentHighlight: %s", errorParsingDocument)
+		return nil, nil
+	}
+	// The desugared AST has no location for the variables of comprehensions and the names of field accesses
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		return nil, utils.LogErrorf("DocumentHighlight: parsing tree: %w", err)
+	}
+
+	location := position.ProtocolToAST(params.Position)
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, utils.LogErrorf("DocumentHighlight: %w", err)
+	}
+
+	var highlights []protocol.DocumentHighlight
+	if binder, id := findBinderAt(doc, root, stack, location); binder != nil {
+		highlights = variableHighlights(doc, root, binder, id)
+	} else {
+		highlights = s.fieldHighlights(doc, root, stack, location)
+	}
+	slices.SortFunc(highlights, func(a, b protocol.DocumentHighlight) int {
+		return cmp.Or(
+			cmp.Compare(a.Range.Start.Line, b.Range.Start.Line),
+			cmp.Compare(a.Range.Start.Character, b.Range.Start.Character),
+		)
+	})
+	return highlights, nil
+}
+
+// findBinderAt returns the node binding the variable, bind, parameter or comprehension variable at the location
+func findBinderAt(doc *cache.Document, root *sitter.Node, stack *nodestack.NodeStack, location ast.Location) (ast.Node, ast.Identifier) {
+	if variable, ok := stack.Peek().(*ast.Var); ok {
+		if variable.Id == "$" {
+			return nil, ""
+		}
+		return processing.FindBinder(doc.AST, variable), variable.Id
+	}
+	if bind, scope := bindAtName(stack, location); bind != nil {
+		return scope, bind.Variable
+	}
+
+	// Functions of binds and methods have no location, so they aren't necessarily part of the stack
+	for _, node := range nodetree.BuildTree(nil, stack.Peek()).GetAllChildren() {
+		if function, ok := node.(*ast.Function); ok {
+			for _, param := range function.Parameters {
+				if param.LocRange.Begin.IsSet() && processing.InRange(location, nameRange(param.LocRange.Begin, param.Name)) {
+					return function, param.Name
+				}
+			}
+		}
+	}
+
+	// The variable of a comprehension. The generated calls of std.flatMap and the object of an object comprehension
+	// have the location of the comprehension
+	comprehension := stack.Peek()
+	for _, forSpec := range forSpecs(root, doc.Item.Text, comprehension.Loc().Begin) {
+		if !processing.InRange(location, forSpec.locRange) {
+			continue
+		}
+		for _, node := range nodetree.BuildTree(nil, doc.AST).GetAllChildren() {
+			if apply, ok := node.(*ast.Apply); ok && apply.LocRange == *comprehension.Loc() {
+				if function := comprehensionFunction(apply); function != nil && processing.Binds(function, forSpec.name) {
+					return function, forSpec.name
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+func variableHighlights(doc *cache.Document, root *sitter.Node, binder ast.Node, id ast.Identifier) []protocol.DocumentHighlight {
+	var highlights []protocol.DocumentHighlight
+	if declaration, ok := declarationRange(doc, root, binder, id); ok {
+		highlights = append(highlights, protocol.DocumentHighlight{
+			Range: position.RangeASTToProtocol(declaration),
+			Kind:  protocol.Write,
+		})
+	}
+	for _, variable := range processing.FindScopeReferences(binder, id) {
+		highlights = append(highlights, protocol.DocumentHighlight{
+			Range: position.RangeASTToProtocol(variable.LocRange),
+			Kind:  protocol.Read,
+		})
+	}
+	return highlights
+}
+
+// declarationRange returns the range of the name of the bind, parameter or comprehension variable
+func declarationRange(doc *cache.Document, root *sitter.Node, binder ast.Node, id ast.Identifier) (ast.LocationRange, bool) {
+	var binds ast.LocalBinds
+	switch binder := binder.(type) {
+	case *ast.Local:
+		binds = binder.Binds
+	case *ast.DesugaredObject:
+		binds = binder.Locals
+	case *ast.Function:
+		for _, param := range binder.Parameters {
+			if param.Name == id && param.LocRange.Begin.IsSet() {
+				return nameRange(param.LocRange.Begin, id), true
+			}
+		}
+		// Generated function of a comprehension. Its parent is the call of std.flatMap with the location of the comprehension
+		path := processing.NodePath(doc.AST, binder)
+		if len(path) < 2 || !path[len(path)-2].Loc().Begin.IsSet() {
+			return ast.LocationRange{}, false
+		}
+		for _, forSpec := range forSpecs(root, doc.Item.Text, path[len(path)-2].Loc().Begin) {
+			if forSpec.name == id {
+				return forSpec.locRange, true
+			}
+		}
+	}
+	for _, bind := range binds {
+		if begin := bindNameLocation(bind); bind.Variable == id && begin.IsSet() {
+			return nameRange(begin, id), true
+		}
+	}
+	return ast.LocationRange{}, false
+}
+
+type forSpec struct {
+	name     ast.Identifier
+	locRange ast.LocationRange
+}
+
+// forSpecs returns the variables of the for specs of the comprehension starting at begin
+func forSpecs(root *sitter.Node, text string, begin ast.Location) []forSpec {
+	offset, err := position.ProtocolToOffset(text, position.ASTToProtocol(begin))
+	if err != nil {
+		return nil
+	}
+	var specs []forSpec
+	for _, variable := range cst.ComprehensionVariables(root, uint(offset)) {
+		name, locRange := cstName(text, variable)
+		specs = append(specs, forSpec{name: name, locRange: locRange})
+	}
+	return specs
+}
+
+// comprehensionFunction returns the generated function of a desugared comprehension `std.flatMap(function(x) ..., arr)`
+func comprehensionFunction(apply *ast.Apply) *ast.Function {
+	for _, arg := range apply.Arguments.Positional {
+		if function, ok := arg.Expr.(*ast.Function); ok && !function.LocRange.Begin.IsSet() {
+			return function
+		}
+	}
+	return nil
+}
+
+// fieldHighlights highlights the field at the location and all its accesses via self, super and $
+func (s *Server) fieldHighlights(doc *cache.Document, root *sitter.Node, stack *nodestack.NodeStack, location ast.Location) []protocol.DocumentHighlight {
+	processor := processing.NewProcessor(s.cache, nil)
+	var name string
+	var declarations []ast.Location
+	if field, fieldName := fieldAtName(stack, location); field != nil {
+		name = fieldName
+		declarations = append(declarations, field.LocRange.Begin)
+	} else if fieldName, rng, ok := fieldAccess(root, doc.Item.Text, stack.Peek()); ok && processing.InRange(location, rng) {
+		name = fieldName
+		declarations = s.fieldDeclarations(doc, rng.Begin)
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+
+	// Accesses via the same object refer to the same fields, so each object is only resolved once
+	resolved := map[accessedObject][]ast.Location{}
+	var highlights []protocol.DocumentHighlight
+	var visit func(tree *nodetree.NodeTree)
+	visit = func(tree *nodetree.NodeTree) {
+		for _, child := range tree.Children {
+			visit(child)
+		}
+		if object, ok := tree.Node.(*ast.DesugaredObject); ok {
+			for _, field := range object.Fields {
+				if slices.Contains(declarations, field.LocRange.Begin) {
+					highlights = append(highlights, protocol.DocumentHighlight{
+						Range: position.RangeASTToProtocol(processor.FieldToRange(field).SelectionRange),
+						Kind:  protocol.Write,
+					})
+				}
+			}
+			return
+		}
+		fieldName, rng, ok := fieldAccess(root, doc.Item.Text, tree.Node)
+		if !ok || fieldName != name {
+			return
+		}
+		object := accessedObjectOf(tree)
+		accessDeclarations, ok := resolved[object]
+		if !ok {
+			accessDeclarations = s.fieldDeclarations(doc, rng.Begin)
+			resolved[object] = accessDeclarations
+		}
+		if slices.ContainsFunc(accessDeclarations, func(declaration ast.Location) bool {
+			return slices.Contains(declarations, declaration)
+		}) {
+			highlights = append(highlights, protocol.DocumentHighlight{
+				Range: position.RangeASTToProtocol(rng),
+				Kind:  protocol.Read,
+			})
+		}
+	}
+	visit(nodetree.BuildTree(nil, doc.AST))
+	return highlights
+}
+
+// accessedObject is the object a field access via `self`, `super` or `$` starts at
+type accessedObject struct {
+	object *ast.DesugaredObject
+	super  bool
+}
+
+// accessedObjectOf returns the object of the field access. `self` and `super` refer to the innermost object, `$` to
+// the outermost one. Field names are evaluated outside of their object
+func accessedObjectOf(tree *nodetree.NodeTree) accessedObject {
+	_, super := tree.Node.(*ast.SuperIndex)
+	dollar := !super && isDollarIndex(tree.Node)
+	var accessed accessedObject
+	for child, parent := tree, tree.Parent; parent != nil; child, parent = parent, parent.Parent {
+		object, ok := parent.Node.(*ast.DesugaredObject)
+		if !ok || slices.ContainsFunc(object.Fields, func(field ast.DesugaredObjectField) bool { return field.Name == child.Node }) {
+			continue
+		}
+		accessed = accessedObject{object: object, super: super}
+		if !dollar {
+			break
+		}
+	}
+	return accessed
+}
+
+func isDollarIndex(node ast.Node) bool {
+	index, ok := node.(*ast.Index)
+	if !ok {
+		return false
+	}
+	variable, ok := index.Target.(*ast.Var)
+	return ok && variable.Id == "$"
+}
+
+// fieldAccess returns the name and its range if the node accesses a field via `self.name`, `super.name` or `$.name`
+func fieldAccess(root *sitter.Node, text string, node ast.Node) (string, ast.LocationRange, bool) {
+	switch node := node.(type) {
+	case *ast.Index:
+		if variable, ok := node.Target.(*ast.Var); !ok || variable.Id != "$" {
+			if _, ok := node.Target.(*ast.Self); !ok {
+				return "", ast.LocationRange{}, false
+			}
+		}
+	case *ast.SuperIndex:
+	default:
+		return "", ast.LocationRange{}, false
+	}
+	if !node.Loc().Begin.IsSet() {
+		return "", ast.LocationRange{}, false
+	}
+	start, err := position.ProtocolToOffset(text, position.ASTToProtocol(node.Loc().Begin))
+	if err != nil {
+		return "", ast.LocationRange{}, false
+	}
+	nameNode := cst.SelfFieldAccess(root, uint(start))
+	if nameNode == nil {
+		// e.g. `self['name']`
+		return "", ast.LocationRange{}, false
+	}
+	name, locRange := cstName(text, nameNode)
+	return string(name), locRange, true
+}
+
+// fieldDeclarations returns the locations of the fields in the document the access at the location refers to
+func (s *Server) fieldDeclarations(doc *cache.Document, location ast.Location) []ast.Location {
+	filename := doc.Item.URI.SpanURI().Filename()
+	links, err := s.findDefinition(doc.AST, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: doc.Item.URI},
+			Position:     position.ASTToProtocol(location),
+		},
+	}, s.getVM(filename))
+	if err != nil {
+		log.Debugf("DocumentHighlight: no definition at %v: %v", location, err)
+		return nil
+	}
+	var declarations []ast.Location
+	for _, link := range links {
+		if link.TargetURI.SpanURI().Filename() == filename {
+			declarations = append(declarations, position.ProtocolToAST(link.TargetRange.Start))
+		}
+	}
+	return declarations
+}
+
+// cstName returns the name of an identifier of the tree-sitter tree and its range
+func cstName(text string, node *sitter.Node) (ast.Identifier, ast.LocationRange) {
+	name := ast.Identifier(text[node.StartByte():node.EndByte()])
+	begin := position.ProtocolToAST(position.OffsetToProtocol(text, int(node.StartByte())))
+	return name, nameRange(begin, name)
+}
+
+// nameRange returns the range of the name starting at begin
+func nameRange(begin ast.Location, name ast.Identifier) ast.LocationRange {
+	end := begin
+	end.Column += len(name)
+	return ast.LocationRange{Begin: begin, End: end}
+}
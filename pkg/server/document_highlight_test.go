@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentHighlight(t *testing.T) {
+	type highlight struct {
+		line, character uint32
+		kind            protocol.DocumentHighlightKind
+	}
+	testCases := []struct {
+		name        string
+		fileContent string
+		position    protocol.Position
+		// Length of all highlighted ranges
+		length   uint32
+		expected []highlight
+	}{
+		{
+			name:        "local from reference",
+			fileContent: "local a = 1;\nlocal b = a + a;\n{ c: b, d: local a = 2; a }",
+			position:    protocol.Position{Line: 1, Character: 10},
+			length:      1,
+			expected:    []highlight{{0, 6, protocol.Write}, {1, 10, protocol.Read}, {1, 14, protocol.Read}},
+		},
+		{
+			name:        "shadowing local from declaration",
+			fileContent: "local a = 1;\nlocal b = a + a;\n{ c: b, d: local a = 2; a }",
+			position:    protocol.Position{Line: 2, Character: 17},
+			length:      1,
+			expected:    []highlight{{2, 17, protocol.Write}, {2, 24, protocol.Read}},
+		},
+		{
+			name:        "recursive local function",
+			fileContent: "local fib(n) = if n < 2 then n else fib(n - 1) + fib(n - 2);\nfib(10)",
+			position:    protocol.Position{Line: 1, Character: 1},
+			length:      3,
+			expected:    []highlight{{0, 6, protocol.Write}, {0, 36, protocol.Read}, {0, 49, protocol.Read}, {1, 0, protocol.Read}},
+		},
+		{
+			name:        "parameter",
+			fileContent: "local x = 3;\nlocal f(x, y=x) = x * y;\nf(x)",
+			position:    protocol.Position{Line: 1, Character: 8},
+			length:      1,
+			expected:    []highlight{{1, 8, protocol.Write}, {1, 13, protocol.Read}, {1, 18, protocol.Read}},
+		},
+		{
+			name:        "object local",
+			fileContent: "{\n  local a = 1,\n  b: a,\n  c: { d: a },\n}",
+			position:    protocol.Position{Line: 3, Character: 10},
+			length:      1,
+			expected:    []highlight{{1, 8, protocol.Write}, {2, 5, protocol.Read}, {3, 10, protocol.Read}},
+		},
+		{
+			name:        "comprehension variable from reference",
+			fileContent: "local x = 1;\n[x + y for x in [x, 2] for y in [x]]",
+			position:    protocol.Position{Line: 1, Character: 1},
+			length:      1,
+			expected:    []highlight{{1, 1, protocol.Read}, {1, 11, protocol.Write}, {1, 33, protocol.Read}},
+		},
+		{
+			name:        "comprehension variable from declaration",
+			fileContent: "{ [k]: k for k in ['a', 'b'] }",
+			position:    protocol.Position{Line: 0, Character: 13},
+			length:      1,
+			expected:    []highlight{{0, 3, protocol.Read}, {0, 7, protocol.Read}, {0, 13, protocol.Write}},
+		},
+		{
+			name:        "comprehension variable after a string",
+			fileContent: "[x + 'for x in' for x in [1]]",
+			position:    protocol.Position{Line: 0, Character: 1},
+			length:      1,
+			expected:    []highlight{{0, 1, protocol.Read}, {0, 20, protocol.Write}},
+		},
+		{
+			name:        "field via self",
+			fileContent: "{\n  a: 1,\n  b: self.a,\n  c: { a: 2, d: self.a },\n}",
+			position:    protocol.Position{Line: 1, Character: 2},
+			length:      1,
+			expected:    []highlight{{1, 2, protocol.Write}, {2, 10, protocol.Read}},
+		},
+		{
+			name:        "field via self with a comment",
+			fileContent: "{\n  a: 1,\n  b: self /* x */.a,\n}",
+			position:    protocol.Position{Line: 1, Character: 2},
+			length:      1,
+			expected:    []highlight{{1, 2, protocol.Write}, {2, 18, protocol.Read}},
+		},
+		{
+			name:        "field via self and $ in nested objects",
+			fileContent: "{\n  a: 1,\n  b: self.a + $.a,\n  c: { a: 2, d: self.a, e: $.a },\n}",
+			position:    protocol.Position{Line: 1, Character: 2},
+			length:      1,
+			expected:    []highlight{{1, 2, protocol.Write}, {2, 10, protocol.Read}, {2, 16, protocol.Read}, {3, 29, protocol.Read}},
+		},
+		{
+			name:        "field via $",
+			fileContent: "{\n  a: 1,\n  b: { c: $.a, a: 2 },\n}",
+			position:    protocol.Position{Line: 2, Character: 12},
+			length:      1,
+			expected:    []highlight{{1, 2, protocol.Write}, {2, 12, protocol.Read}},
+		},
+		{
+			name:        "field via super",
+			fileContent: "{ a: 1 } + { b: super.a }",
+			position:    protocol.Position{Line: 0, Character: 22},
+			length:      1,
+			expected:    []highlight{{0, 2, protocol.Write}, {0, 22, protocol.Read}},
+		},
+		{
+			name:        "std",
+			fileContent: "std.length([])",
+			position:    protocol.Position{Line: 0, Character: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+			highlights, err := server.DocumentHighlight(context.Background(), &protocol.DocumentHighlightParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+					Position:     tc.position,
+				},
+			})
+			require.NoError(t, err)
+
+			var expected []protocol.DocumentHighlight
+			for _, h := range tc.expected {
+				expected = append(expected, protocol.DocumentHighlight{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: h.line, Character: h.character},
+						End:   protocol.Position{Line: h.line, Character: h.character + tc.length},
+					},
+					Kind: h.kind,
+				})
+			}
+			assert.Equal(t, expected, highlights)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// documentLinkData is sent to the client with each document link. The import is resolved in documentLink/resolve
+type documentLinkData struct {
+	URI  protocol.DocumentURI `json:"uri"`
+	Path string               `json:"path"`
+}
+
+// DocumentLink returns a link for the path of every import. The paths are resolved lazily, since documents can have many imports
+func (s *Server) DocumentLink(_ context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("DocumentLink: %s: %w", errorRetrievingDocument, err)
+	}
+
+	if doc.AST == nil {
+		log.Errorf("DocumentLink: %s", errorParsingDocument)
+		return nil, nil
+	}
+
+	var links []protocol.DocumentLink
+	for _, node := range processing.FindImports(doc.AST) {
+		importPath, _ := processing.ImportPath(node)
+		rng, ok := importPathRange(doc.Item.Text, node, importPath)
+		if !ok || doc.LinesChangedSinceAST[int(rng.Start.Line)] {
+			continue
+		}
+		links = append(links, protocol.DocumentLink{
+			Range: rng,
+			Data:  documentLinkData{URI: params.TextDocument.URI, Path: importPath},
+		})
+	}
+	slices.SortFunc(links, func(a, b protocol.DocumentLink) int {
+		return cmp.Or(
+			cmp.Compare(a.Range.Start.Line, b.Range.Start.Line),
+			cmp.Compare(a.Range.Start.Character, b.Range.Start.Character),
+		)
+	})
+	return links, nil
+}
+
+func (s *Server) ResolveDocumentLink(_ context.Context, link *protocol.DocumentLink) (*protocol.DocumentLink, error) {
+	// The data is either still our struct or was decoded from json into a map
+	raw, err := json.Marshal(link.Data)
+	if err != nil {
+		return nil, utils.LogErrorf("ResolveDocumentLink: encoding document link data: %w", err)
+	}
+	var data documentLinkData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, utils.LogErrorf("ResolveDocumentLink: decoding document link data: %w", err)
+	}
+
+	filename := data.URI.SpanURI().Filename()
+	foundAt, err := s.getVM(filename).ResolveImport(filename, data.Path)
+	if err != nil {
+		link.Tooltip = s.unresolvedImportTooltip(filename, data.Path)
+		return link, nil
+	}
+	if abs, err := filepath.Abs(foundAt); err == nil {
+		foundAt = abs
+	}
+	link.Target = string(protocol.URIFromPath(foundAt))
+	return link, nil
+}
+
+// unresolvedImportTooltip lists the directories searched for the import in the order they are searched
+func (s *Server) unresolvedImportTooltip(filename, importPath string) string {
+	if filepath.IsAbs(importPath) {
+		return fmt.Sprintf("%s does not exist", importPath)
+	}
+	// The directory of the file is searched first, then the jpaths starting with the last one
+	dirs := []string{filepath.Dir(filename)}
+	for _, jpath := range slices.Backward(s.importJPaths(filename)) {
+		if !slices.Contains(dirs, jpath) {
+			dirs = append(dirs, jpath)
+		}
+	}
+	return fmt.Sprintf("Unable to find %s in:\n%s", importPath, strings.Join(dirs, "\n"))
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentLink(t *testing.T) {
+	fixture := newTestFixture(t, "document-link")
+	vendor := fixture.path("vendor")
+	server := testServer(t, nil)
+	server.configuration.JPaths = []string{vendor}
+	fileURI, _ := fixture.open(t, server, "main.jsonnet")
+
+	links, err := server.DocumentLink(context.Background(), &protocol.DocumentLinkParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}})
+	require.NoError(t, err)
+	require.Len(t, links, 4)
+
+	expected := []struct {
+		rng     protocol.Range
+		target  string
+		tooltip string
+	}{
+		{
+			rng:    protocol.Range{Start: protocol.Position{Line: 0, Character: 18}, End: protocol.Position{Line: 0, Character: 33}},
+			target: string(protocol.URIFromPath(fixture.path("lib/a.libsonnet"))),
+		},
+		{
+			rng:    protocol.Range{Start: protocol.Position{Line: 1, Character: 18}, End: protocol.Position{Line: 1, Character: 29}},
+			target: string(protocol.URIFromPath(filepath.Join(vendor, "b.libsonnet"))),
+		},
+		{
+			rng:    protocol.Range{Start: protocol.Position{Line: 2, Character: 24}, End: protocol.Position{Line: 2, Character: 36}},
+			target: string(protocol.URIFromPath(fixture.path("lib/data.txt"))),
+		},
+		{
+			rng:     protocol.Range{Start: protocol.Position{Line: 3, Character: 27}, End: protocol.Position{Line: 3, Character: 38}},
+			tooltip: "Unable to find missing.bin in:\n" + fixture.dir + "\n" + vendor,
+		},
+	}
+	for i, link := range links {
+		assert.Equal(t, expected[i].rng, link.Range)
+		// Links are resolved lazily
+		assert.Empty(t, link.Target)
+
+		resolved, err := server.ResolveDocumentLink(context.Background(), &link)
+		require.NoError(t, err)
+		assert.Equal(t, expected[i].target, resolved.Target)
+		assert.Equal(t, expected[i].tooltip, resolved.Tooltip)
+	}
+}
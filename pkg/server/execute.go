@@ -3,31 +3,52 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
 	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
 	"github.com/grafana/jsonnet-language-server/pkg/utils"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
-	log "github.com/sirupsen/logrus"
 )
 
 func (s *Server) ExecuteCommand(_ context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
 	switch params.Command {
 	case "jsonnet.evalItem":
-		// WIP
 		return s.evalItem(params)
 	case "jsonnet.evalFile":
 		params.Arguments = append(params.Arguments, json.RawMessage("\"\""))
 		return s.evalExpression(params)
 	case "jsonnet.evalExpression":
 		return s.evalExpression(params)
+	case createFileCommand:
+		return s.createFile(params)
 	}
 
 	return nil, fmt.Errorf("unknown command: %s", params.Command)
 }
 
+// evalItemResult is the result of jsonnet.evalItem. Either the manifested JSON or the error is set
+type evalItemResult struct {
+	// Range of the evaluated expression
+	Range  protocol.Range `json:"range"`
+	Result string         `json:"result,omitempty"`
+	Error  *evalError     `json:"error,omitempty"`
+}
+
+type evalError struct {
+	Message string `json:"message"`
+	// Location where the error was raised. Not set if it is unknown
+	Location *protocol.Location `json:"location,omitempty"`
+}
+
+// evalItem evaluates the expression at the position in its lexical context
 func (s *Server) evalItem(params *protocol.ExecuteCommandParams) (interface{}, error) {
 	args := params.Arguments
 	if len(args) != 2 {
@@ -48,27 +69,63 @@ func (s *Server) evalItem(params *protocol.ExecuteCommandParams) (interface{}, e
 		return nil, utils.LogErrorf("evalItem: %s: %w", errorRetrievingDocument, err)
 	}
 
-	stack, err := processing.FindNodeByPosition(doc.AST, position.ProtocolToAST(p))
+	if doc.AST == nil {
+		return nil, utils.LogErrorf("evalItem: %s", errorParsingDocument)
+	}
+	if err := parseError(doc); err != nil {
+		// The node at the position could belong to code that no longer exists
+		return nil, utils.LogErrorf("evalItem: %s: %w", errorParsingDocument, err)
+	}
+
+	node, expression, err := processing.NodeInScope(doc.AST, position.ProtocolToAST(p))
 	if err != nil {
 		return nil, err
 	}
 
-	if stack.IsEmpty() {
-		return nil, fmt.Errorf("no node found at position %v", p)
+	// Methods don't have a location
+	result := evalItemResult{Range: protocol.Range{Start: p, End: p}}
+	if node.Loc().Begin.IsSet() {
+		result.Range = position.RangeASTToProtocol(*node.Loc())
 	}
+	output, err := s.getVM(fileName).Evaluate(expression)
+	if err != nil {
+		result.Error = newEvalError(err)
+		return result, nil
+	}
+	result.Result = output
+	return result, nil
+}
 
-	log.Infof("fileName: %s", fileName)
-	log.Infof("position: %+v", p)
-
-	node := stack.Pop()
-
-	return nil, fmt.Errorf("%v: %+v", reflect.TypeOf(node), node)
+// newEvalError locates the error at the innermost frame of its stack trace with a location. The stack trace starts with the outermost frame
+func newEvalError(err error) *evalError {
+	var runtimeError jsonnet.RuntimeError
+	if !errors.As(err, &runtimeError) {
+		return &evalError{Message: err.Error()}
+	}
+	evalErr := &evalError{Message: runtimeError.Msg}
+	for _, frame := range slices.Backward(runtimeError.StackTrace) {
+		if frame.Loc.FileName == "" || !frame.Loc.Begin.IsSet() {
+			continue
+		}
+		fileName := frame.Loc.FileName
+		if abs, err := filepath.Abs(fileName); err == nil {
+			fileName = abs
+		}
+		evalErr.Location = &protocol.Location{
+			URI:   protocol.URIFromPath(fileName),
+			Range: position.RangeASTToProtocol(frame.Loc),
+		}
+		break
+	}
+	return evalErr
 }
 
+// evalExpression evaluates the expression on the result of the file, e.g. `a.b` or `["a-b"]`. With a third argument set to true,
+// the expression is evaluated in the scope of the locals at the start of the file instead, e.g. `f()`
 func (s *Server) evalExpression(params *protocol.ExecuteCommandParams) (interface{}, error) {
 	args := params.Arguments
-	if len(args) != 2 {
-		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("expected 2 or 3 arguments, got %d", len(args))
 	}
 
 	var fileName string
@@ -80,13 +137,52 @@ func (s *Server) evalExpression(params *protocol.ExecuteCommandParams) (interfac
 		return nil, fmt.Errorf("failed to unmarshal expression: %v", err)
 	}
 
+	if len(args) == 3 {
+		var inTopLevelLocals bool
+		if err := json.Unmarshal(args[2], &inTopLevelLocals); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scope: %v", err)
+		}
+		if inTopLevelLocals {
+			return s.evalInTopLevelLocals(fileName, expression)
+		}
+	}
+
 	// TODO: Replace this stuff with Tanka's `eval` code
 	vm := s.getVM(fileName)
 
-	script := fmt.Sprintf("local main = (import '%s');\nmain", fileName)
-	if expression != "" {
-		script += "." + expression
+	selector := ""
+	switch {
+	case strings.HasPrefix(expression, "["):
+		selector = expression
+	case expression != "":
+		selector = "." + expression
 	}
 
-	return vm.EvaluateAnonymousSnippet(fileName, script)
+	// Open documents are evaluated with their unsaved content
+	doc, err := s.cache.Get(protocol.URIFromPath(fileName))
+	if err != nil || doc.AST == nil {
+		return vm.EvaluateAnonymousSnippet(fileName, fmt.Sprintf("local main = (import '%s');\nmain%s", fileName, selector))
+	}
+	if err := parseError(doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", errorParsingDocument, err)
+	}
+	node, err := jsonnet.SnippetToAST(fileName, "local main = null;\nmain"+selector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+	local, ok := node.(*ast.Local)
+	if !ok {
+		return nil, fmt.Errorf("unexpected expression %T", node)
+	}
+	local.Binds[0].Body = doc.AST
+	return vm.Evaluate(local)
+}
+
+// parseError returns the error of parsing the document. The AST of the document is repaired or outdated then.
+// Evaluation errors of the diagnostics are ignored, they don't affect the AST
+func parseError(doc *cache.Document) error {
+	if doc.Err == nil || strings.HasPrefix(doc.Err.Error(), "RUNTIME ERROR:") {
+		return nil
+	}
+	return doc.Err
 }
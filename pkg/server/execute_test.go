@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalItem(t *testing.T) {
+	fixture := newTestFixture(t, "eval")
+	filename := fixture.path("main.jsonnet")
+	server := testServer(t, nil)
+	fixture.open(t, server, "main.jsonnet")
+
+	testCases := []struct {
+		name     string
+		position protocol.Position
+		expected evalItemResult
+	}{
+		{
+			name:     "expression",
+			position: protocol.Position{Line: 2, Character: 16},
+			expected: evalItemResult{
+				Range:  protocol.Range{Start: protocol.Position{Line: 2, Character: 5}, End: protocol.Position{Line: 2, Character: 18}},
+				Result: "2\n",
+			},
+		},
+		{
+			name:     "field",
+			position: protocol.Position{Line: 2, Character: 2},
+			expected: evalItemResult{
+				Range:  protocol.Range{Start: protocol.Position{Line: 2, Character: 5}, End: protocol.Position{Line: 2, Character: 18}},
+				Result: "2\n",
+			},
+		},
+		{
+			// Functions are called with their default arguments
+			name:     "method",
+			position: protocol.Position{Line: 4, Character: 2},
+			expected: evalItemResult{
+				Range:  protocol.Range{Start: protocol.Position{Line: 4, Character: 2}, End: protocol.Position{Line: 4, Character: 12}},
+				Result: "1\n",
+			},
+		},
+		{
+			name:     "error in import",
+			position: protocol.Position{Line: 3, Character: 10},
+			expected: evalItemResult{
+				Range: protocol.Range{Start: protocol.Position{Line: 3, Character: 5}, End: protocol.Position{Line: 3, Character: 15}},
+				Error: &evalError{
+					Message: "broken",
+					Location: &protocol.Location{
+						URI:   protocol.URIFromPath(fixture.path("lib.libsonnet")),
+						Range: protocol.Range{Start: protocol.Position{Line: 2, Character: 10}, End: protocol.Position{Line: 2, Character: 24}},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			position, err := json.Marshal(tc.position)
+			require.NoError(t, err)
+			result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   "jsonnet.evalItem",
+				Arguments: []json.RawMessage{mustMarshal(filename), position},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestEvalItemParseError(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "{\n  a: 1,\n}\n")
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{\n  a: 1,\n  b: \n}\n"}},
+	}))
+
+	_, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "jsonnet.evalItem",
+		Arguments: []json.RawMessage{mustMarshal(fileURI.SpanURI().Filename()), mustMarshal(protocol.Position{Line: 1, Character: 5})},
+	})
+	assert.ErrorContains(t, err, errorParsingDocument)
+}
+
+func TestEvalExpressionUnsavedDocument(t *testing.T) {
+	fixture := newTestFixture(t, "eval")
+	filename := fixture.path("main.jsonnet")
+	server := testServer(t, nil)
+	fileURI, _ := fixture.open(t, server, "main.jsonnet")
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{ a: 2, 'b-c': 3 }\n"}},
+	}))
+
+	for expression, expected := range map[string]string{"a": "2\n", `["b-c"]`: "3\n"} {
+		result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+			Command:   "jsonnet.evalExpression",
+			Arguments: []json.RawMessage{mustMarshal(filename), mustMarshal(expression)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestEvalExpressionDocumentErrors(t *testing.T) {
+	fixture := newTestFixture(t, "eval")
+	filename := fixture.path("main.jsonnet")
+	server := testServer(t, nil)
+	fileURI, _ := fixture.open(t, server, "main.jsonnet")
+	change := func(version int32, text string) {
+		require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+			TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI}, Version: version},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: text}},
+		}))
+	}
+	evaluate := func(expression string) (interface{}, error) {
+		return server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+			Command:   "jsonnet.evalExpression",
+			Arguments: []json.RawMessage{mustMarshal(filename), mustMarshal(expression)},
+		})
+	}
+
+	// Evaluation errors of the diagnostics don't affect the AST
+	change(2, "{ a: error 'broken', b: 1 }\n")
+	server.configuration.Diagnostics.EnableEvalDiagnostics = true
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+	server.getEvalDiags(doc)
+	require.Error(t, doc.Err)
+	result, err := evaluate("b")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", result)
+
+	// The repaired AST doesn't match the text of the document
+	change(3, "{ a: 1, b: }\n")
+	_, err = evaluate("a")
+	assert.ErrorContains(t, err, errorParsingDocument)
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const createFileCommand = "jsonnet.createFile"
+
+// fileExtraction describes a bind or field body that is moved into a new file
+type fileExtraction struct {
+	name string
+	body ast.Node
+	// Free variables of the body. They become parameters of the function in the new file
+	params []string
+}
+
+func (s *Server) extractFileActions(doc *cache.Document, pos protocol.Position) []protocol.CodeAction {
+	ex, err := findFileExtraction(doc, pos)
+	if err != nil {
+		return nil
+	}
+	filename := doc.Item.URI.SpanURI().Filename()
+
+	var actions []protocol.CodeAction
+	for _, dir := range s.extractFileDirs(filename) {
+		target := unusedFilename(dir, ex.name, filepath.Dir(filename))
+		content, err := ex.fileContent(doc.Item.Text)
+		if err != nil {
+			return nil
+		}
+		command, err := createFileCommandFor(target, content)
+		if err != nil {
+			return nil
+		}
+		displayPath, err := filepath.Rel(filepath.Dir(filename), target)
+		if err != nil {
+			displayPath = target
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: fmt.Sprintf("Extract `%s` to new file `%s`", ex.name, filepath.ToSlash(displayPath)),
+			Kind:  protocol.RefactorExtract,
+			// The edit is applied first. The file is created by the command afterwards
+			Command: command,
+			Data: codeActionData{
+				Fix:         fixExtractFile,
+				URI:         doc.Item.URI,
+				Range:       protocol.Range{Start: pos, End: pos},
+				Name:        ex.name,
+				Replacement: target,
+			},
+		})
+	}
+	return actions
+}
+
+func (s *Server) extractFileEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	ex, err := findFileExtraction(doc, data.Range.Start)
+	if err != nil {
+		return nil, err
+	}
+	filename := doc.Item.URI.SpanURI().Filename()
+	importPath := shortestImportPath(data.Replacement, s.importJPaths(filename))
+	if importPath == "" {
+		// Not below any search path, e.g. `../lib/file.libsonnet`
+		rel, err := filepath.Rel(filepath.Dir(filename), data.Replacement)
+		if err != nil {
+			return nil, err
+		}
+		importPath = filepath.ToSlash(rel)
+	}
+
+	newText := fmt.Sprintf("import '%s'", importPath)
+	if len(ex.params) > 0 {
+		newText = fmt.Sprintf("(%s)(%s)", newText, strings.Join(ex.params, ", "))
+	}
+	return []protocol.TextEdit{{
+		Range:   position.RangeASTToProtocol(*ex.body.Loc()),
+		NewText: newText,
+	}}, nil
+}
+
+// findFileExtraction finds the bind or field whose name is at the position
+func findFileExtraction(doc *cache.Document, pos protocol.Position) (*fileExtraction, error) {
+	if doc.AST == nil {
+		return nil, fmt.Errorf("%s", errorParsingDocument)
+	}
+	location := position.ProtocolToAST(pos)
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, err
+	}
+
+	ex := &fileExtraction{}
+	var nameStart ast.Location
+	if bind, _ := bindAtName(stack, location); bind != nil {
+		ex.name, ex.body, nameStart = string(bind.Variable), bind.Body, bindNameLocation(*bind)
+	} else if field, name := fieldAtName(stack, location); field != nil && !field.PlusSuper {
+		ex.name, ex.body, nameStart = name, field.Body, field.LocRange.Begin
+	} else {
+		return nil, fmt.Errorf("no bind or field at %v", location)
+	}
+	if bodyStart := ex.body.Loc().Begin; !bodyStart.IsSet() || bodyStart == nameStart {
+		// e.g. the function of `f(x): x`. Its location is either unset or the one of the whole field
+		return nil, fmt.Errorf("unable to extract %s", ex.name)
+	}
+	if usesSelf(ex.body) {
+		return nil, fmt.Errorf("%s refers to its object", ex.name)
+	}
+
+	for _, variable := range ex.body.FreeVariables() {
+		switch variable {
+		case "std", "$std":
+			continue
+		case "$", ast.Identifier(ex.name):
+			// The root object or the bind itself can't be passed to the new file
+			return nil, fmt.Errorf("unable to extract %s using %s", ex.name, variable)
+		}
+		ex.params = append(ex.params, string(variable))
+	}
+	slices.Sort(ex.params)
+	return ex, nil
+}
+
+// fieldAtName returns the field of the innermost object whose name is at the location. Only fields with a fixed name are considered
+func fieldAtName(stack *nodestack.NodeStack, location ast.Location) (*ast.DesugaredObjectField, string) {
+	for i := len(stack.Stack) - 1; i >= 0; i-- {
+		object, ok := stack.Stack[i].(*ast.DesugaredObject)
+		if !ok {
+			continue
+		}
+		for j := range object.Fields {
+			field := &object.Fields[j]
+			name, ok := field.Name.(*ast.LiteralString)
+			if !ok || !field.LocRange.Begin.IsSet() {
+				continue
+			}
+			nameRange := ast.LocationRange{Begin: field.LocRange.Begin, End: field.LocRange.Begin}
+			nameRange.End.Column += len(name.Value)
+			if processing.InRange(location, nameRange) {
+				return field, name.Value
+			}
+		}
+	}
+	return nil, ""
+}
+
+// fileContent returns the content of the new file. Free variables become function parameters
+func (ex *fileExtraction) fileContent(text string) (string, error) {
+	loc := ex.body.Loc()
+	start, err := position.ProtocolToOffset(text, position.ASTToProtocol(loc.Begin))
+	if err != nil {
+		return "", err
+	}
+	end, err := position.ProtocolToOffset(text, position.ASTToProtocol(loc.End))
+	if err != nil {
+		return "", err
+	}
+	lines := dedent(strings.Split(text[start:end], "\n"))
+	if len(ex.params) > 0 {
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = "  " + line
+			}
+		}
+		lines = append([]string{fmt.Sprintf("function(%s)", strings.Join(ex.params, ", "))}, lines...)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// dedent removes the common indentation of all but the first line. The first line starts after the name of the bind or field
+func dedent(lines []string) []string {
+	indent := -1
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lineIndent := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	return lines
+}
+
+// extractFileDirs returns the directories new files can be created in: the one of the document and the jpaths
+func (s *Server) extractFileDirs(filename string) []string {
+	dirs := []string{filepath.Dir(filename)}
+	for _, jpath := range s.importJPaths(filename) {
+		jpath, err := filepath.Abs(jpath)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(jpath); err == nil && info.IsDir() && !slices.Contains(dirs, jpath) {
+			dirs = append(dirs, jpath)
+		}
+	}
+	return dirs
+}
+
+// unusedFilename returns a path for `name.libsonnet` in dir that doesn't exist yet. The file must also not exist next to the
+// document, since relative imports are resolved there first
+func unusedFilename(dir, name, documentDir string) string {
+	exists := func(base string) bool {
+		for _, d := range []string{dir, documentDir} {
+			if _, err := os.Stat(filepath.Join(d, base)); !errors.Is(err, fs.ErrNotExist) {
+				return true
+			}
+		}
+		return false
+	}
+	base := name + ".libsonnet"
+	for i := 1; exists(base); i++ {
+		base = fmt.Sprintf("%s%d.libsonnet", name, i)
+	}
+	return filepath.Join(dir, base)
+}
+
+func createFileCommandFor(filename, content string) (*protocol.Command, error) {
+	uri, err := json.Marshal(protocol.URIFromPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	contentArg, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.Command{
+		Title:     "Create file",
+		Command:   createFileCommand,
+		Arguments: []json.RawMessage{uri, contentArg},
+	}, nil
+}
+
+// createFile creates a new file with the given content. Existing files are never overwritten
+func (s *Server) createFile(params *protocol.ExecuteCommandParams) (interface{}, error) {
+	args := params.Arguments
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+	var uri protocol.DocumentURI
+	if err := json.Unmarshal(args[0], &uri); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal uri: %v", err)
+	}
+	var content string
+	if err := json.Unmarshal(args[1], &content); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal content: %v", err)
+	}
+
+	filename := uri.SpanURI().Filename()
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return nil, fmt.Errorf("creating directory of %s: %w", filename, err)
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", filename, err)
+	}
+	if err := s.index.UpdateFile(filename); err != nil {
+		return nil, fmt.Errorf("indexing %s: %w", filename, err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFile(t *testing.T) {
+	testCases := []struct {
+		name             string
+		filename         string
+		cursorAt         string
+		expectedTitles   []string
+		expectedDocument string
+		expectedFile     string
+	}{
+		{
+			name:             "local without free variables",
+			filename:         "local.jsonnet",
+			cursorAt:         "config =",
+			expectedTitles:   []string{"Extract `config` to new file `config.libsonnet`", "Extract `config` to new file `lib/config.libsonnet`"},
+			expectedDocument: "local config = import 'config.libsonnet';\nconfig\n",
+			expectedFile:     "{\n  replicas: 3,\n}\n",
+		},
+		{
+			name:             "field with free variables",
+			filename:         "field.jsonnet",
+			cursorAt:         "deployment",
+			expectedTitles:   []string{"Extract `deployment` to new file `deployment.libsonnet`", "Extract `deployment` to new file `lib/deployment.libsonnet`"},
+			expectedDocument: "local replicas = 3;\nlocal name = 'app';\n{\n  deployment: (import 'deployment.libsonnet')(name, replicas),\n}\n",
+			expectedFile:     "function(name, replicas)\n  {\n    name: name,\n    replicas: std.max(replicas, 1),\n  }\n",
+		},
+		{
+			name:     "field using self",
+			filename: "self.jsonnet",
+			cursorAt: "b:",
+		},
+		{
+			name:             "self of a nested object",
+			filename:         "nested-self.jsonnet",
+			cursorAt:         "b:",
+			expectedTitles:   []string{"Extract `b` to new file `b.libsonnet`", "Extract `b` to new file `lib/b.libsonnet`"},
+			expectedDocument: "{\n  a: 1,\n  b: import 'b.libsonnet',\n}\n",
+			expectedFile:     "{ c: self.d, d: 2 }\n",
+		},
+		{
+			name:     "local function",
+			filename: "local-function.jsonnet",
+			cursorAt: "f(x)",
+		},
+		{
+			name:     "method",
+			filename: "method.jsonnet",
+			cursorAt: "f(x)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := newTestFixture(t, "extract-file")
+			require.NoError(t, os.Mkdir(fixture.path("lib"), 0o755))
+
+			server := testServer(t, nil)
+			server.configuration.JPaths = []string{fixture.path("lib")}
+			fileURI, content := fixture.open(t, server, tc.filename)
+
+			params := &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Range:        rangeOf(t, content, tc.cursorAt),
+				Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorExtract}},
+			}
+			params.Range.End = params.Range.Start
+			actions, err := server.CodeAction(context.Background(), params)
+			require.NoError(t, err)
+
+			var titles []string
+			for _, action := range actions {
+				titles = append(titles, action.Title)
+			}
+			require.Equal(t, tc.expectedTitles, titles)
+			if len(actions) == 0 {
+				return
+			}
+
+			// Edit first, then the command creates the file
+			assert.Equal(t, tc.expectedDocument, applyTextEdits(t, content, actions[0].Edit.Changes[fileURI]))
+			_, err = server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   actions[0].Command.Command,
+				Arguments: actions[0].Command.Arguments,
+			})
+			require.NoError(t, err)
+			var createdURI protocol.DocumentURI
+			require.NoError(t, json.Unmarshal(actions[0].Command.Arguments[0], &createdURI))
+			created, err := os.ReadFile(createdURI.SpanURI().Filename())
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFile, string(created))
+
+			// Existing files are not overwritten
+			_, err = server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   actions[0].Command.Command,
+				Arguments: actions[0].Command.Arguments,
+			})
+			assert.Error(t, err)
+		})
+	}
+}
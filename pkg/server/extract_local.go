@@ -0,0 +1,350 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/google/go-jsonnet/toolutils"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+const extractedLocalName = "extracted"
+
+// wordRegexp matches the words of a text, including keywords and words in strings and comments
+var wordRegexp = regexp.MustCompile(`\w+`)
+
+// extraction describes how the selected expression is moved into a new local
+type extraction struct {
+	expr     ast.Node
+	exprText string
+	// The Local, Function or DesugaredObject the new local is added to
+	scope ast.Node
+	// Offset the new local is inserted at and the separator following it
+	insertOffset int
+	separator    string
+	// The local is inserted at the start of the document and visible everywhere
+	documentStart bool
+	// Ranges of all identical expressions in the scope, including the selected one
+	occurrences []ast.LocationRange
+}
+
+func extractLocalActions(doc *cache.Document, rng protocol.Range) []protocol.CodeAction {
+	if rng.Start == rng.End {
+		return nil
+	}
+	ex, err := findExtraction(doc, rng)
+	if err != nil {
+		return nil
+	}
+	name := unusedIdentifier(doc.Item.Text, extractedLocalName)
+	newAction := func(title string, all bool) protocol.CodeAction {
+		return protocol.CodeAction{
+			Title: title,
+			Kind:  protocol.RefactorExtract,
+			Data: codeActionData{
+				Fix:   fixExtractLocal,
+				URI:   doc.Item.URI,
+				Range: rng,
+				Name:  name,
+				All:   all,
+			},
+		}
+	}
+
+	actions := []protocol.CodeAction{newAction(fmt.Sprintf("Extract to local `%s`", name), false)}
+	if len(ex.occurrences) > 1 {
+		actions = append(actions, newAction(fmt.Sprintf("Extract all %d occurrences to local `%s`", len(ex.occurrences), name), true))
+	}
+	return actions
+}
+
+func extractLocalEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	ex, err := findExtraction(doc, data.Range)
+	if err != nil {
+		return nil, err
+	}
+	text := doc.Item.Text
+
+	occurrences := ex.occurrences
+	if !data.All {
+		occurrences = []ast.LocationRange{*ex.expr.Loc()}
+	}
+
+	insertText := fmt.Sprintf("local %s = %s%s", data.Name, ex.exprText, ex.separator)
+	lineStart := strings.LastIndexByte(text[:ex.insertOffset], '\n') + 1
+	if indent := text[lineStart:ex.insertOffset]; strings.TrimSpace(indent) == "" {
+		insertText += "\n" + indent
+	} else {
+		insertText += " "
+	}
+
+	var edits []protocol.TextEdit
+	inserted := false
+	for _, occurrence := range occurrences {
+		occurrenceRange := position.RangeASTToProtocol(occurrence)
+		newText := data.Name
+		if occurrenceRange.Start == position.OffsetToProtocol(text, ex.insertOffset) {
+			// Edits must not overlap. Insert the local together with the replacement
+			newText = insertText + newText
+			inserted = true
+		}
+		edits = append(edits, protocol.TextEdit{Range: occurrenceRange, NewText: newText})
+	}
+	if !inserted {
+		insertPos := position.OffsetToProtocol(text, ex.insertOffset)
+		edits = append(edits, protocol.TextEdit{Range: protocol.Range{Start: insertPos, End: insertPos}, NewText: insertText})
+	}
+	return edits, nil
+}
+
+// findExtraction finds the expression matching the range and the outermost scope it can be moved to
+func findExtraction(doc *cache.Document, rng protocol.Range) (*extraction, error) {
+	if doc.AST == nil {
+		return nil, fmt.Errorf("%s", errorParsingDocument)
+	}
+	text := doc.Item.Text
+	start, err := position.ProtocolToOffset(text, rng.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := position.ProtocolToOffset(text, rng.End)
+	if err != nil {
+		return nil, err
+	}
+	// Selections often include surrounding whitespace
+	for start < end && strings.ContainsRune(" \t\r\n", rune(text[start])) {
+		start++
+	}
+	for end > start && strings.ContainsRune(" \t\r\n", rune(text[end-1])) {
+		end--
+	}
+	if start == end {
+		return nil, fmt.Errorf("empty selection")
+	}
+	selection := protocol.Range{Start: position.OffsetToProtocol(text, start), End: position.OffsetToProtocol(text, end)}
+
+	stack, err := processing.FindNodeByPosition(doc.AST, position.ProtocolToAST(selection.Start))
+	if err != nil {
+		return nil, err
+	}
+	// Use the deepest node if multiple nodes span the selection
+	exprIndex := -1
+	for i := len(stack.Stack) - 1; i >= 0 && exprIndex < 0; i-- {
+		if node := stack.Stack[i]; node.Loc().Begin.IsSet() && position.RangeASTToProtocol(*node.Loc()) == selection {
+			exprIndex = i
+		}
+	}
+	if exprIndex < 0 {
+		return nil, fmt.Errorf("selection is no expression")
+	}
+	expr := stack.Stack[exprIndex]
+	for _, node := range stack.Stack[:exprIndex] {
+		if object, ok := node.(*ast.DesugaredObject); ok && isObjectFieldPart(object, expr) {
+			return nil, fmt.Errorf("selection is no expression")
+		}
+	}
+
+	freeVariables := expr.FreeVariables()
+	selfUsed := usesSelf(expr)
+	exprRange := *expr.Loc()
+
+	// Everything above the innermost binding of a free variable can't see it
+	minDepth, bound := 0, false
+	for i, node := range stack.Stack[:exprIndex] {
+		if bindsAny(node, freeVariables, selfUsed) {
+			minDepth, bound = i, true
+		}
+	}
+	for _, variable := range freeVariables {
+		// Generated nodes without a location, e.g. the functions of comprehensions, are not part of the stack
+		if variable != "$std" && !slices.ContainsFunc(stack.Stack[:exprIndex], func(node ast.Node) bool {
+			return bindsAny(node, ast.Identifiers{variable}, false)
+		}) {
+			return nil, fmt.Errorf("%s is bound inside of a comprehension", variable)
+		}
+	}
+
+	ex := &extraction{expr: expr, exprText: text[start:end]}
+	for _, node := range stack.Stack[minDepth:exprIndex] {
+		if offset, separator, ok := scopeInsertion(text, node, exprRange); ok {
+			ex.scope, ex.insertOffset, ex.separator = node, offset, separator
+			break
+		}
+	}
+	if ex.scope == nil && !bound && exprIndex > 0 {
+		// Nothing needs to be in scope, start the document with the local
+		root := stack.Stack[0]
+		if offset, err := position.ProtocolToOffset(text, position.ASTToProtocol(root.Loc().Begin)); err == nil && root.Loc().Begin.IsSet() {
+			ex.scope, ex.insertOffset, ex.separator, ex.documentStart = root, offset, ";", true
+		}
+	}
+	if ex.scope == nil {
+		return nil, fmt.Errorf("no scope to extract %s to", ex.exprText)
+	}
+	// Add the local after other locals, e.g. `local a = 1; local b = 2; <here> body`
+	for {
+		local, ok := ex.scope.(*ast.Local)
+		if !ok {
+			break
+		}
+		next, ok := local.Body.(*ast.Local)
+		if !ok {
+			break
+		}
+		offset, separator, ok := scopeInsertion(text, next, exprRange)
+		if !ok {
+			break
+		}
+		ex.scope, ex.insertOffset, ex.separator = next, offset, separator
+	}
+
+	ex.occurrences = findOccurrences(doc.AST, text, ex, freeVariables, selfUsed)
+	return ex, nil
+}
+
+// scopeInsertion returns where a local has to be inserted to be visible in the part of the node containing exprRange
+func scopeInsertion(text string, node ast.Node, exprRange ast.LocationRange) (int, string, bool) {
+	var body ast.Node
+	switch node := node.(type) {
+	case *ast.Local:
+		body = node.Body
+	case *ast.Function:
+		body = node.Body
+	case *ast.DesugaredObject:
+		if !node.LocRange.Begin.IsSet() || fieldNameContains(node, exprRange) {
+			return 0, "", false
+		}
+		brace, err := position.ProtocolToOffset(text, position.ASTToProtocol(node.LocRange.Begin))
+		if err != nil || brace >= len(text) || text[brace] != '{' {
+			return 0, "", false
+		}
+		return skipWhitespace(text, brace+1), ",", true
+	default:
+		return 0, "", false
+	}
+
+	// Generated nodes, e.g. the functions of comprehensions, have no location
+	if body == nil || !body.Loc().Begin.IsSet() || !containsRange(*body.Loc(), exprRange) {
+		return 0, "", false
+	}
+	offset, err := position.ProtocolToOffset(text, position.ASTToProtocol(body.Loc().Begin))
+	if err != nil {
+		return 0, "", false
+	}
+	return offset, ";", true
+}
+
+// findOccurrences returns the ranges of all expressions in the scope that are identical to the extracted one
+func findOccurrences(root ast.Node, text string, ex *extraction, freeVariables ast.Identifiers, selfUsed bool) []ast.LocationRange {
+	occurrences := []ast.LocationRange{*ex.expr.Loc()}
+	for _, node := range nodetree.BuildTree(nil, ex.scope).GetAllChildren() {
+		loc := node.Loc()
+		if node == ex.expr || !loc.Begin.IsSet() || slices.Contains(occurrences, *loc) {
+			continue
+		}
+		start, err := position.ProtocolToOffset(text, position.ASTToProtocol(loc.Begin))
+		if err != nil {
+			continue
+		}
+		end, err := position.ProtocolToOffset(text, position.ASTToProtocol(loc.End))
+		if err != nil || end-start != len(ex.exprText) || text[start:end] != ex.exprText {
+			continue
+		}
+		if _, _, ok := scopeInsertion(text, ex.scope, *loc); !ok && !ex.documentStart {
+			continue
+		}
+
+		// The free variables have to refer to the same bindings
+		stack, err := processing.FindNodeByPosition(root, loc.Begin)
+		if err != nil {
+			continue
+		}
+		scopeIndex := slices.Index(stack.Stack, ex.scope)
+		nodeIndex := slices.Index(stack.Stack, node)
+		if scopeIndex < 0 || nodeIndex < scopeIndex {
+			continue
+		}
+		shadowed := slices.ContainsFunc(stack.Stack[scopeIndex+1:nodeIndex], func(n ast.Node) bool {
+			return bindsAny(n, freeVariables, selfUsed)
+		})
+		if !shadowed {
+			occurrences = append(occurrences, *loc)
+		}
+	}
+	slices.SortFunc(occurrences, func(a, b ast.LocationRange) int {
+		if a.Begin.Line != b.Begin.Line {
+			return a.Begin.Line - b.Begin.Line
+		}
+		return a.Begin.Column - b.Begin.Column
+	})
+	return occurrences
+}
+
+// bindsAny checks if the node binds one of the identifiers. Objects bind self if selfUsed is set
+func bindsAny(node ast.Node, identifiers ast.Identifiers, selfUsed bool) bool {
+	if _, isObject := node.(*ast.DesugaredObject); isObject && selfUsed {
+		return true
+	}
+	return slices.ContainsFunc(identifiers, func(id ast.Identifier) bool { return processing.Binds(node, id) })
+}
+
+// usesSelf checks if the node refers to the object it is part of
+func usesSelf(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.Self, *ast.SuperIndex, *ast.InSuper:
+		return true
+	case *ast.DesugaredObject:
+		// Nested objects have their own self
+		return false
+	}
+	return slices.ContainsFunc(toolutils.Children(node), usesSelf)
+}
+
+// isObjectFieldPart checks if the node is the name of a field or a method spanning the whole field
+func isObjectFieldPart(object *ast.DesugaredObject, node ast.Node) bool {
+	for _, field := range object.Fields {
+		if field.Name == node {
+			return true
+		}
+		if _, isFunction := field.Body.(*ast.Function); isFunction && field.Body == node {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldNameContains checks if the range is part of a field name. Field names are evaluated outside of the object
+func fieldNameContains(object *ast.DesugaredObject, rng ast.LocationRange) bool {
+	for _, field := range object.Fields {
+		if _, isLiteral := field.Name.(*ast.LiteralString); !isLiteral && field.Name.Loc().Begin.IsSet() && containsRange(*field.Name.Loc(), rng) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRange(outer, inner ast.LocationRange) bool {
+	return processing.InRange(inner.Begin, outer) && processing.InRange(inner.End, outer)
+}
+
+// unusedIdentifier returns name or name with a number appended that isn't used in the text yet
+func unusedIdentifier(text, name string) string {
+	words := map[string]struct{}{}
+	for _, word := range wordRegexp.FindAllString(text, -1) {
+		words[word] = struct{}{}
+	}
+	candidate := name
+	for i := 1; ; i++ {
+		if _, ok := words[candidate]; !ok {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+}
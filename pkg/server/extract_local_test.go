@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeOf returns the range of the first occurrence of substr in text
+func rangeOf(t *testing.T, text, substr string) protocol.Range {
+	t.Helper()
+	start := strings.Index(text, substr)
+	require.GreaterOrEqual(t, start, 0, "%q not found", substr)
+	return protocol.Range{
+		Start: position.OffsetToProtocol(text, start),
+		End:   position.OffsetToProtocol(text, start+len(substr)),
+	}
+}
+
+func TestExtractLocal(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileContent string
+		selection   string
+		// Expected document for each returned action
+		expected []string
+	}{
+		{
+			name:        "outside of object using a local",
+			fileContent: "local a = 1;\n{\n  x: a + 2,\n  y: a + 2,\n}\n",
+			selection:   "a + 2",
+			expected: []string{
+				"local a = 1;\nlocal extracted = a + 2;\n{\n  x: extracted,\n  y: a + 2,\n}\n",
+				"local a = 1;\nlocal extracted = a + 2;\n{\n  x: extracted,\n  y: extracted,\n}\n",
+			},
+		},
+		{
+			name:        "after all locals",
+			fileContent: "local a = 1;\nlocal b = 2;\na * 3\n",
+			selection:   "a * 3",
+			expected: []string{
+				"local a = 1;\nlocal b = 2;\nlocal extracted = a * 3;\nextracted\n",
+			},
+		},
+		{
+			name:        "function body using a parameter",
+			fileContent: "{\n  f(p): p * 2 + 1,\n}\n",
+			selection:   "p * 2",
+			expected: []string{
+				"{\n  f(p): local extracted = p * 2; extracted + 1,\n}\n",
+			},
+		},
+		{
+			name:        "object local using self",
+			fileContent: "{\n  a: 1,\n  b: self.a + 1,\n}\n",
+			selection:   "self.a",
+			expected: []string{
+				"{\n  local extracted = self.a,\n  a: 1,\n  b: extracted + 1,\n}\n",
+			},
+		},
+		{
+			name:        "start of document",
+			fileContent: "[1 + 2, 1 + 2]\n",
+			selection:   "1 + 2",
+			expected: []string{
+				"local extracted = 1 + 2;\n[extracted, 1 + 2]\n",
+				"local extracted = 1 + 2;\n[extracted, extracted]\n",
+			},
+		},
+		{
+			name:        "shadowed occurrences are kept",
+			fileContent: "local x = 1;\n[x + 1, local x = 2; x + 1]\n",
+			selection:   "x + 1",
+			expected: []string{
+				"local x = 1;\nlocal extracted = x + 1;\n[extracted, local x = 2; x + 1]\n",
+			},
+		},
+		{
+			name:        "name is not taken",
+			fileContent: "local extracted = 1;\n{ a: extracted + 1 }\n",
+			selection:   "extracted + 1",
+			expected: []string{
+				"local extracted = 1;\nlocal extracted1 = extracted + 1;\n{ a: extracted1 }\n",
+			},
+		},
+		{
+			name:        "comprehension variable",
+			fileContent: "[v * 2 for v in [1, 2]]\n",
+			selection:   "v * 2",
+		},
+		{
+			name:        "no expression",
+			fileContent: "local a = 1;\n{ x: a + 2 }\n",
+			selection:   "a + ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Range:        rangeOf(t, tc.fileContent, tc.selection),
+				Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorExtract}},
+			})
+			require.NoError(t, err)
+			require.Len(t, actions, len(tc.expected))
+			for i, action := range actions {
+				assert.Equal(t, protocol.RefactorExtract, action.Kind)
+				result := applyTextEdits(t, tc.fileContent, action.Edit.Changes[fileURI])
+				assert.Equal(t, tc.expected[i], result)
+				_, err := jsonnet.SnippetToAST("", result)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUnusedIdentifier(t *testing.T) {
+	testCases := map[string]string{
+		"{ a: 1 }":                           "extracted",
+		"{ extracted_value: 1 }":             "extracted",
+		"// extracted\n{ extracted1: 1 }":    "extracted2",
+		"local extracted = 1; extracted + 1": "extracted1",
+	}
+	for text, expected := range testCases {
+		assert.Equal(t, expected, unusedIdentifier(text, extractedLocalName), text)
+	}
+}
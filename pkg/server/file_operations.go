@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// fileOperationFilters matches the files that can be imported and all folders
+var fileOperationFilters = &protocol.FileOperationRegistrationOptions{
+	Filters: []protocol.FileOperationFilter{
+		{Scheme: "file", Pattern: protocol.FileOperationPattern{Glob: "**/*.{jsonnet,libsonnet,json}", Matches: protocol.FilePattern}},
+		{Scheme: "file", Pattern: protocol.FileOperationPattern{Glob: "**/*", Matches: protocol.FolderPattern}},
+	},
+}
+
+// fileMove is a renamed file or folder
+type fileMove struct {
+	oldPath, newPath string
+}
+
+// WillRenameFiles rewrites the imports of moved files. The edits are applied before the files are moved,
+// so they refer to the old locations
+func (s *Server) WillRenameFiles(_ context.Context, params *protocol.RenameFilesParams) (*protocol.WorkspaceEdit, error) {
+	var moves []fileMove
+	files := map[string]struct{}{}
+	for _, rename := range params.Files {
+		move := fileMove{
+			oldPath: protocol.DocumentURI(rename.OldURI).SpanURI().Filename(),
+			newPath: protocol.DocumentURI(rename.NewURI).SpanURI().Filename(),
+		}
+		moves = append(moves, move)
+
+		workspaceFiles, err := s.workspaceFiles(protocol.DocumentURI(rename.OldURI))
+		if err != nil {
+			return nil, utils.LogErrorf("WillRenameFiles: %w", err)
+		}
+		// The moved files themselves might not be in the workspace
+		movedFiles, err := utils.GetAllJsonnetFiles(move.oldPath)
+		if err != nil {
+			return nil, utils.LogErrorf("WillRenameFiles: %w", err)
+		}
+		for _, file := range append(workspaceFiles, movedFiles...) {
+			if abs, err := filepath.Abs(file); err == nil {
+				files[abs] = struct{}{}
+			}
+		}
+	}
+
+	edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+	for file := range files {
+		fileEdits, err := s.importRenameEdits(file, moves)
+		if err != nil {
+			log.Debugf("WillRenameFiles: %v", err)
+			continue
+		}
+		if len(fileEdits) > 0 {
+			edits[protocol.URIFromPath(file)] = fileEdits
+		}
+	}
+	if len(edits) == 0 {
+		return nil, nil
+	}
+	response := s.buildWorkspaceEdit(edits)
+	return &response, nil
+}
+
+// importRenameEdits rewrites the imports of the file that break when the files are moved. Relative imports stay relative
+// and imports resolved via a jpath stay relative to a jpath
+func (s *Server) importRenameEdits(filename string, moves []fileMove) ([]protocol.TextEdit, error) {
+	text, err := s.documentText(protocol.URIFromPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(text, "import") {
+		return nil, nil
+	}
+	vm, root, err := s.getAst(filename, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting ast for %s: %w", filename, err)
+	}
+
+	newFilename := movedPath(filename, moves)
+	var edits []protocol.TextEdit
+	for _, node := range processing.FindImports(root) {
+		importPath, _ := processing.ImportPath(node)
+		foundAt, err := vm.ResolveImport(filename, importPath)
+		if err != nil {
+			continue
+		}
+		if foundAt, err = filepath.Abs(foundAt); err != nil {
+			continue
+		}
+		newFoundAt := movedPath(foundAt, moves)
+		if newFoundAt == foundAt && newFilename == filename {
+			continue
+		}
+
+		var newImportPath string
+		switch {
+		case filepath.IsAbs(importPath):
+			newImportPath = newFoundAt
+		case foundAt == filepath.Join(filepath.Dir(filename), importPath):
+			newImportPath = relativeImportPath(filepath.Dir(newFilename), newFoundAt)
+		case newFoundAt == foundAt:
+			// Resolved through a jpath, which doesn't depend on the location of the file
+			continue
+		default:
+			newImportPath = shortestImportPath(newFoundAt, s.importJPaths(newFilename))
+			if newImportPath == "" {
+				// Moved out of all jpaths
+				newImportPath = relativeImportPath(filepath.Dir(newFilename), newFoundAt)
+			}
+		}
+		if newImportPath == importPath {
+			continue
+		}
+		if edit, ok := importPathEdit(text, node, importPath, newImportPath); ok {
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
+
+// importPathEdit replaces the path in the string of the import
+func importPathEdit(text string, node ast.Node, oldPath, newPath string) (protocol.TextEdit, bool) {
+	rng, ok := importPathRange(text, node, oldPath)
+	if !ok {
+		return protocol.TextEdit{}, false
+	}
+	return protocol.TextEdit{Range: rng, NewText: newPath}, true
+}
+
+// importPathRange returns the range of the path in the string of the import
+func importPathRange(text string, node ast.Node, importPath string) (protocol.Range, bool) {
+	var file *ast.LiteralString
+	switch node := node.(type) {
+	case *ast.Import:
+		file = node.File
+	case *ast.ImportStr:
+		file = node.File
+	case *ast.ImportBin:
+		file = node.File
+	}
+	locRange := file.LocRange
+	if !locRange.Begin.IsSet() {
+		locRange = *node.Loc()
+	}
+	start, err := position.ProtocolToOffset(text, position.ASTToProtocol(locRange.Begin))
+	if err != nil {
+		return protocol.Range{}, false
+	}
+	end, err := position.ProtocolToOffset(text, position.ASTToProtocol(locRange.End))
+	if err != nil {
+		return protocol.Range{}, false
+	}
+	pathStart := strings.LastIndex(text[start:end], importPath)
+	if pathStart < 0 {
+		// e.g. escaped characters
+		return protocol.Range{}, false
+	}
+	pathStart += start
+	return protocol.Range{
+		Start: position.OffsetToProtocol(text, pathStart),
+		End:   position.OffsetToProtocol(text, pathStart+len(importPath)),
+	}, true
+}
+
+// movedPath returns the new location of the file. Files in moved folders are moved as well
+func movedPath(filename string, moves []fileMove) string {
+	for _, move := range moves {
+		if filename == move.oldPath {
+			return move.newPath
+		}
+		if rel, ok := strings.CutPrefix(filename, move.oldPath+string(filepath.Separator)); ok {
+			return filepath.Join(move.newPath, rel)
+		}
+	}
+	return filename
+}
+
+// relativeImportPath returns the path of file relative to dir with forward slashes
+func relativeImportPath(dir, file string) string {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s *Server) DidRenameFiles(_ context.Context, params *protocol.RenameFilesParams) error {
+	for _, rename := range params.Files {
+		s.removeFromIndex(protocol.DocumentURI(rename.OldURI).SpanURI().Filename())
+		s.addToIndex(protocol.DocumentURI(rename.NewURI).SpanURI().Filename())
+	}
+	return nil
+}
+
+func (s *Server) DidCreateFiles(_ context.Context, params *protocol.CreateFilesParams) error {
+	for _, file := range params.Files {
+		s.addToIndex(protocol.DocumentURI(file.URI).SpanURI().Filename())
+	}
+	return nil
+}
+
+func (s *Server) DidDeleteFiles(_ context.Context, params *protocol.DeleteFilesParams) error {
+	for _, file := range params.Files {
+		s.removeFromIndex(protocol.DocumentURI(file.URI).SpanURI().Filename())
+	}
+	return nil
+}
+
+// WillCreateFiles doesn't change anything. New files can't break imports
+func (s *Server) WillCreateFiles(context.Context, *protocol.CreateFilesParams) (*protocol.WorkspaceEdit, error) {
+	return nil, nil
+}
+
+// WillDeleteFiles doesn't change anything. Imports of deleted files are reported by the diagnostics
+func (s *Server) WillDeleteFiles(context.Context, *protocol.DeleteFilesParams) (*protocol.WorkspaceEdit, error) {
+	return nil, nil
+}
+
+// addToIndex indexes the file or all files in the folder
+func (s *Server) addToIndex(path string) {
+	files, err := utils.GetAllJsonnetFiles(path)
+	if err != nil {
+		log.Errorf("Indexing %s: %v", path, err)
+		return
+	}
+	for _, file := range files {
+		if err := s.index.UpdateFile(file); err != nil {
+			log.Debugf("Indexing: %v", err)
+		}
+	}
+}
+
+// removeFromIndex removes the file or all files in the folder from the index
+func (s *Server) removeFromIndex(path string) {
+	for _, file := range s.index.Files() {
+		if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+			s.index.Remove(file)
+		}
+	}
+}
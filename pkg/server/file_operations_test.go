@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWillRenameFiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldPath  string
+		newPath  string
+		expected map[string]string
+	}{
+		{
+			name:    "file into subfolder",
+			oldPath: "lib/a.libsonnet",
+			newPath: "lib/sub/a.libsonnet",
+			expected: map[string]string{
+				"main.jsonnet":    "local a = import 'lib/sub/a.libsonnet';\nlocal viaJPath = import \"sub/a.libsonnet\";\nlocal data = importstr 'lib/data.txt';\na + viaJPath\n",
+				"lib/a.libsonnet": "local b = import '../b.libsonnet';\nb\n",
+			},
+		},
+		{
+			name:    "imported data",
+			oldPath: "lib/data.txt",
+			newPath: "data.txt",
+			expected: map[string]string{
+				"main.jsonnet": "local a = import 'lib/a.libsonnet';\nlocal viaJPath = import \"a.libsonnet\";\nlocal data = importstr 'data.txt';\na + viaJPath\n",
+			},
+		},
+		{
+			name:    "folder",
+			oldPath: "lib",
+			newPath: "vendor/lib",
+			expected: map[string]string{
+				"main.jsonnet":  "local a = import 'vendor/lib/a.libsonnet';\nlocal viaJPath = import \"vendor/lib/a.libsonnet\";\nlocal data = importstr 'vendor/lib/data.txt';\na + viaJPath\n",
+				"other.jsonnet": "local b = import 'vendor/lib/b.libsonnet';\nb\n",
+			},
+		},
+		{
+			name:    "importing file",
+			oldPath: "main.jsonnet",
+			newPath: "app/main.jsonnet",
+			expected: map[string]string{
+				"main.jsonnet": "local a = import '../lib/a.libsonnet';\nlocal viaJPath = import \"a.libsonnet\";\nlocal data = importstr '../lib/data.txt';\na + viaJPath\n",
+			},
+		},
+		{
+			name:    "not imported",
+			oldPath: "unrelated.jsonnet",
+			newPath: "renamed.jsonnet",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := newTestFixture(t, "file-operations")
+			server := testServer(t, nil)
+			server.configuration.JPaths = []string{fixture.dir, fixture.path("lib")}
+			fixture.open(t, server, "main.jsonnet")
+
+			edit, err := server.WillRenameFiles(context.Background(), &protocol.RenameFilesParams{
+				Files: []protocol.FileRename{{
+					OldURI: string(protocol.URIFromPath(fixture.path(tc.oldPath))),
+					NewURI: string(protocol.URIFromPath(fixture.path(tc.newPath))),
+				}},
+			})
+			require.NoError(t, err)
+			if tc.expected == nil {
+				assert.Nil(t, edit)
+				return
+			}
+			require.NotNil(t, edit)
+
+			actual := map[string]string{}
+			for uri, edits := range edit.Changes {
+				rel, err := filepath.Rel(fixture.dir, uri.SpanURI().Filename())
+				require.NoError(t, err)
+				actual[filepath.ToSlash(rel)] = applyTextEdits(t, fixture.read(t, rel), edits)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestDidRenameFilesUpdatesIndex(t *testing.T) {
+	fixture := newTestFixture(t, "file-operations")
+	oldFile := fixture.path("old.libsonnet")
+	newFile := fixture.path("new.libsonnet")
+	server := testServer(t, nil)
+	require.NoError(t, server.index.UpdateFile(oldFile))
+
+	require.NoError(t, os.Rename(oldFile, newFile))
+	require.NoError(t, server.DidRenameFiles(context.Background(), &protocol.RenameFilesParams{
+		Files: []protocol.FileRename{{OldURI: string(protocol.URIFromPath(oldFile)), NewURI: string(protocol.URIFromPath(newFile))}},
+	}))
+	assert.False(t, server.index.Contains(oldFile))
+	assert.True(t, server.index.Contains(newFile))
+}
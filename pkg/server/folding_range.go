@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+func (s *Server) FoldingRange(ctx context.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("FoldingRange: %s: %w", errorRetrievingDocument, err)
+	}
+
+	// The tree-sitter tree is used since the AST is missing or outdated while the document has syntax errors
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		return nil, utils.LogErrorf("FoldingRange: parsing tree: %w", err)
+	}
+	return cst.FoldingRanges(root, doc.Item.Text), nil
+}
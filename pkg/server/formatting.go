@@ -17,7 +17,8 @@ func (s *Server) Formatting(_ context.Context, params *protocol.DocumentFormatti
 		return nil, utils.LogErrorf("Formatting: %s: %w", errorRetrievingDocument, err)
 	}
 
-	formatted, err := formatter.Format(params.TextDocument.URI.SpanURI().Filename(), doc.Item.Text, s.configuration.FormattingOptions)
+	filename := params.TextDocument.URI.SpanURI().Filename()
+	formatted, err := formatter.Format(filename, doc.Item.Text, s.configurationFor(filename).FormattingOptions)
 	if err != nil {
 		log.Errorf("error formatting document: %v", err)
 		return nil, nil
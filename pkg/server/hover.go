@@ -19,7 +19,8 @@ func (s *Server) Hover(_ context.Context, params *protocol.HoverParams) (*protoc
 		return nil, utils.LogErrorf("Hover: %s: %w", errorRetrievingDocument, err)
 	}
 
-	if doc.Err != nil {
+	// A recovered AST is good enough for hover even if the document currently has syntax errors
+	if doc.AST == nil || doc.LinesChangedSinceAST[int(params.Position.Line)] {
 		// Hover triggers often. Throwing an error on each request is noisy
 		log.Errorf("Hover: %s", errorParsingDocument)
 		return nil, nil
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// indexWorkspace adds all jsonnet files of the folders to the index. Open documents are indexed when they change
+func (s *Server) indexWorkspace(folders []string) {
+	for _, folder := range folders {
+		files, err := utils.GetAllJsonnetFiles(folder)
+		if err != nil {
+			log.Errorf("Indexing %s: %v", folder, err)
+			continue
+		}
+		for _, file := range files {
+			if abs, err := filepath.Abs(file); err == nil {
+				file = abs
+			}
+			if _, err := s.cache.Get(protocol.URIFromPath(file)); err == nil {
+				continue
+			}
+			if err := s.index.Refresh(file); err != nil {
+				log.Debugf("Indexing: %v", err)
+			}
+		}
+	}
+	s.index.SetReady()
+	log.Infof("Indexed workspace folders %v", folders)
+
+	if path := s.indexCachePath(folders); path != "" {
+		if err := s.index.Save(path); err != nil {
+			log.Errorf("Saving index: %v", err)
+		}
+	}
+}
+
+// loadIndex loads the index persisted by a previous run for the folders
+func (s *Server) loadIndex(folders []string) {
+	path := s.indexCachePath(folders)
+	if path == "" {
+		return
+	}
+	if err := s.index.Load(path); err != nil {
+		log.Errorf("Loading index: %v", err)
+		return
+	}
+	go s.warmTopLevelObjects(s.index.Files())
+}
+
+// warmTopLevelObjects caches the top level objects of the imports of the files. Definitions of imported fields read them,
+// so the first definition after a start doesn't have to parse every imported file. Open documents are warmed first
+func (s *Server) warmTopLevelObjects(files []string) {
+	roots := map[string]ast.Node{}
+	var ordered []string
+	for _, uri := range s.cache.URIs() {
+		if doc, err := s.cache.Get(uri); err == nil && doc.AST != nil {
+			filename := uri.SpanURI().Filename()
+			roots[filename] = doc.AST
+			ordered = append(ordered, filename)
+		}
+	}
+	for _, file := range files {
+		if _, ok := roots[file]; !ok {
+			ordered = append(ordered, file)
+		}
+	}
+
+	for _, file := range ordered {
+		vm := s.getVM(file)
+		root, ok := roots[file]
+		if !ok {
+			var err error
+			if root, _, err = vm.ImportAST("", file); err != nil {
+				log.Debugf("Warming top level objects: %v", err)
+				continue
+			}
+		}
+		processor := processing.NewProcessor(s.cache, vm)
+		for _, node := range processing.FindImports(root) {
+			if node, ok := node.(*ast.Import); ok {
+				// Cached by the importing file like in definitions
+				processor.FindTopLevelObjectsInFile(node.File.Value, string(node.Loc().File.DiagnosticFileName))
+			}
+		}
+	}
+	log.Debugf("Warmed top level objects of %d files", len(ordered))
+}
+
+// indexCachePath returns the file the index of the folders is persisted in. Empty if persistence is disabled
+func (s *Server) indexCachePath(folders []string) string {
+	if !s.configuration.Index.PersistenceEnabled() {
+		return ""
+	}
+	dir := s.configuration.Index.CacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			log.Errorf("Unable to find cache directory for the index: %v", err)
+			return ""
+		}
+		dir = filepath.Join(userCacheDir, s.name)
+	}
+
+	// Each set of folders gets its own index. Different workspaces don't overwrite each other
+	absFolders := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+		absFolders = append(absFolders, folder)
+	}
+	slices.Sort(absFolders)
+	hash := sha256.Sum256([]byte(strings.Join(absFolders, "\n")))
+	return filepath.Join(dir, "index-"+hex.EncodeToString(hash[:8])+".gob")
+}
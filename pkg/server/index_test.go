@@ -0,0 +1,60 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/grafana/jsonnet-language-server/pkg/server/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexPersistence(t *testing.T) {
+	// Persistence is enabled by default
+	configuration := config.Configuration{
+		Index: config.IndexConfig{CacheDir: t.TempDir()},
+	}
+	folders := []string{"testdata/reference"}
+
+	server := NewServer("jsonnet-language-server", "dev", nil, configuration)
+	server.indexWorkspace(folders)
+	assert.FileExists(t, server.indexCachePath(folders))
+
+	// A new server starts with the symbols of the previous run
+	restarted := NewServer("jsonnet-language-server", "dev", nil, configuration)
+	restarted.loadIndex(folders)
+	libFile, err := filepath.Abs("testdata/reference/lib.libsonnet")
+	require.NoError(t, err)
+	assert.True(t, restarted.index.Contains(libFile))
+
+	// The imports of the persisted files are resolved before the first definition
+	restarted.warmTopLevelObjects(restarted.index.Files())
+	mainFile, err := filepath.Abs("testdata/reference/main.jsonnet")
+	require.NoError(t, err)
+	objects, ok := restarted.cache.GetTopLevelObject("lib.libsonnet", mainFile)
+	assert.True(t, ok)
+	assert.NotEmpty(t, objects)
+
+	// Different folders use a different index
+	assert.NotEqual(t, server.indexCachePath(folders), server.indexCachePath([]string{"testdata"}))
+
+	disabled := false
+	server.configuration.Index.EnablePersistence = &disabled
+	assert.Empty(t, server.indexCachePath(folders))
+}
+
+func TestMayUseIdentifierBeforeIndexing(t *testing.T) {
+	// Not initialized, so the workspace is not indexed
+	server := NewServer("jsonnet-language-server", "dev", nil, config.Configuration{})
+	root, err := jsonnet.SnippetToAST("lib.libsonnet", "local a = 1; a")
+	require.NoError(t, err)
+	server.index.Update("lib.libsonnet", root)
+
+	// The entry can be outdated until the workspace is indexed
+	assert.True(t, server.mayUseIdentifier("lib.libsonnet", "b"))
+
+	server.index.SetReady()
+	assert.True(t, server.mayUseIdentifier("lib.libsonnet", "a"))
+	assert.False(t, server.mayUseIdentifier("lib.libsonnet", "b"))
+}
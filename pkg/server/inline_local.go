@@ -0,0 +1,268 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// Precedences as used by the jsonnet parser. Lower values bind tighter
+const (
+	atomPrecedence    = 0
+	applyPrecedence   = 2
+	unaryPrecedence   = 4
+	keywordPrecedence = 16
+)
+
+var binaryPrecedence = map[ast.BinaryOp]int{
+	ast.BopMult:            5,
+	ast.BopDiv:             5,
+	ast.BopPercent:         5,
+	ast.BopPlus:            6,
+	ast.BopMinus:           6,
+	ast.BopShiftL:          7,
+	ast.BopShiftR:          7,
+	ast.BopGreater:         8,
+	ast.BopGreaterEq:       8,
+	ast.BopLess:            8,
+	ast.BopLessEq:          8,
+	ast.BopIn:              8,
+	ast.BopManifestEqual:   9,
+	ast.BopManifestUnequal: 9,
+	ast.BopBitwiseAnd:      10,
+	ast.BopBitwiseXor:      11,
+	ast.BopBitwiseOr:       12,
+	ast.BopAnd:             13,
+	ast.BopOr:              14,
+}
+
+// inlining describes a local bind and all its references
+type inlining struct {
+	bind *ast.LocalBind
+	// The Local or DesugaredObject the bind belongs to
+	scope      ast.Node
+	references []*ast.Var
+}
+
+func (s *Server) inlineLocalActions(doc *cache.Document, pos protocol.Position) []protocol.CodeAction {
+	in, err := s.findInlining(doc, pos)
+	if err != nil {
+		return nil
+	}
+	name := string(in.bind.Variable)
+	return []protocol.CodeAction{{
+		Title: fmt.Sprintf("Inline local `%s`", name),
+		Kind:  protocol.RefactorInline,
+		Data: codeActionData{
+			Fix:   fixInlineLocal,
+			URI:   doc.Item.URI,
+			Range: protocol.Range{Start: pos, End: pos},
+			Name:  name,
+		},
+	}}
+}
+
+func (s *Server) inlineLocalEdits(doc *cache.Document, data codeActionData) ([]protocol.TextEdit, error) {
+	in, err := s.findInlining(doc, data.Range.Start)
+	if err != nil {
+		return nil, err
+	}
+	text := doc.Item.Text
+	body := in.bind.Body
+	start, err := position.ProtocolToOffset(text, position.ASTToProtocol(body.Loc().Begin))
+	if err != nil {
+		return nil, err
+	}
+	end, err := position.ProtocolToOffset(text, position.ASTToProtocol(body.Loc().End))
+	if err != nil {
+		return nil, err
+	}
+	bodyText := text[start:end]
+
+	edits, err := removeUnusedVariableEdits(doc, codeActionData{
+		Name:  string(in.bind.Variable),
+		Range: protocol.Range{Start: position.ASTToProtocol(in.bind.LocRange.Begin)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, reference := range in.references {
+		path := processing.NodePath(doc.AST, reference)
+		newText := bodyText
+		if len(path) > 1 && needsParens(body, path[len(path)-2], reference) {
+			newText = "(" + bodyText + ")"
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range:   position.RangeASTToProtocol(reference.LocRange),
+			NewText: newText,
+		})
+	}
+	return edits, nil
+}
+
+// findInlinedBind returns the bind defined or referenced at the position and the node it belongs to
+func findInlinedBind(doc *cache.Document, pos protocol.Position) (*ast.LocalBind, ast.Node, error) {
+	if doc.AST == nil {
+		return nil, nil, fmt.Errorf("%s", errorParsingDocument)
+	}
+	location := position.ProtocolToAST(pos)
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bind *ast.LocalBind
+	var scope ast.Node
+	if variable, ok := stack.Peek().(*ast.Var); ok {
+		// The binder can also be a generated node like the function of a comprehension
+		if scope = processing.FindBinder(doc.AST, variable); scope != nil {
+			bind = processing.FindBindByIDViaStack(nodestack.NewNodeStack(scope), variable.Id)
+		}
+	} else {
+		bind, scope = bindAtName(stack, location)
+	}
+
+	if bind == nil {
+		return nil, nil, fmt.Errorf("no local bind at %v", location)
+	}
+	if !bind.LocRange.Begin.IsSet() {
+		// e.g. the function of `local f(x) = x;`. Its body starts at the name
+		return nil, nil, fmt.Errorf("unable to inline %s", bind.Variable)
+	}
+	return bind, scope, nil
+}
+
+// findInlining finds the bind at the position and its references. Fails if any of them would refer to something else once inlined
+func (s *Server) findInlining(doc *cache.Document, pos protocol.Position) (*inlining, error) {
+	bind, scope, err := findInlinedBind(doc, pos)
+	if err != nil {
+		return nil, err
+	}
+	in := &inlining{bind: bind, scope: scope}
+	id := bind.Variable
+	freeVariables := bind.Body.FreeVariables()
+	if slices.Contains(freeVariables, id) {
+		return nil, fmt.Errorf("%s is recursive", id)
+	}
+	selfUsed := usesSelf(bind.Body)
+
+	expected := processing.FindScopeReferences(scope, id)
+
+	filename := doc.Item.URI.SpanURI().Filename()
+	locations, err := s.findIdentifierLocations(filename, string(id))
+	if err != nil {
+		return nil, err
+	}
+	targetLocation := bind.LocRange.Begin
+	for _, reference := range s.findReference(doc.AST, &targetLocation, filename, s.getVM(filename), locations) {
+		referenceStart := position.ProtocolToAST(reference.Range.Start)
+		index := slices.IndexFunc(expected, func(variable *ast.Var) bool { return variable.LocRange.Begin == referenceStart })
+		if index >= 0 && !slices.Contains(in.references, expected[index]) {
+			in.references = append(in.references, expected[index])
+		}
+	}
+	if len(in.references) != len(expected) {
+		return nil, fmt.Errorf("unable to find all references of %s", id)
+	}
+
+	for _, reference := range in.references {
+		path := processing.NodePath(scope, reference)
+		for _, node := range path[1 : len(path)-1] {
+			if bindsAny(node, freeVariables, selfUsed) {
+				return nil, fmt.Errorf("inlining %s at %v would refer to a different binding", id, reference.LocRange.Begin)
+			}
+		}
+	}
+	return in, nil
+}
+
+// bindAtName returns the bind whose name is at the location and the Local or DesugaredObject it belongs to
+func bindAtName(stack *nodestack.NodeStack, location ast.Location) (*ast.LocalBind, ast.Node) {
+	for i := len(stack.Stack) - 1; i >= 0; i-- {
+		var binds ast.LocalBinds
+		switch node := stack.Stack[i].(type) {
+		case *ast.Local:
+			binds = node.Binds
+		case *ast.DesugaredObject:
+			binds = node.Locals
+		}
+		for _, bind := range binds {
+			begin := bindNameLocation(bind)
+			if begin.IsSet() && processing.InRange(location, nameRange(begin, bind.Variable)) {
+				return &bind, stack.Stack[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// bindNameLocation returns the location of the name of the bind. The desugared binds of functions like `local f(x) = x;`
+// have no location, but their function starts at the name
+func bindNameLocation(bind ast.LocalBind) ast.Location {
+	if bind.LocRange.Begin.IsSet() {
+		return bind.LocRange.Begin
+	}
+	if function, ok := bind.Body.(*ast.Function); ok {
+		return function.LocRange.Begin
+	}
+	return ast.Location{}
+}
+
+// needsParens checks if the expression has to be wrapped in parentheses when it replaces child in parent
+func needsParens(expr, parent, child ast.Node) bool {
+	allowed := keywordPrecedence
+	switch parent := parent.(type) {
+	case *ast.Binary:
+		allowed = binaryPrecedence[parent.Op]
+		if parent.Right == child {
+			// Operators are left associative
+			allowed--
+		}
+	case *ast.Unary:
+		allowed = unaryPrecedence
+	case *ast.Index:
+		if parent.Target == child {
+			allowed = applyPrecedence
+		}
+	case *ast.Slice:
+		if parent.Target == child {
+			allowed = applyPrecedence
+		}
+	case *ast.Apply:
+		if parent.Target == child {
+			allowed = applyPrecedence
+		} else if !parent.Target.Loc().Begin.IsSet() {
+			// Desugared operator, e.g. `%` or `in`
+			allowed = unaryPrecedence
+		}
+	}
+	return expressionPrecedence(expr) > allowed
+}
+
+func expressionPrecedence(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.Binary:
+		return binaryPrecedence[node.Op]
+	case *ast.Unary:
+		return unaryPrecedence
+	case *ast.Apply:
+		if !node.Target.Loc().Begin.IsSet() {
+			// Desugared operator
+			return binaryPrecedence[ast.BopOr]
+		}
+		return atomPrecedence
+	case *ast.Var, *ast.Self, *ast.Dollar, *ast.LiteralBoolean, *ast.LiteralNull, *ast.LiteralNumber, *ast.LiteralString,
+		*ast.Array, *ast.ArrayComp, *ast.Object, *ast.ObjectComp, *ast.DesugaredObject, *ast.Parens,
+		*ast.Index, *ast.SuperIndex, *ast.Slice:
+		return atomPrecedence
+	case *ast.InSuper:
+		return binaryPrecedence[ast.BopIn]
+	}
+	return keywordPrecedence
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineLocal(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileContent string
+		// The cursor is placed at the start of the first occurrence
+		cursorAt string
+		// Empty if the local can't be inlined
+		expected string
+	}{
+		{
+			name:        "from bind",
+			fileContent: "local a = 1;\n{\n  x: a,\n  y: [a],\n}\n",
+			cursorAt:    "a = 1",
+			expected:    "{\n  x: 1,\n  y: [1],\n}\n",
+		},
+		{
+			name:        "from reference",
+			fileContent: "local a = 1;\n{\n  x: a,\n}\n",
+			cursorAt:    "a,",
+			expected:    "{\n  x: 1,\n}\n",
+		},
+		{
+			name:        "parentheses for operators",
+			fileContent: "local a = 1 + 2;\n{\n  x: a * 3,\n  y: 3 - a,\n  z: a + 3,\n  w: std.length(a),\n}\n",
+			cursorAt:    "a = ",
+			expected:    "{\n  x: (1 + 2) * 3,\n  y: 3 - (1 + 2),\n  z: 1 + 2 + 3,\n  w: std.length(1 + 2),\n}\n",
+		},
+		{
+			name:        "parentheses for index",
+			fileContent: "local a = if true then { b: 1 } else {};\na.b\n",
+			cursorAt:    "a =",
+			expected:    "(if true then { b: 1 } else {}).b\n",
+		},
+		{
+			name:        "no parentheses for atoms",
+			fileContent: "local a = { b: 1 };\na.b\n",
+			cursorAt:    "a =",
+			expected:    "{ b: 1 }.b\n",
+		},
+		{
+			name:        "one of multiple binds",
+			fileContent: "local a = 1, b = a + 1;\nb\n",
+			cursorAt:    "a =",
+			expected:    "local b = 1 + 1;\nb\n",
+		},
+		{
+			name:        "object local",
+			fileContent: "{\n  local a = self.b,\n  b: 1,\n  c: a,\n}\n",
+			cursorAt:    "a =",
+			expected:    "{\n  b: 1,\n  c: self.b,\n}\n",
+		},
+		{
+			name:        "shadowed local is not inlined",
+			fileContent: "local a = 1;\n{\n  x: a,\n  y: local a = 2; a,\n}\n",
+			cursorAt:    "a = 1",
+			expected:    "{\n  x: 1,\n  y: local a = 2; a,\n}\n",
+		},
+		{
+			name:        "free variable would be captured",
+			fileContent: "local b = 1;\nlocal a = b;\nfunction(b) a\n",
+			cursorAt:    "a =",
+		},
+		{
+			name:        "self would refer to another object",
+			fileContent: "{\n  local a = self.b,\n  b: 1,\n  c: { d: a },\n}\n",
+			cursorAt:    "a =",
+		},
+		{
+			name:        "recursive",
+			fileContent: "local a = [a];\na\n",
+			cursorAt:    "a =",
+		},
+		{
+			name:        "comprehension variable",
+			fileContent: "local a = 1;\n[a for a in [2]]\n",
+			cursorAt:    "a for",
+		},
+		{
+			name:        "parameter",
+			fileContent: "function(a) a\n",
+			cursorAt:    "a)",
+		},
+		{
+			name:        "function",
+			fileContent: "local f(x) = x;\nf(1)\n",
+			cursorAt:    "f(1)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+
+			params := &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Range:        rangeOf(t, tc.fileContent, tc.cursorAt),
+				Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorInline}},
+			}
+			params.Range.End = params.Range.Start
+			actions, err := server.CodeAction(context.Background(), params)
+			require.NoError(t, err)
+			if tc.expected == "" {
+				assert.Empty(t, actions)
+				return
+			}
+			require.Len(t, actions, 1)
+			assert.Equal(t, protocol.RefactorInline, actions[0].Kind)
+			result := applyTextEdits(t, tc.fileContent, actions[0].Edit.Changes[fileURI])
+			assert.Equal(t, tc.expected, result)
+			_, err = jsonnet.SnippetToAST("", result)
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/grafana/jsonnet-language-server/pkg/server/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// projectConfigNames are the names of project config files. If a folder contains both, the first one is used
+var projectConfigNames = []string{".jsonnet-language-server.jsonnet", ".jsonnet-language-server.json"}
+
+// isProjectConfig checks if the file is a project config file
+func isProjectConfig(filename string) bool {
+	return slices.Contains(projectConfigNames, filepath.Base(filename))
+}
+
+// findProjectConfig returns the project config file in the directory or the nearest one above. Empty if there is none
+func findProjectConfig(dir string) string {
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configurationFor returns the configuration used for the file. The settings of the nearest project config file
+// override the client settings
+func (s *Server) configurationFor(filename string) config.Configuration {
+	if project := s.projectConfiguration(filename); project != nil {
+		return *project
+	}
+	return s.configuration
+}
+
+// projectConfiguration returns the client settings merged with the project config file of the file. Nil without a
+// project config file
+func (s *Server) projectConfiguration(filename string) *config.Configuration {
+	s.projectMutex.Lock()
+	defer s.projectMutex.Unlock()
+
+	dir := filepath.Dir(filename)
+	configFile, ok := s.projectConfigFiles[dir]
+	if !ok {
+		configFile = findProjectConfig(dir)
+		s.projectConfigFiles[dir] = configFile
+	}
+	if configFile == "" {
+		return nil
+	}
+
+	configuration, ok := s.projectConfigs[configFile]
+	if !ok {
+		var err error
+		if configuration, err = s.loadProjectConfig(configFile); err != nil {
+			// Broken files are not read again until they change
+			log.Errorf("Loading project config %s: %v", configFile, err)
+		}
+		s.projectConfigs[configFile] = configuration
+	}
+	return configuration
+}
+
+// loadProjectConfig reads the project config file and merges it into the client settings. Relative jpaths are relative to the file
+func (s *Server) loadProjectConfig(configFile string) (*config.Configuration, error) {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(configFile, ".jsonnet") {
+		result, err := jsonnet.MakeVM().EvaluateAnonymousSnippet(configFile, string(content))
+		if err != nil {
+			return nil, err
+		}
+		content = []byte(result)
+	}
+	var project map[string]any
+	if err := json.Unmarshal(content, &project); err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+	if jpaths, ok := project["jpath"].([]any); ok {
+		for i, jpath := range jpaths {
+			if jpath, ok := jpath.(string); ok && !filepath.IsAbs(jpath) {
+				jpaths[i] = filepath.Join(filepath.Dir(configFile), jpath)
+			}
+		}
+	}
+
+	var settings map[string]any
+	if s.settings != nil {
+		settings, err = toSettingsMap(s.settings)
+	} else {
+		// Without client settings, the configuration of the command line is used. Its formatting options and relative
+		// jpaths are not marshalled like the settings
+		if settings, err = toSettingsMap(s.configuration); err == nil {
+			settings["paths"] = map[string]any{"relative_jpaths": s.configuration.RelativeJPaths()}
+			settings["formatting"], err = config.FormattingSettings(s.configuration.FormattingOptions)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config.NewConfiguration(mergeSettings(settings, project))
+}
+
+// resetProjectConfigs drops all loaded project config files. They are loaded again on the next use
+func (s *Server) resetProjectConfigs() {
+	s.projectMutex.Lock()
+	defer s.projectMutex.Unlock()
+
+	clear(s.projectConfigFiles)
+	clear(s.projectConfigs)
+}
+
+// toSettingsMap converts the settings to their JSON representation
+func toSettingsMap(settings any) (map[string]any, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling settings: %w", err)
+	}
+	result := map[string]any{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshalling settings: %w", err)
+	}
+	return result, nil
+}
+
+// mergeSettings returns the settings with all values of override set. Objects are merged, all other values are replaced
+func mergeSettings(settings, override map[string]any) map[string]any {
+	for key, value := range override {
+		valueMap, ok := value.(map[string]any)
+		settingsMap, settingsOk := settings[key].(map[string]any)
+		if ok && settingsOk {
+			settings[key] = mergeSettings(settingsMap, valueMap)
+			continue
+		}
+		settings[key] = value
+	}
+	return settings
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/go-jsonnet/formatter"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSettings(t *testing.T) {
+	settings := map[string]any{
+		"jpath":       []any{"/client"},
+		"ext_vars":    map[string]any{"env": "dev", "region": "eu"},
+		"diagnostics": map[string]any{"enable_lint_diagnostics": true},
+	}
+	override := map[string]any{
+		"jpath":       []any{"/project"},
+		"ext_vars":    map[string]any{"env": "prod"},
+		"diagnostics": false,
+	}
+	assert.Equal(t, map[string]any{
+		"jpath":       []any{"/project"},
+		"ext_vars":    map[string]any{"env": "prod", "region": "eu"},
+		"diagnostics": false,
+	}, mergeSettings(settings, override))
+}
+
+func TestProjectConfig(t *testing.T) {
+	fixture := newTestFixture(t, "project-config")
+	configFile := fixture.path(".jsonnet-language-server.json")
+	mainFile := fixture.path("sub/main.jsonnet")
+
+	server := testServer(t, nil)
+	require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{"formatting": map[string]any{}, "ext_vars": map[string]any{"env": "dev", "region": "eu"}},
+	}))
+	mainURI, mainContent := fixture.open(t, server, "sub/main.jsonnet")
+
+	evaluate := func() string {
+		result, err := server.getVM(mainFile).EvaluateAnonymousSnippet(mainFile, mainContent)
+		require.NoError(t, err)
+		return result
+	}
+	assert.Equal(t, "{\n   \"env\": \"prod\",\n   \"lib\": \"vendored\",\n   \"region\": \"eu\"\n}\n", evaluate())
+
+	edits, err := server.Formatting(context.Background(), &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: mainURI},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, applyTextEdits(t, mainContent, edits), "\n    lib: lib,\n")
+
+	// Semantic tokens are disabled by the client
+	tokens, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: mainURI},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.Data)
+
+	// The jsonnet file is used after the change is reported
+	require.NoError(t, os.Remove(configFile))
+	jsonnetConfigFile := fixture.path(".jsonnet-language-server.jsonnet")
+	require.NoError(t, os.WriteFile(jsonnetConfigFile, []byte(`{ jpath: ['vendor'], ext_vars: { env: 'from ' + 'jsonnet' } }`), 0o600))
+	assert.Contains(t, evaluate(), `"env": "prod"`)
+	require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{
+			{URI: protocol.URIFromPath(configFile), Type: protocol.Deleted},
+			{URI: protocol.URIFromPath(jsonnetConfigFile), Type: protocol.Created},
+		},
+	}))
+	assert.Contains(t, evaluate(), `"env": "from jsonnet"`)
+}
+
+func TestProjectConfigWithoutClientSettings(t *testing.T) {
+	fixture := newTestFixture(t, "project-config-ext-vars")
+	server := testServer(t, nil)
+	server.configuration.JPaths = []string{"/from/command/line"}
+	server.configuration.Diagnostics.EnableLintDiagnostics = true
+	server.configuration.FormattingOptions.Indent = 8
+	server.configuration.FormattingOptions.StringStyle = formatter.StringStyleDouble
+
+	configuration := server.configurationFor(fixture.path("main.jsonnet"))
+	assert.Equal(t, map[string]string{"env": "prod"}, configuration.ExtVars)
+	assert.Equal(t, []string{"/from/command/line"}, configuration.JPaths)
+	assert.True(t, configuration.Diagnostics.EnableLintDiagnostics)
+	assert.Equal(t, server.configuration.FormattingOptions, configuration.FormattingOptions)
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/google/go-jsonnet"
@@ -145,23 +147,9 @@ func (s *Server) findAllReferences(sourceURI protocol.DocumentURI, pos protocol.
 		pos = definition.TargetRange.Start
 	}
 
-	folders := s.configuration.JPaths
-	u, err := url.Parse(string(sourceURI))
+	allFiles, err := s.workspaceFiles(sourceURI)
 	if err != nil {
-		return nil, fmt.Errorf("invalid params uri %s", sourceURI)
-	}
-	folders = append(folders, path.Dir(u.Path))
-	allFiles := map[protocol.DocumentURI]struct{}{}
-
-	// TODO: handle deleted and created files in cache
-	for _, folder := range folders {
-		files, err := utils.GetAllJsonnetFiles(folder)
-		if err != nil {
-			return nil, err
-		}
-		for _, file := range files {
-			allFiles[protocol.URIFromPath(file)] = struct{}{}
-		}
+		return nil, err
 	}
 
 	identifier, err := s.getSelectedIdentifier(sourceURI.SpanURI().Filename(), pos)
@@ -190,8 +178,11 @@ func (s *Server) findAllReferences(sourceURI protocol.DocumentURI, pos protocol.
 	}
 
 	targetLocation := position.ProtocolToAST(pos)
-	for uri := range allFiles {
-		fileName := uri.SpanURI().Filename()
+	for _, fileName := range allFiles {
+		if !s.mayUseIdentifier(fileName, identifier) {
+			// Reading and parsing every file is slow. Skip the ones that can't reference the identifier
+			continue
+		}
 		locations, err := s.findIdentifierLocations(fileName, identifier)
 		if err != nil {
 			continue
@@ -202,13 +193,44 @@ func (s *Server) findAllReferences(sourceURI protocol.DocumentURI, pos protocol.
 		}
 		vm, root, err := s.getAst(fileName, "")
 		if err != nil {
-			return nil, fmt.Errorf("getting ast for %s: %w", fileName, err)
+			// A broken file in the workspace doesn't reference anything
+			logrus.Debugf("References: getting ast for %s: %v", fileName, err)
+			continue
 		}
 		response = append(response, s.findReference(root, &targetLocation, sourceURI.SpanURI().Filename(), vm, locations)...)
 	}
 	return response, nil
 }
 
+// mayUseIdentifier checks with the index if the file can use the identifier. Until the workspace is indexed, entries
+// can be missing or outdated, so every file may use it
+func (s *Server) mayUseIdentifier(filename, identifier string) bool {
+	return !s.index.Ready() || s.index.HasIdentifier(filename, identifier)
+}
+
+// workspaceFiles returns all jsonnet files in the jpaths and the directory of the document
+func (s *Server) workspaceFiles(sourceURI protocol.DocumentURI) ([]string, error) {
+	folders := s.jpaths(sourceURI.SpanURI().Filename())
+	u, err := url.Parse(string(sourceURI))
+	if err != nil {
+		return nil, fmt.Errorf("invalid params uri %s", sourceURI)
+	}
+	folders = append(folders, path.Dir(u.Path))
+	allFiles := map[string]struct{}{}
+
+	// TODO: handle deleted and created files in cache
+	for _, folder := range folders {
+		files, err := utils.GetAllJsonnetFiles(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			allFiles[protocol.URIFromPath(file).SpanURI().Filename()] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(allFiles)), nil
+}
+
 func (s *Server) findReference(root ast.Node, targetLocation *ast.Location, targetFilename string, vm *jsonnet.VM, testTargets []ast.LocationRange) []protocol.Location {
 	var response []protocol.Location
 
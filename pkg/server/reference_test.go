@@ -3,6 +3,7 @@ package server
 import (
 	_ "embed"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -182,6 +183,15 @@ var referenceTestCases = []referenceTestCase{
 }
 
 func TestReference(t *testing.T) {
+	testReference(t, false)
+}
+
+// Once the workspace is indexed, only the files using the identifier are searched
+func TestReferenceIndexed(t *testing.T) {
+	testReference(t, true)
+}
+
+func testReference(t *testing.T, indexed bool) {
 	for _, tc := range referenceTestCases {
 		t.Run(tc.name, func(t *testing.T) {
 			params := &protocol.ReferenceParams{
@@ -195,8 +205,12 @@ func TestReference(t *testing.T) {
 
 			server := NewServer("any", "test version", nil, config.Configuration{
 				JPaths: []string{"testdata", filepath.Join(filepath.Dir(tc.filename), "vendor")},
+				Index:  config.IndexConfig{CacheDir: t.TempDir()},
 			})
 			serverOpenTestFile(t, server, tc.filename)
+			if indexed {
+				server.indexWorkspace(server.configuration.JPaths)
+			}
 			identifier, err := server.getSelectedIdentifier(tc.filename, tc.position)
 			require.NoError(t, err)
 			assert.Equal(t, tc.identifier, identifier)
@@ -226,6 +240,27 @@ func TestReference(t *testing.T) {
 	}
 }
 
+func TestReferenceSkipsBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.libsonnet":  "{ a: 1 }",
+		"main.jsonnet":   "local lib = import 'lib.libsonnet';\nlib.a",
+		"broken.jsonnet": "local lib = import 'lib.libsonnet';\nlib.a +",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	server := NewServer("any", "test version", nil, config.Configuration{JPaths: []string{dir}})
+	libURI := serverOpenTestFile(t, server, filepath.Join(dir, "lib.libsonnet"))
+
+	response, err := server.findAllReferences(libURI, protocol.Position{Line: 0, Character: 2}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.Location{{
+		URI:   protocol.URIFromPath(filepath.Join(dir, "main.jsonnet")),
+		Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 4}, End: protocol.Position{Line: 1, Character: 5}},
+	}}, response)
+}
+
 func checkPoints(t *testing.T, points map[ast.Location]bool, begin ast.Location, end ast.Location) {
 	for loc, res := range points {
 		not := ""
@@ -2,50 +2,351 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
 
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+	sitter "github.com/tree-sitter/go-tree-sitter"
 )
 
-func (s *Server) Rename(_ context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
-	positions, err := s.findAllReferences(params.TextDocument.URI, params.Position, true)
+var keywords = []string{
+	"assert", "else", "error", "false", "for", "function", "if", "import", "importstr", "importbin",
+	"in", "local", "null", "self", "super", "tailstrict", "then", "true",
+}
+
+// renameTarget is the variable or field to rename
+type renameTarget struct {
+	name string
+	// Range of the name at the position of the request
+	locRange ast.LocationRange
+	// The node declaring a variable. Nil for fields
+	binder ast.Node
+	// The objects declaring a field
+	objects []*ast.DesugaredObject
+}
+
+func (s *Server) PrepareRename(ctx context.Context, params *protocol.PrepareRenameParams) (*protocol.PrepareRename2Gn, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareRename: %s: %w", errorRetrievingDocument, err)
+	}
+	if doc.AST == nil {
+		log.Errorf("PrepareRename: %s", errorParsingDocument)
+		return nil, nil
+	}
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareRename: parsing tree: %w", err)
+	}
+
+	target, err := s.findRenameTarget(doc, root, position.ProtocolToAST(params.Position))
 	if err != nil {
 		return nil, err
 	}
+	return &protocol.PrepareRename2Gn{
+		Range:       position.RangeASTToProtocol(target.locRange),
+		Placeholder: target.name,
+	}, nil
+}
 
-	var response protocol.WorkspaceEdit
-	edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("Rename: %s: %w", errorRetrievingDocument, err)
+	}
+	if doc.AST == nil {
+		log.Errorf("Rename: %s", errorParsingDocument)
+		return nil, nil
+	}
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		return nil, utils.LogErrorf("Rename: parsing tree: %w", err)
+	}
 
-	for _, pos := range positions {
-		localEdits := edits[pos.URI]
-		localEdits = append(localEdits, protocol.TextEdit{
-			Range:   pos.Range,
-			NewText: params.NewName,
-		})
-		edits[pos.URI] = localEdits
-	}
-
-	if s.clientCapabilities.Workspace.WorkspaceEdit.DocumentChanges {
-		for fileURI, edit := range edits {
-			doc, err := s.cache.Get(fileURI)
-			version := int32(0)
-			if err == nil {
-				version = doc.Item.Version
-			}
-			response.DocumentChanges = append(response.DocumentChanges, protocol.DocumentChanges{
-				TextDocumentEdit: &protocol.TextDocumentEdit{
-					Edits: edit,
-					TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
-						TextDocumentIdentifier: protocol.TextDocumentIdentifier{
-							URI: fileURI,
-						},
-						Version: version,
-					},
-				},
-			})
+	target, err := s.findRenameTarget(doc, root, position.ProtocolToAST(params.Position))
+	if err != nil {
+		return nil, err
+	}
+	edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+	if target.binder != nil {
+		if err := checkVariableRename(target, params.NewName); err != nil {
+			return nil, err
+		}
+		for _, highlight := range variableHighlights(doc, root, target.binder, ast.Identifier(target.name)) {
+			edits[doc.Item.URI] = append(edits[doc.Item.URI], protocol.TextEdit{Range: highlight.Range, NewText: params.NewName})
 		}
 	} else {
-		response.Changes = edits
+		for _, object := range target.objects {
+			if fieldIndex(object, params.NewName) >= 0 {
+				return nil, fmt.Errorf("the object already has a field %s", params.NewName)
+			}
+		}
+		positions, err := s.findAllReferences(params.TextDocument.URI, params.Position, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range positions {
+			edit, err := s.fieldRenameEdit(pos, params.NewName)
+			if err != nil {
+				return nil, err
+			}
+			edits[pos.URI] = append(edits[pos.URI], edit)
+		}
 	}
 
+	response := s.buildWorkspaceEdit(edits)
 	return &response, nil
 }
+
+// findRenameTarget returns the variable or field at the location. Other names like the standard library, keywords,
+// strings and import paths can't be renamed
+func (s *Server) findRenameTarget(doc *cache.Document, root *sitter.Node, location ast.Location) (*renameTarget, error) {
+	word, wordRange := wordAt(doc.Item.Text, location)
+	if slices.Contains(keywords, word) {
+		return nil, fmt.Errorf("cannot rename the keyword %s", word)
+	}
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := stack.Peek().(type) {
+	case *ast.Var:
+		if node.Id == "$" {
+			return nil, fmt.Errorf("cannot rename the keyword $")
+		}
+		if processing.FindBinder(doc.AST, node) == nil {
+			if node.Id == "std" {
+				return nil, fmt.Errorf("cannot rename the standard library")
+			}
+			return nil, fmt.Errorf("unknown variable %s", node.Id)
+		}
+	case *ast.Import, *ast.ImportStr, *ast.ImportBin:
+		return nil, fmt.Errorf("cannot rename import paths")
+	case *ast.LiteralString:
+		return s.findStringRenameTarget(doc, stack, node)
+	case *ast.Index:
+		if variable, ok := node.Target.(*ast.Var); ok && variable.Id == "std" {
+			return nil, fmt.Errorf("cannot rename functions of the standard library")
+		}
+	}
+	if word == "" {
+		return nil, fmt.Errorf("no variable or field to rename")
+	}
+
+	if binder, id := findBinderAt(doc, root, stack, location); binder != nil && string(id) == word {
+		return &renameTarget{name: word, locRange: wordRange, binder: binder}, nil
+	}
+	if field, name := fieldAtName(stack, location); field != nil {
+		return &renameTarget{name: name, locRange: wordRange, objects: fieldObjects(stack, field)}, nil
+	}
+	switch node := stack.Peek().(type) {
+	case *ast.Index, *ast.SuperIndex:
+		if index, ok := indexName(node); ok && index == word {
+			return &renameTarget{name: word, locRange: wordRange, objects: s.definitionObjects(doc, location)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no variable or field to rename")
+}
+
+// findStringRenameTarget returns the field if the string is the name of a field like `'my-field': 1` or accesses one like `obj['my-field']`
+func (s *Server) findStringRenameTarget(doc *cache.Document, stack *nodestack.NodeStack, str *ast.LiteralString) (*renameTarget, error) {
+	locRange := str.LocRange
+	if locRange.Begin.Line == locRange.End.Line && locRange.End.Column-locRange.Begin.Column == len(str.Value)+2 {
+		// Without the quotes
+		locRange.Begin.Column++
+		locRange.End.Column--
+	}
+	for i := len(stack.Stack) - 2; i >= 0; i-- {
+		switch node := stack.Stack[i].(type) {
+		case *ast.Import, *ast.ImportStr, *ast.ImportBin:
+			return nil, fmt.Errorf("cannot rename import paths")
+		case *ast.Index:
+			if node.Index == str {
+				return &renameTarget{name: str.Value, locRange: locRange, objects: s.definitionObjects(doc, str.LocRange.Begin)}, nil
+			}
+		case *ast.DesugaredObject:
+			for j := range node.Fields {
+				if node.Fields[j].Name == str {
+					return &renameTarget{name: str.Value, locRange: locRange, objects: []*ast.DesugaredObject{node}}, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot rename string literals")
+}
+
+// checkVariableRename rejects names that aren't identifiers and renames changing what variables refer to
+func checkVariableRename(target *renameTarget, newName string) error {
+	if !identifierRegexp.MatchString(newName) || slices.Contains(keywords, newName) {
+		return fmt.Errorf("%s is not a valid variable name", newName)
+	}
+	id := ast.Identifier(newName)
+	if processing.Binds(target.binder, id) {
+		return fmt.Errorf("%s is already declared in the same scope", newName)
+	}
+	// Variables of the new name declared in between would hide the renamed one
+	for _, variable := range processing.FindScopeReferences(target.binder, ast.Identifier(target.name)) {
+		path := processing.NodePath(target.binder, variable)
+		for _, node := range path[1 : len(path)-1] {
+			if processing.Binds(node, id) {
+				return fmt.Errorf("%s at %s would refer to another declaration of %s", target.name, variable.LocRange.Begin.String(), newName)
+			}
+		}
+	}
+	// The renamed variable would hide variables of the new name declared outside
+	if variables := processing.FindScopeReferences(target.binder, id); len(variables) > 0 {
+		return fmt.Errorf("%s would shadow the variable used at %s", newName, variables[0].LocRange.Begin.String())
+	}
+	return nil
+}
+
+// fieldRenameEdit renames the field at the location. Names that aren't identifiers are quoted
+func (s *Server) fieldRenameEdit(location protocol.Location, newName string) (protocol.TextEdit, error) {
+	edit := protocol.TextEdit{Range: location.Range, NewText: newName}
+	if identifierRegexp.MatchString(newName) && !slices.Contains(keywords, newName) {
+		return edit, nil
+	}
+
+	text, err := s.documentText(location.URI)
+	if err != nil {
+		return edit, err
+	}
+	start, err := position.ProtocolToOffset(text, location.Range.Start)
+	if err != nil {
+		return edit, err
+	}
+	end, err := position.ProtocolToOffset(text, location.Range.End)
+	if err != nil {
+		return edit, err
+	}
+	quoted := strings.ReplaceAll(newName, "'", `\'`)
+	before := strings.TrimRight(text[:start], " \t\n")
+	switch {
+	case start > 0 && end < len(text) && (text[start-1] == '\'' || text[start-1] == '"') && text[end] == text[start-1]:
+		// Already quoted, e.g. `obj['name']`
+		edit.NewText = quoted
+	case strings.HasSuffix(before, "."):
+		// `obj.name` becomes `obj['new-name']`
+		edit.Range.Start = position.OffsetToProtocol(text, len(before)-1)
+		edit.NewText = fmt.Sprintf("['%s']", quoted)
+	default:
+		edit.NewText = fmt.Sprintf("'%s'", quoted)
+	}
+	return edit, nil
+}
+
+// documentText returns the text of the open document or the content of the file
+func (s *Server) documentText(uri protocol.DocumentURI) (string, error) {
+	if doc, err := s.cache.Get(uri); err == nil {
+		return doc.Item.Text, nil
+	}
+	content, err := os.ReadFile(uri.SpanURI().Filename())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// definitionObjects returns the objects declaring the field accessed at the location
+func (s *Server) definitionObjects(doc *cache.Document, location ast.Location) []*ast.DesugaredObject {
+	links, err := s.findDefinition(doc.AST, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: doc.Item.URI},
+			Position:     position.ASTToProtocol(location),
+		},
+	}, s.getVM(doc.Item.URI.SpanURI().Filename()))
+	if err != nil {
+		log.Debugf("Rename: no definition at %v: %v", location, err)
+		return nil
+	}
+	var objects []*ast.DesugaredObject
+	for _, link := range links {
+		_, root, err := s.getAst(link.TargetURI.SpanURI().Filename(), "")
+		if err != nil {
+			continue
+		}
+		begin := position.ProtocolToAST(link.TargetRange.Start)
+		for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+			if object, ok := node.(*ast.DesugaredObject); ok && slices.ContainsFunc(object.Fields, func(field ast.DesugaredObjectField) bool {
+				return field.LocRange.Begin == begin
+			}) {
+				objects = append(objects, object)
+			}
+		}
+	}
+	return objects
+}
+
+// fieldObjects returns the object of the field in the stack
+func fieldObjects(stack *nodestack.NodeStack, field *ast.DesugaredObjectField) []*ast.DesugaredObject {
+	for _, node := range stack.Stack {
+		if object, ok := node.(*ast.DesugaredObject); ok {
+			for i := range object.Fields {
+				if &object.Fields[i] == field {
+					return []*ast.DesugaredObject{object}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fieldIndex returns the index of the field with the fixed name or -1
+func fieldIndex(object *ast.DesugaredObject, name string) int {
+	return slices.IndexFunc(object.Fields, func(field ast.DesugaredObjectField) bool {
+		str, ok := field.Name.(*ast.LiteralString)
+		return ok && str.Value == name
+	})
+}
+
+// indexName returns the name of a fixed index like `obj.name`
+func indexName(node ast.Node) (string, bool) {
+	var index ast.Node
+	switch node := node.(type) {
+	case *ast.Index:
+		index = node.Index
+	case *ast.SuperIndex:
+		index = node.Index
+	}
+	str, ok := index.(*ast.LiteralString)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+// wordAt returns the identifier around the location
+func wordAt(text string, location ast.Location) (string, ast.LocationRange) {
+	offset, err := position.ProtocolToOffset(text, position.ASTToProtocol(location))
+	if err != nil {
+		return "", ast.LocationRange{}
+	}
+	isIdentifierChar := func(c byte) bool {
+		return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+	start, end := offset, offset
+	for start > 0 && isIdentifierChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentifierChar(text[end]) {
+		end++
+	}
+	word := text[start:end]
+	if !identifierRegexp.MatchString(word) {
+		return "", ast.LocationRange{}
+	}
+	begin := position.ProtocolToAST(position.OffsetToProtocol(text, start))
+	return word, nameRange(begin, ast.Identifier(word))
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareRename(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fileContent   string
+		cursorAt      string
+		expectedRange string
+		// Text starting with the expected range if the name occurs earlier
+		expectedRangeAt string
+		expectedError   string
+	}{
+		{
+			name:            "variable",
+			fileContent:     "local a = 1;\na + 1\n",
+			cursorAt:        "a + 1",
+			expectedRange:   "a",
+			expectedRangeAt: "a + 1",
+		},
+		{
+			name:          "local declaration",
+			fileContent:   "local abc = 1;\nabc\n",
+			cursorAt:      "bc =",
+			expectedRange: "abc",
+		},
+		{
+			name:          "field",
+			fileContent:   "{ foo: 1 }\n",
+			cursorAt:      "foo",
+			expectedRange: "foo",
+		},
+		{
+			name:          "quoted field",
+			fileContent:   "{ 'my-field': 1 }\n",
+			cursorAt:      "'my-field'",
+			expectedRange: "my-field",
+		},
+		{
+			name:            "field access",
+			fileContent:     "local obj = { foo: 1 };\nobj.foo\n",
+			cursorAt:        "foo\n",
+			expectedRange:   "foo",
+			expectedRangeAt: "foo\n",
+		},
+		{
+			name:          "stdlib",
+			fileContent:   "std.length([])\n",
+			cursorAt:      "std",
+			expectedError: "cannot rename the standard library",
+		},
+		{
+			name:          "stdlib function",
+			fileContent:   "std.length([])\n",
+			cursorAt:      "length",
+			expectedError: "cannot rename functions of the standard library",
+		},
+		{
+			name:          "keyword",
+			fileContent:   "local a = 1;\na\n",
+			cursorAt:      "local",
+			expectedError: "cannot rename the keyword local",
+		},
+		{
+			name:          "string",
+			fileContent:   "local a = 'text';\na\n",
+			cursorAt:      "text",
+			expectedError: "cannot rename string literals",
+		},
+		{
+			name:          "import path",
+			fileContent:   "local a = import 'lib.libsonnet';\na\n",
+			cursorAt:      "lib.libsonnet",
+			expectedError: "cannot rename import paths",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+			result, err := server.PrepareRename(context.Background(), &protocol.PrepareRenameParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+					Position:     rangeOf(t, tc.fileContent, tc.cursorAt).Start,
+				},
+			})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedRange, result.Placeholder)
+			expectedRange := rangeOf(t, tc.fileContent, tc.expectedRange)
+			if tc.expectedRangeAt != "" {
+				expectedRange = rangeOf(t, tc.fileContent, tc.expectedRangeAt)
+				expectedRange.End.Character = expectedRange.Start.Character + uint32(len(tc.expectedRange))
+				expectedRange.End.Line = expectedRange.Start.Line
+			}
+			assert.Equal(t, expectedRange, result.Range)
+		})
+	}
+}
+
+func TestRename(t *testing.T) {
+	testCases := []struct {
+		name          string
+		fileContent   string
+		cursorAt      string
+		newName       string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:        "local",
+			fileContent: "local a = 1;\nlocal f(a) = a;\n{ x: a + f(a) }\n",
+			cursorAt:    "a = 1",
+			newName:     "c",
+			expected:    "local c = 1;\nlocal f(a) = a;\n{ x: c + f(c) }\n",
+		},
+		{
+			name:          "invalid variable name",
+			fileContent:   "local a = 1;\na\n",
+			cursorAt:      "a = 1",
+			newName:       "my-var",
+			expectedError: "my-var is not a valid variable name",
+		},
+		{
+			name:          "same scope",
+			fileContent:   "local a = 1, b = 2;\na + b\n",
+			cursorAt:      "a = 1",
+			newName:       "b",
+			expectedError: "b is already declared in the same scope",
+		},
+		{
+			name:          "shadowed by inner declaration",
+			fileContent:   "local a = 1;\nlocal b = 2;\na + b\n",
+			cursorAt:      "a = 1",
+			newName:       "b",
+			expectedError: "a at 3:1 would refer to another declaration of b",
+		},
+		{
+			name:          "shadowing outer variable",
+			fileContent:   "local x = 1;\nlocal f(a) = a + x;\nf(2)\n",
+			cursorAt:      "a)",
+			newName:       "x",
+			expectedError: "x would shadow the variable used at 2:18",
+		},
+		{
+			name:        "field to quoted name",
+			fileContent: "local obj = { a: 1 };\nobj.a\n",
+			cursorAt:    "a: 1",
+			newName:     "my-field",
+			expected:    "local obj = { 'my-field': 1 };\nobj['my-field']\n",
+		},
+		{
+			name:          "field collision",
+			fileContent:   "{\n  a: 1,\n  b: self.a,\n}\n",
+			cursorAt:      "a: 1",
+			newName:       "b",
+			expectedError: "the object already has a field b",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+			edit, err := server.Rename(context.Background(), &protocol.RenameParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Position:     rangeOf(t, tc.fileContent, tc.cursorAt).Start,
+				NewName:      tc.newName,
+			})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, applyTextEdits(t, tc.fileContent, edit.Changes[fileURI]))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Server) SelectionRange(ctx context.Context, params *protocol.SelectionRangeParams) ([]protocol.SelectionRange, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("SelectionRange: %s: %w", errorRetrievingDocument, err)
+	}
+
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		log.Errorf("SelectionRange: parsing tree: %v", err)
+	}
+
+	result := make([]protocol.SelectionRange, 0, len(params.Positions))
+	for _, pos := range params.Positions {
+		var ranges []protocol.Range
+		if root != nil {
+			ranges = cst.AncestorRanges(root, doc.Item.Text, pos)
+		}
+		if len(ranges) == 0 {
+			ranges = astSelectionRanges(doc, pos)
+		}
+		result = append(result, buildSelectionRange(pos, ranges))
+	}
+	return result, nil
+}
+
+// astSelectionRanges returns the ranges of all nodes of the AST containing the position, innermost first
+func astSelectionRanges(doc *cache.Document, pos protocol.Position) []protocol.Range {
+	if doc.AST == nil {
+		return nil
+	}
+	stack, err := processing.FindNodeByPosition(doc.AST, position.ProtocolToAST(pos))
+	if err != nil {
+		return nil
+	}
+
+	var ranges []protocol.Range
+	var previous ast.LocationRange
+	for i := len(stack.Stack) - 1; i >= 0; i-- {
+		loc := *stack.Stack[i].Loc()
+		// Every range has to contain the previous one
+		if !loc.Begin.IsSet() || (len(ranges) > 0 && (loc == previous || !containsRange(loc, previous))) {
+			continue
+		}
+		ranges = append(ranges, position.RangeASTToProtocol(loc))
+		previous = loc
+	}
+	return ranges
+}
+
+// buildSelectionRange links the ranges, innermost first, to a selection range. The position itself is used if there is none
+func buildSelectionRange(pos protocol.Position, ranges []protocol.Range) protocol.SelectionRange {
+	if len(ranges) == 0 {
+		return protocol.SelectionRange{Range: protocol.Range{Start: pos, End: pos}}
+	}
+	var parent *protocol.SelectionRange
+	for i := len(ranges) - 1; i > 0; i-- {
+		parent = &protocol.SelectionRange{Range: ranges[i], Parent: parent}
+	}
+	return protocol.SelectionRange{Range: ranges[0], Parent: parent}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selectionTexts returns the selected text of the selection range and all its parents
+func selectionTexts(t *testing.T, text string, selection *protocol.SelectionRange) []string {
+	t.Helper()
+	var texts []string
+	for ; selection != nil; selection = selection.Parent {
+		start, err := position.ProtocolToOffset(text, selection.Range.Start)
+		require.NoError(t, err)
+		end, err := position.ProtocolToOffset(text, selection.Range.End)
+		require.NoError(t, err)
+		texts = append(texts, text[start:end])
+	}
+	return texts
+}
+
+func TestSelectionRange(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileContent string
+		cursorAt    string
+		expected    []string
+	}{
+		{
+			name:        "index chain in a call",
+			fileContent: "local obj = { a: { b: 1 } };\n{\n  c: {\n    d: std.toString(obj.a.b),\n  },\n}",
+			cursorAt:    "a.b)",
+			expected: []string{
+				"a",
+				"obj.a",
+				"obj.a.b",
+				"std.toString(obj.a.b)",
+				"d: std.toString(obj.a.b)",
+				"{\n    d: std.toString(obj.a.b),\n  }",
+				"c: {\n    d: std.toString(obj.a.b),\n  }",
+				"{\n  c: {\n    d: std.toString(obj.a.b),\n  },\n}",
+				"local obj = { a: { b: 1 } };\n{\n  c: {\n    d: std.toString(obj.a.b),\n  },\n}",
+			},
+		},
+		{
+			name:        "cursor after an identifier",
+			fileContent: "[foo, bar]",
+			cursorAt:    ", bar",
+			expected:    []string{"foo", "[foo, bar]"},
+		},
+		{
+			name:        "non-ASCII text",
+			fileContent: "{ 'ünïcödé 👋': [foo, bar] }",
+			cursorAt:    "bar",
+			expected:    []string{"bar", "[foo, bar]", "'ünïcödé 👋': [foo, bar]", "{ 'ünïcödé 👋': [foo, bar] }"},
+		},
+		{
+			name:        "syntax error",
+			fileContent: "{\n  a: [1, 2],\n  b: obj.,\n}",
+			cursorAt:    "2]",
+			expected:    []string{"2", "[1, 2]", "a: [1, 2]", "{\n  a: [1, 2],\n  b: obj.,\n}"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fileURI := testServerWithFile(t, nil, tc.fileContent)
+			result, err := server.SelectionRange(context.Background(), &protocol.SelectionRangeParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+				Positions:    []protocol.Position{rangeOf(t, tc.fileContent, tc.cursorAt).Start},
+			})
+			require.NoError(t, err)
+			require.Len(t, result, 1)
+			assert.Equal(t, tc.expected, selectionTexts(t, tc.fileContent, &result[0]))
+		})
+	}
+}
+
+func TestASTSelectionRanges(t *testing.T) {
+	fileContent := "local obj = { a: 1 };\n{\n  b: obj.a + 1,\n}"
+	server, fileURI := testServerWithFile(t, nil, fileContent)
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+
+	// Fields aren't nodes of the AST
+	pos := rangeOf(t, fileContent, "obj.a +").Start
+	selection := buildSelectionRange(pos, astSelectionRanges(doc, pos))
+	assert.Equal(t, []string{"obj", "obj.a", "obj.a + 1", "{\n  b: obj.a + 1,\n}", fileContent}, selectionTexts(t, fileContent, &selection))
+}
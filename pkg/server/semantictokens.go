@@ -4,17 +4,18 @@ import (
 	"cmp"
 	"context"
 	"fmt"
-	"reflect"
 	"slices"
-	"strings"
+	"strconv"
 
 	"github.com/google/go-jsonnet/ast"
 	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
-	"github.com/grafana/jsonnet-language-server/pkg/nodestack"
-	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
 	"github.com/grafana/jsonnet-language-server/pkg/utils"
 	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
 	log "github.com/sirupsen/logrus"
+	sitter "github.com/tree-sitter/go-tree-sitter"
 )
 
 // These are not too long, so we just hardcode them
@@ -141,32 +142,21 @@ func getID(token protocol.SemanticTokenTypes) (uint32, error) {
 	return id, nil
 }
 
-func (m *SemanticTokenMap) addNode(loc *ast.LocationRange, nodeType protocol.SemanticTokenTypes, modifiers []protocol.SemanticTokenModifiers, overrideLength int) error {
-	id, err := getID(nodeType)
+func (m *SemanticTokenMap) addToken(token cst.SemanticToken) error {
+	id, err := getID(token.Type)
 	if err != nil {
 		return err
 	}
 
-	modifierIDs, err := getModifierIDs(modifiers)
+	modifierIDs, err := getModifierIDs(token.Modifiers)
 	if err != nil {
 		return err
 	}
 
-	if loc != nil && !loc.IsSet() {
-		return fmt.Errorf("location is not set")
-	}
-
-	var length uint32
-	// TODO: multiline
-	if overrideLength > 0 {
-		length = uint32(overrideLength)
-	} else if loc.Begin.Line == loc.End.Line {
-		length = uint32(loc.End.Column - loc.Begin.Column)
-	}
 	m.data = append(m.data, SemanticData{
-		line:           uint32(loc.Begin.Line - 1),
-		startChar:      uint32(loc.Begin.Column - 1),
-		length:         length,
+		line:           token.Range.Start.Line,
+		startChar:      token.Range.Start.Character,
+		length:         token.Range.End.Character - token.Range.Start.Character,
 		tokenID:        id,
 		tokenModifiers: modifierIDs,
 	})
@@ -174,161 +164,248 @@ func (m *SemanticTokenMap) addNode(loc *ast.LocationRange, nodeType protocol.Sem
 	return nil
 }
 
-func getKeywordLength(node ast.Node) uint32 {
-	var length int
-	switch node.(type) {
-	case *ast.SuperIndex:
-		length = len("super")
-	case *ast.Dollar:
-		length = len("$")
-	case *ast.LiteralNull:
-		length = len("null")
-	default:
-		typeString := reflect.TypeOf(node).String()
-		typeString = strings.ReplaceAll(typeString, "*ast.", "")
-		typeString = strings.ToLower(typeString)
-		length = len(typeString)
+// getTokenMap computes the tokens of the document with tree-sitter, so they are available while the document doesn't parse.
+// Variables are resolved with the AST. If rng is set, only the nodes overlapping it are tokenized and resolved
+func (s *Server) getTokenMap(ctx context.Context, doc *cache.Document, rng *protocol.Range) (SemanticTokenMap, error) {
+	root, err := cst.NewTree(ctx, doc.Item.Text)
+	if err != nil {
+		return SemanticTokenMap{}, fmt.Errorf("parsing tree: %w", err)
+	}
+	start, end := 0, len(doc.Item.Text)
+	if rng != nil {
+		if start, err = position.ProtocolToOffset(doc.Item.Text, rng.Start); err != nil {
+			return SemanticTokenMap{}, fmt.Errorf("range start: %w", err)
+		}
+		if end, err = position.ProtocolToOffset(doc.Item.Text, rng.End); err != nil {
+			// Ranges may end after the last line
+			end = len(doc.Item.Text)
+		}
+	}
+	tokens := cst.SemanticTokensInRange(root, doc.Item.Text, uint(start), uint(end))
+	if doc.AST != nil {
+		resolveVariableTokens(doc, root, tokens, rng)
 	}
 
-	return uint32(length)
+	tokenMap := SemanticTokenMap{}
+	for _, token := range tokens {
+		if err := tokenMap.addToken(token); err != nil {
+			log.Errorf("Could not add %s: %v", token.Type, err)
+		}
+	}
+	if rng != nil {
+		// Nodes overlapping the range can contain tokens outside of it
+		tokenMap.data = slices.DeleteFunc(tokenMap.data, func(token SemanticData) bool {
+			return !token.inRange(*rng)
+		})
+	}
+	return tokenMap, nil
 }
 
-func (s *Server) getTokenMap(root ast.Node) SemanticTokenMap {
-	tree := nodetree.BuildTree(nil, root)
-	tokenMap := SemanticTokenMap{}
+// resolveVariableTokens sets the type of every variable reference to the one of its declaration, e.g. parameter or
+// function. References to deprecated declarations are deprecated as well. If rng is set, only the variables overlapping it are resolved
+func resolveVariableTokens(doc *cache.Document, root *sitter.Node, tokens []cst.SemanticToken, rng *protocol.Range) {
+	declarations := map[protocol.Position]cst.SemanticToken{}
+	for _, token := range tokens {
+		if slices.Contains(token.Modifiers, protocol.ModDeclaration) {
+			declarations[token.Range.Start] = token
+		}
+	}
+	// Declarations outside of the range are tokenized when a reference needs them
+	declaration := func(begin protocol.Position) cst.SemanticToken {
+		token, ok := declarations[begin]
+		if ok || rng == nil {
+			return token
+		}
+		if offset, err := position.ProtocolToOffset(doc.Item.Text, begin); err == nil {
+			for _, declared := range cst.SemanticTokensInRange(root, doc.Item.Text, uint(offset), uint(offset)+1) {
+				if declared.Range.Start == begin {
+					token = declared
+				}
+			}
+		}
+		declarations[begin] = token
+		return token
+	}
 
-	documentstack := nodestack.NodeStack{Stack: tree.GetAllChildren()}
+	var binders map[*ast.Var]ast.Node
+	if rng != nil {
+		binders = processing.FindBindersInRange(doc.AST, ast.LocationRange{Begin: position.ProtocolToAST(rng.Start), End: position.ProtocolToAST(rng.End)})
+	} else {
+		binders = processing.FindBinders(doc.AST)
+	}
+	variables := map[protocol.Position]*ast.Var{}
+	for variable := range binders {
+		// $ is bound by a generated local of the outermost object
+		if variable.Id != "$" && variable.LocRange.Begin.IsSet() {
+			variables[position.ASTToProtocol(variable.LocRange.Begin)] = variable
+		}
+	}
 
-	searchstack := documentstack.Clone()
+	for i, token := range tokens {
+		variable, ok := variables[token.Range.Start]
+		if !ok || token.Type != protocol.VariableType || slices.Contains(token.Modifiers, protocol.ModDeclaration) {
+			continue
+		}
+		// The AST is outdated on changed lines while the document doesn't parse
+		if doc.LinesChangedSinceAST[int(token.Range.Start.Line)] || int(token.Range.End.Character-token.Range.Start.Character) != len(variable.Id) {
+			continue
+		}
 
-	for !searchstack.IsEmpty() {
-		node := searchstack.Pop()
-		var nodeType protocol.SemanticTokenTypes
-		var modifiers []protocol.SemanticTokenModifiers
-		var overrideLength = -1
-		nodeLocation := node.Loc()
-		switch currentNode := node.(type) {
-		case *ast.Self, *ast.SuperIndex, *ast.Dollar, *ast.LiteralNull:
-			modifiers = append(modifiers, protocol.ModDefaultLibrary)
-			nodeType = protocol.VariableType
-			overrideLength = int(getKeywordLength(node))
+		binder := binders[variable]
+		tokens[i].Type, tokens[i].Modifiers = variableTokenType(binder, variable.Id)
+		declared, ok := declarationRange(doc, root, binder, variable.Id)
+		if ok && slices.Contains(declaration(position.ASTToProtocol(declared.Begin)).Modifiers, protocol.ModDeprecated) {
+			tokens[i].Modifiers = append(tokens[i].Modifiers, protocol.ModDeprecated)
+		}
+	}
+}
 
-		case *ast.Import:
-			nodeType = protocol.KeywordType
-			overrideLength = int(getKeywordLength(node))
-		case *ast.Local:
-			nodeType = protocol.KeywordType
-			overrideLength = int(getKeywordLength(node))
-			searchstack.Push(currentNode.Body)
-
-		case *ast.Apply:
-			// Add the args to the search stack to allow coloring function arguments
-			for _, arg := range currentNode.Arguments.Named {
-				searchstack.Push(arg.Arg)
+// variableTokenType returns the token type of a variable bound by binder
+func variableTokenType(binder ast.Node, id ast.Identifier) (protocol.SemanticTokenTypes, []protocol.SemanticTokenModifiers) {
+	var binds ast.LocalBinds
+	switch binder := binder.(type) {
+	case nil:
+		if id == utils.StdIdentifier {
+			return protocol.VariableType, []protocol.SemanticTokenModifiers{protocol.ModDefaultLibrary}
+		}
+	case *ast.Function:
+		// The parameters of the generated functions of comprehensions have no location
+		for _, param := range binder.Parameters {
+			if param.Name == id && param.LocRange.Begin.IsSet() {
+				return protocol.ParameterType, nil
 			}
+		}
+	case *ast.Local:
+		binds = binder.Binds
+	case *ast.DesugaredObject:
+		binds = binder.Locals
+	}
+	for _, bind := range binds {
+		if bind.Variable != id {
+			continue
+		}
+		switch bind.Body.(type) {
+		case *ast.Function:
+			return protocol.FunctionType, nil
+		case *ast.Import:
+			return protocol.NamespaceType, nil
+		}
+	}
+	return protocol.VariableType, nil
+}
 
-			for _, arg := range currentNode.Arguments.Positional {
-				searchstack.Push(arg.Expr)
-			}
+// inRange checks if the token overlaps the range
+func (d SemanticData) inRange(rng protocol.Range) bool {
+	begin := protocol.Position{Line: d.line, Character: d.startChar}
+	end := protocol.Position{Line: d.line, Character: d.startChar + d.length}
+	return positionBefore(rng.Start, end) && positionBefore(begin, rng.End)
+}
 
-			targetIndex, ok := currentNode.Target.(*ast.Index)
-			if !ok {
-				break
-			}
-			indexName, ok := targetIndex.Index.(*ast.LiteralString)
-			if !ok {
-				break
-			}
-			// Index spans the all before it as well. So we have to start at the end and subtract the len of the index
-			nodeLocation.End = targetIndex.Loc().End
-			// They are always on the same line
-			nodeLocation.Begin.Line = targetIndex.Loc().End.Line
-			nodeLocation.Begin.Column = max(0, nodeLocation.End.Column-len(indexName.Value))
-			nodeType = protocol.FunctionType
-		case *ast.Index:
-			nodeType = protocol.VariableType
-		case *ast.Var:
-			nodeType = protocol.VariableType
-			if currentNode.Id == utils.StdIdentifier {
-				modifiers = append(modifiers, protocol.ModDefaultLibrary)
-				break
-			}
+// positionBefore checks if a is strictly before b
+func positionBefore(a, b protocol.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
 
-			if currentNode.Id == "$" {
-				nodeType = protocol.KeywordType
-				overrideLength = 1
-				break
-			}
+// semanticTokensOptions advertises full, delta and range requests. The full field of protocol.SemanticTokensOptions can't
+// express delta support
+type semanticTokensOptions struct {
+	Legend protocol.SemanticTokensLegend        `json:"legend"`
+	Range  bool                                 `json:"range"`
+	Full   protocol.PFullESemanticTokensOptions `json:"full"`
+}
 
-			stackForNode, err := processing.FindNodeInStack(currentNode, &documentstack)
-			if err != nil {
-				log.Errorf("Could not find %s in documentstack: %v", currentNode.Id, err)
-				continue
-			}
-			resolved := processing.FindNodeByIDWithOptions(stackForNode, currentNode.Id, true)
-			if resolved != nil {
-				switch resolved.(type) {
-				case *ast.Import:
-					nodeType = protocol.NamespaceType
-				case *ast.Self:
-					modifiers = append(modifiers, protocol.ModDefaultLibrary)
-					nodeType = protocol.VariableType
-				}
-			} else {
-				// TODO: Currently the function arguments are not on the stack. Therefore we can't find function arguments. For now we'll just assume all variables we can't find are function arguments
-				nodeType = protocol.ParameterType
-			}
-			// TODO: if it is import -> namespace type
-		case *ast.LiteralString:
-			nodeType = protocol.StringType
-		case *ast.LiteralNumber:
-			nodeType = protocol.NumberType
-		case *ast.LiteralBoolean:
-			modifiers = append(modifiers, protocol.ModDefaultLibrary)
-		case *ast.Conditional:
-			searchstack.Push(currentNode.BranchFalse)
-			searchstack.Push(currentNode.BranchTrue)
-			searchstack.Push(currentNode.Cond)
-		case *ast.DesugaredObject:
-			for _, assert := range currentNode.Asserts {
-				searchstack.Push(assert)
-			}
-		default:
-			log.Tracef("[SEMANTIC] Unhandled node of type %T", currentNode)
-		}
+// semanticTokensResult is the last result sent for a document. Deltas are computed against it
+type semanticTokensResult struct {
+	resultID string
+	data     []uint32
+}
 
-		if len(nodeType) > 0 && nodeLocation.IsSet() {
-			err := tokenMap.addNode(nodeLocation, nodeType, modifiers, overrideLength)
-			if err != nil {
-				log.Errorf("Could not add %s: %v", nodeType, err)
-			}
-		}
+func (s *Server) SemanticTokensFull(ctx context.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
+	data, err := s.semanticTokens(ctx, params.TextDocument.URI, nil)
+	if err != nil || data == nil {
+		return nil, err
 	}
-	return tokenMap
+	return &protocol.SemanticTokens{ResultID: s.storeSemanticTokens(params.TextDocument.URI, data), Data: data}, nil
 }
 
-func (s *Server) SemanticTokensFull(_ context.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
-	tokens := protocol.SemanticTokens{
-		Data: []uint32{},
+func (s *Server) SemanticTokensRange(ctx context.Context, params *protocol.SemanticTokensRangeParams) (*protocol.SemanticTokens, error) {
+	data, err := s.semanticTokens(ctx, params.TextDocument.URI, &params.Range)
+	if err != nil || data == nil {
+		return nil, err
 	}
-	if !s.configuration.EnableSemanticTokens {
-		return &tokens, nil
+	return &protocol.SemanticTokens{Data: data}, nil
+}
+
+// SemanticTokensFullDelta returns the edits to the previous result. All tokens are returned if the client refers to an older result
+func (s *Server) SemanticTokensFullDelta(ctx context.Context, params *protocol.SemanticTokensDeltaParams) (interface{}, error) {
+	data, err := s.semanticTokens(ctx, params.TextDocument.URI, nil)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	s.semanticTokensMutex.Lock()
+	previous, ok := s.semanticTokensResults[params.TextDocument.URI]
+	s.semanticTokensMutex.Unlock()
+
+	resultID := s.storeSemanticTokens(params.TextDocument.URI, data)
+	if !ok || previous.resultID != params.PreviousResultID {
+		return &protocol.SemanticTokens{ResultID: resultID, Data: data}, nil
+	}
+	return &protocol.SemanticTokensDelta{ResultID: resultID, Edits: semanticTokensEdits(previous.data, data)}, nil
+}
+
+// semanticTokens computes the encoded tokens of the document. Only tokens in rng are computed if it is set
+func (s *Server) semanticTokens(ctx context.Context, uri protocol.DocumentURI, rng *protocol.Range) ([]uint32, error) {
+	if !s.configurationFor(uri.SpanURI().Filename()).EnableSemanticTokens {
+		return []uint32{}, nil
 	}
 
-	doc, err := s.cache.Get(params.TextDocument.URI)
+	doc, err := s.cache.Get(uri)
 	if err != nil {
-		log.Errorf("Could not get document: %v", err)
-		return nil, utils.LogErrorf("Completion: %s: %w", errorRetrievingDocument, err)
+		return nil, utils.LogErrorf("SemanticTokens: %s: %w", errorRetrievingDocument, err)
 	}
 
-	if doc.AST == nil {
-		log.Errorf("Completion: document %s was never successfully parsed, can't autocomplete", params.TextDocument.URI)
-		return nil, nil
+	tokenMap, err := s.getTokenMap(ctx, doc, rng)
+	if err != nil {
+		return nil, utils.LogErrorf("SemanticTokens: %w", err)
 	}
+	return tokenMap.asIntArray(), nil
+}
 
-	tokenMap := s.getTokenMap(doc.AST)
+// storeSemanticTokens remembers the tokens sent for the document and returns their result ID
+func (s *Server) storeSemanticTokens(uri protocol.DocumentURI, data []uint32) string {
+	resultID := strconv.FormatUint(s.semanticTokensID.Add(1), 10)
+
+	s.semanticTokensMutex.Lock()
+	defer s.semanticTokensMutex.Unlock()
+	s.semanticTokensResults[uri] = semanticTokensResult{resultID: resultID, data: data}
+	return resultID
+}
 
-	tokens.Data = tokenMap.asIntArray()
+// forgetSemanticTokens drops the last result of the closed document
+func (s *Server) forgetSemanticTokens(uri protocol.DocumentURI) {
+	s.semanticTokensMutex.Lock()
+	defer s.semanticTokensMutex.Unlock()
+	delete(s.semanticTokensResults, uri)
+}
 
-	return &tokens, nil
+// semanticTokensEdits returns a single edit replacing everything between the common prefix and suffix of the tokens
+func semanticTokensEdits(previous, current []uint32) []protocol.SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(previous) && prefix < len(current) && previous[prefix] == current[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(previous)-prefix && suffix < len(current)-prefix &&
+		previous[len(previous)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(previous) && prefix == len(current) {
+		return []protocol.SemanticTokensEdit{}
+	}
+	return []protocol.SemanticTokensEdit{{
+		Start:       uint32(prefix),
+		DeleteCount: uint32(len(previous) - prefix - suffix),
+		Data:        current[prefix : len(current)-suffix],
+	}}
 }
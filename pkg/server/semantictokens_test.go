@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenLines returns the line of each encoded token
+func tokenLines(data []uint32) []uint32 {
+	var lines []uint32
+	var line uint32
+	for i := 0; i+4 < len(data); i += 5 {
+		line += data[i]
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func applySemanticTokensEdits(data []uint32, edits []protocol.SemanticTokensEdit) []uint32 {
+	result := slices.Clone(data)
+	for _, edit := range slices.Backward(edits) {
+		result = slices.Replace(result, int(edit.Start), int(edit.Start+edit.DeleteCount), edit.Data...)
+	}
+	return result
+}
+
+func TestSemanticTokensEdits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		previous []uint32
+		current  []uint32
+		expected []protocol.SemanticTokensEdit
+	}{
+		{
+			name:     "unchanged",
+			previous: []uint32{1, 2, 3},
+			current:  []uint32{1, 2, 3},
+			expected: []protocol.SemanticTokensEdit{},
+		},
+		{
+			name:     "changed in the middle",
+			previous: []uint32{1, 2, 3, 4},
+			current:  []uint32{1, 5, 6, 4},
+			expected: []protocol.SemanticTokensEdit{{Start: 1, DeleteCount: 2, Data: []uint32{5, 6}}},
+		},
+		{
+			name:     "appended",
+			previous: []uint32{1, 2},
+			current:  []uint32{1, 2, 3},
+			expected: []protocol.SemanticTokensEdit{{Start: 2, DeleteCount: 0, Data: []uint32{3}}},
+		},
+		{
+			name:     "removed",
+			previous: []uint32{1, 2, 2, 3},
+			current:  []uint32{1, 2, 3},
+			expected: []protocol.SemanticTokensEdit{{Start: 2, DeleteCount: 1, Data: []uint32{}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			edits := semanticTokensEdits(tc.previous, tc.current)
+			assert.Equal(t, tc.expected, edits)
+			assert.Equal(t, tc.current, applySemanticTokensEdits(tc.previous, edits))
+		})
+	}
+}
+
+func TestSemanticTokensRange(t *testing.T) {
+	content := "local a = 1;\nlocal b = a + 2;\nlocal c = b + 3;\n{ a: a, b: b, c: c }\n"
+	server, fileURI := testServerWithFile(t, nil, content)
+	server.configuration.EnableSemanticTokens = true
+
+	full, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}})
+	require.NoError(t, err)
+	assert.Contains(t, tokenLines(full.Data), uint32(0))
+	assert.Contains(t, tokenLines(full.Data), uint32(2))
+
+	tokens, err := server.SemanticTokensRange(context.Background(), &protocol.SemanticTokensRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+		Range:        protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: 2}},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.Data)
+	for _, line := range tokenLines(tokens.Data) {
+		assert.Equal(t, uint32(1), line)
+	}
+}
+
+func TestSemanticTokensFullDelta(t *testing.T) {
+	content := "local a = 1;\na + 2\n"
+	server, fileURI := testServerWithFile(t, nil, content)
+	server.configuration.EnableSemanticTokens = true
+	document := protocol.TextDocumentIdentifier{URI: fileURI}
+
+	full, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{TextDocument: document})
+	require.NoError(t, err)
+	require.NotEmpty(t, full.ResultID)
+
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: document, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "local a = 1;\nlocal b = 'text';\na + 2\n"}},
+	}))
+	expected, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{TextDocument: document})
+	require.NoError(t, err)
+
+	// The last result is now the one of expected
+	result, err := server.SemanticTokensFullDelta(context.Background(), &protocol.SemanticTokensDeltaParams{TextDocument: document, PreviousResultID: full.ResultID})
+	require.NoError(t, err)
+	require.IsType(t, &protocol.SemanticTokens{}, result)
+	assert.Equal(t, expected.Data, result.(*protocol.SemanticTokens).Data)
+	previousID := result.(*protocol.SemanticTokens).ResultID
+
+	require.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: document, Version: 3},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: content}},
+	}))
+	result, err = server.SemanticTokensFullDelta(context.Background(), &protocol.SemanticTokensDeltaParams{TextDocument: document, PreviousResultID: previousID})
+	require.NoError(t, err)
+	require.IsType(t, &protocol.SemanticTokensDelta{}, result)
+	delta := result.(*protocol.SemanticTokensDelta)
+	assert.NotEqual(t, previousID, delta.ResultID)
+	assert.Equal(t, full.Data, applySemanticTokensEdits(expected.Data, delta.Edits))
+}
+
+func TestSemanticTokensResolveVariables(t *testing.T) {
+	content := "// Deprecated: use g\nlocal old(x) = x;\nlocal lib = import 'lib.libsonnet';\nlocal g(x) = [old(x), lib, std.length(x)] + [y for y in x];\ng(1)\n"
+	server, fileURI := testServerWithFile(t, nil, content)
+	server.configuration.EnableSemanticTokens = true
+
+	result, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{TextDocument: protocol.TextDocumentIdentifier{URI: fileURI}})
+	require.NoError(t, err)
+	tokens := map[protocol.Position]SemanticData{}
+	var previous SemanticData
+	for i := 0; i+4 < len(result.Data); i += 5 {
+		token := SemanticData{line: previous.line + result.Data[i], startChar: result.Data[i+1]}
+		if result.Data[i] == 0 {
+			token.startChar += previous.startChar
+		}
+		token.length, token.tokenID, token.tokenModifiers = result.Data[i+2], result.Data[i+3], result.Data[i+4]
+		tokens[protocol.Position{Line: token.line, Character: token.startChar}] = token
+		previous = token
+	}
+
+	testCases := []struct {
+		name      string
+		position  protocol.Position
+		tokenType protocol.SemanticTokenTypes
+		modifiers []protocol.SemanticTokenModifiers
+	}{
+		{name: "parameter", position: protocol.Position{Line: 1, Character: 15}, tokenType: protocol.ParameterType},
+		{name: "deprecated declaration", position: protocol.Position{Line: 1, Character: 6}, tokenType: protocol.FunctionType, modifiers: []protocol.SemanticTokenModifiers{protocol.ModDeclaration, protocol.ModDeprecated}},
+		{name: "deprecated function", position: protocol.Position{Line: 3, Character: 14}, tokenType: protocol.FunctionType, modifiers: []protocol.SemanticTokenModifiers{protocol.ModDeprecated}},
+		{name: "parameter in argument", position: protocol.Position{Line: 3, Character: 18}, tokenType: protocol.ParameterType},
+		{name: "import", position: protocol.Position{Line: 3, Character: 22}, tokenType: protocol.NamespaceType},
+		{name: "std", position: protocol.Position{Line: 3, Character: 27}, tokenType: protocol.VariableType, modifiers: []protocol.SemanticTokenModifiers{protocol.ModDefaultLibrary}},
+		{name: "std function", position: protocol.Position{Line: 3, Character: 31}, tokenType: protocol.FunctionType},
+		{name: "comprehension variable", position: protocol.Position{Line: 3, Character: 45}, tokenType: protocol.VariableType},
+		{name: "parameter in comprehension", position: protocol.Position{Line: 3, Character: 56}, tokenType: protocol.ParameterType},
+		{name: "function", position: protocol.Position{Line: 4, Character: 0}, tokenType: protocol.FunctionType},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, ok := tokens[tc.position]
+			require.True(t, ok)
+			expectedModifiers, err := getModifierIDs(tc.modifiers)
+			require.NoError(t, err)
+			assert.Equal(t, TokenToIntMap[tc.tokenType], token.tokenID)
+			assert.Equal(t, expectedModifiers, token.tokenModifiers)
+		})
+	}
+}
+
+func TestSemanticTokensRangeResolveVariables(t *testing.T) {
+	content := "// Deprecated: use g\nlocal old(x) = x;\nlocal lib = import 'lib.libsonnet';\nlocal g(x) = [old(x), lib, std.length(x)] + [y for y in x];\ng(1)\n"
+	server, fileURI := testServerWithFile(t, nil, content)
+	server.configuration.EnableSemanticTokens = true
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+
+	for _, rng := range []protocol.Range{
+		{Start: protocol.Position{Line: 3}, End: protocol.Position{Line: 4}},
+		{Start: protocol.Position{Line: 3, Character: 14}, End: protocol.Position{Line: 3, Character: 30}},
+		{Start: protocol.Position{Line: 4}, End: protocol.Position{Line: 10}},
+	} {
+		full, err := server.getTokenMap(context.Background(), doc, nil)
+		require.NoError(t, err)
+		expected := slices.DeleteFunc(full.data, func(token SemanticData) bool { return !token.inRange(rng) })
+
+		// Declarations outside of the range are still used, e.g. the deprecated old
+		actual, err := server.getTokenMap(context.Background(), doc, &rng)
+		require.NoError(t, err)
+		require.NotEmpty(t, actual.data)
+		assert.ElementsMatch(t, expected, actual.data)
+	}
+}
@@ -2,15 +2,17 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"path/filepath"
-	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
 	"github.com/grafana/jsonnet-language-server/pkg/cache"
+	"github.com/grafana/jsonnet-language-server/pkg/cst"
+	"github.com/grafana/jsonnet-language-server/pkg/index"
 	"github.com/grafana/jsonnet-language-server/pkg/server/completion"
 	"github.com/grafana/jsonnet-language-server/pkg/server/config"
 	"github.com/grafana/jsonnet-language-server/pkg/stdlib"
@@ -32,10 +34,17 @@ func NewServer(name, version string, client protocol.ClientCloser, configuration
 		name:          name,
 		version:       version,
 		cache:         cache.New(),
+		index:         index.New(),
 		client:        client,
 		configuration: configuration,
 
 		diagQueue: make(map[protocol.DocumentURI]struct{}),
+
+		semanticTokensResults: make(map[protocol.DocumentURI]semanticTokensResult),
+		codeLensResults:       make(map[protocol.DocumentURI]codeLensResult),
+
+		projectConfigFiles: make(map[string]string),
+		projectConfigs:     make(map[string]*config.Configuration),
 	}
 
 	return server
@@ -48,17 +57,38 @@ type Server struct {
 	stdlib    []stdlib.Function
 	stdlibMap map[string]stdlib.Function
 	cache     *cache.Cache
+	index     *index.Index
 	client    protocol.ClientCloser
 
-	initParams         *protocol.ParamInitialize
-	configuration      config.Configuration
+	initParams    *protocol.ParamInitialize
+	configuration config.Configuration
+	// The last settings sent by the client
+	settings           any
 	clientCapabilities protocol.ClientCapabilities
 
+	// Workspace folders
+	foldersMutex sync.RWMutex
+	folders      []*workspaceFolder
+
+	// Project config files. Directory -> nearest config file and config file -> merged configuration
+	projectMutex       sync.Mutex
+	projectConfigFiles map[string]string
+	projectConfigs     map[string]*config.Configuration
+
 	// Diagnostics
 	diagMutex   sync.RWMutex
 	diagQueue   map[protocol.DocumentURI]struct{}
 	diagRunning sync.Map
 
+	// Semantic tokens
+	semanticTokensMutex   sync.Mutex
+	semanticTokensResults map[protocol.DocumentURI]semanticTokensResult
+	semanticTokensID      atomic.Uint64
+
+	// Code lenses
+	codeLensMutex   sync.Mutex
+	codeLensResults map[protocol.DocumentURI]codeLensResult
+
 	// Completion
 	completionProvider *completion.Completion
 }
@@ -69,27 +99,34 @@ func (s *Server) GetCache() *cache.Cache {
 
 func (s *Server) getVM(path string) *jsonnet.VM {
 	var vm *jsonnet.VM
-	if s.configuration.ResolvePathsWithTanka {
-		jpath, _, _, err := jpath.Resolve(path, false)
-		if err != nil {
-			log.Debugf("Unable to resolve jpath for %s: %s", path, err)
-			// nolint: gocritic
-			jpath = append(s.configuration.JPaths, filepath.Dir(path))
-		}
-		vm = tankaJsonnet.MakeRawVM(jpath, nil, nil, 0)
+	jpaths := s.importJPaths(path)
+	if s.configurationFor(path).ResolvePathsWithTanka {
+		vm = tankaJsonnet.MakeRawVM(jpaths, nil, nil, 0)
 	} else {
-		// nolint: gocritic
-		jpath := append(s.configuration.JPaths, filepath.Dir(path))
 		vm = jsonnet.MakeVM()
-		importer := &jsonnet.FileImporter{JPaths: jpath}
+		importer := &jsonnet.FileImporter{JPaths: jpaths}
 		vm.Importer(importer)
 	}
 
-	resetExtVars(vm, s.configuration.ExtVars, s.configuration.ExtCode)
+	extVars, extCode := s.extVars(path)
+	resetExtVars(vm, extVars, extCode)
 	return vm
 }
 
-func (s *Server) DidChange(_ context.Context, params *protocol.DidChangeTextDocumentParams) error {
+// importJPaths returns the jpaths imports of the file are resolved with. Like all jpaths, the last one has the highest precedence
+func (s *Server) importJPaths(path string) []string {
+	jpaths := append(s.jpaths(path), filepath.Dir(path))
+	if s.configurationFor(path).ResolvePathsWithTanka {
+		tankaJPaths, _, _, err := jpath.Resolve(path, false)
+		if err == nil {
+			return tankaJPaths
+		}
+		log.Debugf("Unable to resolve jpath for %s: %s", path, err)
+	}
+	return jpaths
+}
+
+func (s *Server) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
 	defer s.queueDiagnostics(params.TextDocument.URI)
 
 	doc, err := s.cache.Get(params.TextDocument.URI)
@@ -99,12 +136,14 @@ func (s *Server) DidChange(_ context.Context, params *protocol.DidChangeTextDocu
 
 	if params.TextDocument.Version > doc.Item.Version && len(params.ContentChanges) != 0 {
 		oldText := doc.Item.Text
-		// TODO: this is not LSP compatible. A change event might be limited by the range
-		doc.Item.Text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		if err := doc.ApplyChanges(params.ContentChanges); err != nil {
+			return utils.LogErrorf("DidChange: applying changes: %w", err)
+		}
+		doc.Item.Version = params.TextDocument.Version
 
 		var ast ast.Node
-		// Since go is stupid we are unable to get the internal error type and thus cannot get the error location. Nice one!
-		ast, doc.Err = s.getFixedAst(doc.Item.URI.SpanURI().Filename(), doc.Item.Text, oldText)
+		editLine := getEditLine(oldText, doc.Item.Text, params.ContentChanges)
+		ast, doc.Err = cst.RecoverAST(ctx, doc.Item.URI.SpanURI().Filename(), doc.Item.Text, editLine)
 
 		// If the AST parsed correctly, set it on the document
 		// Otherwise, keep the old AST, and find all the lines that have changed since last AST
@@ -122,76 +161,62 @@ func (s *Server) DidChange(_ context.Context, params *protocol.DidChangeTextDocu
 		}
 	}
 
+	s.updateIndexes(doc)
 	return s.cache.Put(doc)
 }
 
-func getDiffPosition(newText string, oldText string) int {
-	for i := range newText {
-		if i >= len(oldText) {
-			return i
-		}
-		if i >= len(newText) {
-			return i
-		}
-		if newText[i] != oldText[i] {
-			return i
-		}
+// updateIndexes records the imports of the document in the import graph of the cache and its symbols in the workspace index
+func (s *Server) updateIndexes(doc *cache.Document) {
+	if doc.AST == nil {
+		return
 	}
-	return 0
+	filename := doc.Item.URI.SpanURI().Filename()
+	processor := processing.NewProcessor(s.cache, s.getVM(filename))
+	s.cache.SetImports(filename, processor.ResolveImports(filename, doc.AST))
+	s.index.Update(filename, doc.AST)
 }
 
-func (s *Server) getFixedAst(filename string, newText string, oldText string) (ast.Node, error) {
-	// TODO: Use treesitter and the lookahead iterator
-	// Try new text without modification
-	ast, err := jsonnet.SnippetToAST(filename, newText)
-	if err == nil {
-		return ast, nil
-	}
-	// TODO: make proper diff
-	diffLocation := getDiffPosition(newText, oldText)
-	lineEndingLocation := strings.Index(newText[diffLocation:], "\n") + diffLocation
-	removeEndings := []rune{'.', ','}
-	// Add ".a" to fix "super". This will insert an extra index, but it doesn't seem to break anything
-	addEndings := []string{";", "),", ",", ")", "[]", "{}", ".a", "]", "],", `";`}
-
-	// First remove all endings
-	for len(newText) > 0 && lineEndingLocation > 0 && slices.Contains(removeEndings, rune(newText[lineEndingLocation-1])) {
-		newText = newText[:lineEndingLocation-1] + newText[lineEndingLocation:]
-		lineEndingLocation--
+// getEditLine returns the line the last change ends on. This is most likely where the user is currently typing
+func getEditLine(oldText string, newText string, changes []protocol.TextDocumentContentChangeEvent) int {
+	if len(changes) == 0 {
+		return -1
 	}
-	// Try to fix ast with all suffixes removed
-	ast, err = jsonnet.SnippetToAST(filename, newText)
-	if err == nil {
-		return ast, nil
+	lastChange := changes[len(changes)-1]
+	if lastChange.Range != nil {
+		return int(lastChange.Range.Start.Line) + strings.Count(lastChange.Text, "\n")
 	}
 
-	// Then add fixed endings
-	for _, ending := range addEndings {
-		// Ensure the line ends with ending
-		testText := newText[:lineEndingLocation] + ending + newText[lineEndingLocation:]
-		ast, err := jsonnet.SnippetToAST(filename, testText)
-		if err == nil {
-			log.Infof("Fixed ast with %v", ending)
-			return ast, nil
+	// Full document change. Use the first line that differs
+	oldLines := strings.Split(oldText, "\n")
+	for i, line := range strings.Split(newText, "\n") {
+		if i >= len(oldLines) || line != oldLines[i] {
+			return i
 		}
 	}
-
-	log.Warnf("Unable to fix ast!")
-	return nil, fmt.Errorf("unable to fix ast")
+	return -1
 }
 
-func (s *Server) DidOpen(_ context.Context, params *protocol.DidOpenTextDocumentParams) (err error) {
+func (s *Server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) (err error) {
 	defer s.queueDiagnostics(params.TextDocument.URI)
 
 	doc := &cache.Document{Item: params.TextDocument, LinesChangedSinceAST: map[int]bool{}}
 	if params.TextDocument.Text != "" {
-		doc.AST, doc.Err = jsonnet.SnippetToAST(params.TextDocument.URI.SpanURI().Filename(), params.TextDocument.Text)
+		doc.AST, doc.Err = cst.RecoverAST(ctx, params.TextDocument.URI.SpanURI().Filename(), params.TextDocument.Text, -1)
 	}
+	s.updateIndexes(doc)
 	return s.cache.Put(doc)
 }
 
 func (s *Server) DidClose(_ context.Context, params *protocol.DidCloseTextDocumentParams) error {
 	s.cache.Remove(params.TextDocument.URI)
+	s.forgetSemanticTokens(params.TextDocument.URI)
+	s.forgetCodeLenses(params.TextDocument.URI)
+	// The document might not have been saved
+	filename := params.TextDocument.URI.SpanURI().Filename()
+	if err := s.index.UpdateFile(filename); err != nil {
+		log.Debugf("DidClose: %v", err)
+		s.index.Remove(filename)
+	}
 	return nil
 }
 
@@ -200,11 +225,17 @@ func (s *Server) Initialize(_ context.Context, params *protocol.ParamInitialize)
 	s.initParams = params
 
 	s.diagnosticsLoop()
-	// TODO: this is probably not a JPath
-	for _, folder := range params.WorkspaceFolders {
-		s.configuration.JPaths = append(s.configuration.JPaths, folder.Name)
+	folders := params.WorkspaceFolders
+	if len(folders) == 0 && params.RootURI != "" {
+		// Clients without support for workspace folders
+		rootPath := params.RootURI.SpanURI().Filename()
+		folders = []protocol.WorkspaceFolder{{URI: string(params.RootURI), Name: filepath.Base(rootPath)}}
 	}
+	s.setWorkspaceFolders(folders)
 	s.clientCapabilities = params.Capabilities
+	indexFolders := s.indexFolders()
+	s.loadIndex(indexFolders)
+	go s.indexWorkspace(indexFolders)
 
 	var err error
 
@@ -227,27 +258,52 @@ func (s *Server) Initialize(_ context.Context, params *protocol.ParamInitialize)
 			DefinitionProvider:         true,
 			DocumentFormattingProvider: true,
 			DocumentSymbolProvider:     true,
+			DocumentHighlightProvider:  true,
 			ReferencesProvider:         true,
+			WorkspaceSymbolProvider:    true,
 			ExecuteCommandProvider: protocol.ExecuteCommandOptions{Commands: []string{
 				"jsonnet.evalItem",
 				"jsonnet.evalFile",
 				"jsonnet.evalExpression",
+				createFileCommand,
 			}},
 			TextDocumentSync: &protocol.TextDocumentSyncOptions{
-				Change:    protocol.Full,
+				Change:    protocol.Incremental,
 				OpenClose: true,
 				Save: protocol.SaveOptions{
 					IncludeText: false,
 				},
 			},
-			RenameProvider: true,
+			RenameProvider: protocol.RenameOptions{PrepareProvider: true},
 			SignatureHelpProvider: protocol.SignatureHelpOptions{
 				TriggerCharacters: []string{"(", ","},
 			},
-			InlayHintProvider: true,
-			SemanticTokensProvider: protocol.SemanticTokensOptions{
-				Range: false,
-				Full:  true,
+			InlayHintProvider:      true,
+			FoldingRangeProvider:   true,
+			SelectionRangeProvider: true,
+			CallHierarchyProvider:  true,
+			DocumentLinkProvider:   protocol.DocumentLinkOptions{ResolveProvider: true},
+			CodeLensProvider:       &protocol.CodeLensOptions{},
+			TypeHierarchyProvider:  true,
+			CodeActionProvider: protocol.CodeActionOptions{
+				CodeActionKinds: []protocol.CodeActionKind{protocol.QuickFix, protocol.RefactorExtract, protocol.RefactorInline, protocol.RefactorRewrite},
+				ResolveProvider: true,
+			},
+			Workspace: protocol.Workspace6Gn{
+				WorkspaceFolders: protocol.WorkspaceFolders5Gn{
+					Supported:           true,
+					ChangeNotifications: "workspace/didChangeWorkspaceFolders",
+				},
+				FileOperations: protocol.FileOperationOptions{
+					WillRename: fileOperationFilters,
+					DidRename:  fileOperationFilters,
+					DidCreate:  fileOperationFilters,
+					DidDelete:  fileOperationFilters,
+				},
+			},
+			SemanticTokensProvider: semanticTokensOptions{
+				Range: true,
+				Full:  protocol.PFullESemanticTokensOptions{Delta: true},
 				Legend: protocol.SemanticTokensLegend{
 					TokenTypes:     s.GetSemanticTokenTypes(),
 					TokenModifiers: s.GetSemanticTokenModifiers(),
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDidChangeIncremental(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "local a = 'ä';\n{ foo: a }\n")
+
+	err := server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI},
+			Version:                2,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{
+			// Replace 'ä' with 'b'. The range is in UTF-16 code units
+			{
+				Range: &protocol.Range{
+					Start: protocol.Position{Line: 0, Character: 11},
+					End:   protocol.Position{Line: 0, Character: 12},
+				},
+				Text: "b",
+			},
+			// Rename the field. This change is relative to the previous one
+			{
+				Range: &protocol.Range{
+					Start: protocol.Position{Line: 1, Character: 2},
+					End:   protocol.Position{Line: 1, Character: 5},
+				},
+				Text: "bar",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+	assert.Equal(t, "local a = 'b';\n{ bar: a }\n", doc.Item.Text)
+	assert.Equal(t, int32(2), doc.Item.Version)
+	assert.NoError(t, doc.Err)
+
+	// A change without a range replaces the whole document
+	err = server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI},
+			Version:                3,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{}"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", doc.Item.Text)
+}
+
+func TestDidChangeRecoversAST(t *testing.T) {
+	server, fileURI := testServerWithFile(t, nil, "local obj = { a: 1 };\n{\n  a: obj.a,\n  b: obj.a,\n}\n")
+
+	err := server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI},
+			Version:                2,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{
+			// Delete the "a," of the first field, leaving "a: obj."
+			{
+				Range: &protocol.Range{
+					Start: protocol.Position{Line: 2, Character: 9},
+					End:   protocol.Position{Line: 2, Character: 11},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	doc, err := server.cache.Get(fileURI)
+	require.NoError(t, err)
+	// The syntax error is still reported, but the rest of the document has an up to date AST
+	assert.Error(t, doc.Err)
+	require.NotNil(t, doc.AST)
+	assert.Empty(t, doc.LinesChangedSinceAST)
+
+	links, err := server.definitionLink(&protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: fileURI},
+			Position:     protocol.Position{Line: 3, Character: 8},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, uint32(0), links[0].TargetRange.Start.Line)
+}
+
+func TestDidOpenRecordsImports(t *testing.T) {
+	server := testServer(t, nil)
+	fileURI := serverOpenTestFile(t, server, "./testdata/import-nested-main.jsonnet")
+	filename := fileURI.SpanURI().Filename()
+
+	imported, err := filepath.Abs("./testdata/import-nested3.libsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, []string{imported}, server.cache.GetImports(filename))
+	assert.Equal(t, []string{filename}, server.cache.GetImporters(imported))
+
+	// Resolving the top level objects records the imports of the imported files as well
+	processor := processing.NewProcessor(server.cache, server.getVM(filename))
+	processor.FindTopLevelObjectsInFile(imported, "")
+	nested := make([]string, 3)
+	for i, file := range []string{"import-nested1.libsonnet", "import-nested2.libsonnet", "import-nested3.libsonnet"} {
+		nested[i], err = filepath.Abs(filepath.Join("testdata", file))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{filename, nested[1], nested[2]}, server.cache.GetTransitiveImporters(nested[0]))
+}
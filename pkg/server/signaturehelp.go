@@ -29,11 +29,17 @@ func getFunctionCallNode(stack *nodestack.NodeStack) (*ast.Apply, error) {
 }
 
 func (s *Server) getFunctionCallTarget(root ast.Node, functionNode ast.Node, target protocol.DocumentURI) (*ast.Function, error) {
-	vm := s.getVM(target.SpanURI().Filename())
 	retFunc, err := stdlib.GetStdFunction(functionNode, &s.stdlibMap)
 	if err == nil {
 		return retFunc, nil
 	}
+	retFunc, _, err = s.findFunctionDefinition(root, functionNode, target)
+	return retFunc, err
+}
+
+// findFunctionDefinition returns the function called by functionNode and the location of its definition
+func (s *Server) findFunctionDefinition(root ast.Node, functionNode ast.Node, target protocol.DocumentURI) (*ast.Function, protocol.DefinitionLink, error) {
+	vm := s.getVM(target.SpanURI().Filename())
 	var locations []protocol.DefinitionLink
 	beginLocations, err := s.findDefinition(root, &protocol.DefinitionParams{
 		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
@@ -75,10 +81,10 @@ func (s *Server) getFunctionCallTarget(root ast.Node, functionNode ast.Node, tar
 		if !ok {
 			continue
 		}
-		return functionNode, nil
+		return functionNode, location, nil
 	}
 
-	return nil, fmt.Errorf("unable to find call target")
+	return nil, protocol.DefinitionLink{}, fmt.Errorf("unable to find call target")
 }
 
 func (s *Server) SignatureHelp(_ context.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
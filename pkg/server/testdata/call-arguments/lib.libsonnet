@@ -0,0 +1,3 @@
+{
+  new(name, replicas=1):: {},
+}
@@ -0,0 +1,4 @@
+{
+  new(x):: { x: x },
+  twice(x):: self.new(x) + self.new(x),
+}
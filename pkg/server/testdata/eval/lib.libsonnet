@@ -0,0 +1,4 @@
+{
+  value: 1,
+  broken: error 'broken',
+}
@@ -0,0 +1,2 @@
+local b = import 'b.libsonnet';
+b
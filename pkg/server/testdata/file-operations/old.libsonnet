@@ -0,0 +1 @@
+{ field: 1 }
@@ -0,0 +1,4 @@
+{
+  other: 1,
+  value: 2,
+}
@@ -0,0 +1,4 @@
+{
+  base:: { a: 1 },
+  mixin:: { a+: 1 },
+}
@@ -0,0 +1 @@
+'from a'
\ No newline at end of file
@@ -0,0 +1 @@
+'from b'
\ No newline at end of file
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/jsonnet-language-server/pkg/ast/processing"
+	"github.com/grafana/jsonnet-language-server/pkg/nodetree"
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/grafana/jsonnet-language-server/pkg/utils"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// The type hierarchy of objects. An object declared as `base + mixin + { ... }` has base and mixin as supertypes.
+// Items are the same as the ones of the call hierarchy: locals, fields and whole files
+
+func (s *Server) PrepareTypeHierarchy(_ context.Context, params *protocol.TypeHierarchyPrepareParams) ([]protocol.TypeHierarchyItem, error) {
+	doc, err := s.cache.Get(params.TextDocument.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareTypeHierarchy: %s: %w", errorRetrievingDocument, err)
+	}
+	if doc.AST == nil {
+		log.Errorf("PrepareTypeHierarchy: %s", errorParsingDocument)
+		return nil, nil
+	}
+
+	location := position.ProtocolToAST(params.Position)
+	if item, ok := declarationItem(doc.AST, doc.Item.URI, location); ok {
+		if !isObjectExpression(declarationBody(doc.AST, location)) {
+			return nil, nil
+		}
+		return []protocol.TypeHierarchyItem{protocol.TypeHierarchyItem(item)}, nil
+	}
+
+	stack, err := processing.FindNodeByPosition(doc.AST, location)
+	if err != nil {
+		return nil, utils.LogErrorf("PrepareTypeHierarchy: %w", err)
+	}
+	switch node := stack.Peek().(type) {
+	case *ast.Var, *ast.Index, *ast.SuperIndex, *ast.Import:
+		item, err := s.referencedItem(doc.AST, node, doc.Item.URI)
+		if err != nil {
+			log.Debugf("PrepareTypeHierarchy: %v", err)
+			return nil, nil
+		}
+		_, root, err := s.getAst(item.URI.SpanURI().Filename(), "")
+		if err != nil || !isObjectExpression(declarationBody(root, position.ProtocolToAST(item.SelectionRange.Start))) {
+			return nil, nil
+		}
+		return []protocol.TypeHierarchyItem{protocol.TypeHierarchyItem(item)}, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) Supertypes(_ context.Context, params *protocol.TypeHierarchySupertypesParams) ([]protocol.TypeHierarchyItem, error) {
+	_, root, err := s.getAst(params.Item.URI.SpanURI().Filename(), "")
+	if err != nil {
+		return nil, utils.LogErrorf("Supertypes: getting ast: %w", err)
+	}
+	body := declarationBody(root, position.ProtocolToAST(params.Item.SelectionRange.Start))
+
+	var supertypes []protocol.TypeHierarchyItem
+	for _, operand := range mixinOperands(body) {
+		item, err := s.referencedItem(root, operand, params.Item.URI)
+		if err != nil {
+			log.Debugf("Supertypes: %v", err)
+			continue
+		}
+		supertypes = append(supertypes, protocol.TypeHierarchyItem(item))
+	}
+	return supertypes, nil
+}
+
+func (s *Server) Subtypes(_ context.Context, params *protocol.TypeHierarchySubtypesParams) ([]protocol.TypeHierarchyItem, error) {
+	item := protocol.CallHierarchyItem(params.Item)
+	files, err := s.workspaceFiles(item.URI)
+	if err != nil {
+		return nil, utils.LogErrorf("Subtypes: %w", err)
+	}
+
+	var subtypes []protocol.TypeHierarchyItem
+	for _, filename := range files {
+		if item.Kind != protocol.File && !s.mayUseIdentifier(filename, item.Name) {
+			// Reading and parsing every file is slow. Skip the ones that can't extend the object
+			continue
+		}
+		_, root, err := s.getAst(filename, "")
+		if err != nil {
+			log.Debugf("Subtypes: getting ast for %s: %v", filename, err)
+			continue
+		}
+		uri := protocol.URIFromPath(filename)
+		for _, node := range nodetree.BuildTree(nil, root).GetAllChildren() {
+			if _, ok := node.(*ast.Binary); !ok && !isDeclarationBody(root, node) {
+				// Only aliases like `local a = b;` are references without `+`
+				continue
+			}
+			for _, operand := range mixinOperands(node) {
+				if operandName(operand) != item.Name {
+					continue
+				}
+				supertype, err := s.referencedItem(root, operand, uri)
+				if err != nil || !sameItem(supertype, item) {
+					continue
+				}
+				subtype := enclosingItem(root, uri, node)
+				if !slices.ContainsFunc(subtypes, func(other protocol.TypeHierarchyItem) bool {
+					return sameItem(protocol.CallHierarchyItem(other), subtype)
+				}) {
+					subtypes = append(subtypes, protocol.TypeHierarchyItem(subtype))
+				}
+			}
+		}
+	}
+	return subtypes, nil
+}
+
+// referencedItem returns the item of the local, field or file the node refers to
+func (s *Server) referencedItem(root ast.Node, node ast.Node, uri protocol.DocumentURI) (protocol.CallHierarchyItem, error) {
+	filename := uri.SpanURI().Filename()
+	switch node := node.(type) {
+	case *ast.Import:
+		importedFile, err := s.getVM(filename).ResolveImport(filename, node.File.Value)
+		if err != nil {
+			return protocol.CallHierarchyItem{}, fmt.Errorf("resolving import %s: %w", node.File.Value, err)
+		}
+		if importedFile, err = filepath.Abs(importedFile); err != nil {
+			return protocol.CallHierarchyItem{}, err
+		}
+		_, importedRoot, err := s.getAst(importedFile, "")
+		if err != nil {
+			return protocol.CallHierarchyItem{}, fmt.Errorf("getting ast for %s: %w", importedFile, err)
+		}
+		return fileItem(importedRoot, protocol.URIFromPath(importedFile)), nil
+	case *ast.Apply:
+		return s.calleeItem(root, node.Target, uri)
+	}
+
+	if !node.Loc().Begin.IsSet() {
+		return protocol.CallHierarchyItem{}, fmt.Errorf("no location for %T", node)
+	}
+	// The end is at the name of the last index, e.g. `new` of `lib.new`
+	links, err := s.findDefinition(root, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     position.ASTToProtocol(node.Loc().End),
+		},
+	}, s.getVM(filename))
+	if err != nil {
+		return protocol.CallHierarchyItem{}, fmt.Errorf("resolving %s: %w", node.Loc().String(), err)
+	}
+	if len(links) == 0 {
+		return protocol.CallHierarchyItem{}, fmt.Errorf("no definition of %s", node.Loc().String())
+	}
+	link := links[len(links)-1]
+	_, targetRoot, err := s.getAst(link.TargetURI.SpanURI().Filename(), "")
+	if err != nil {
+		return protocol.CallHierarchyItem{}, fmt.Errorf("getting ast for %s: %w", link.TargetURI, err)
+	}
+	if item, ok := declarationItem(targetRoot, link.TargetURI, position.ProtocolToAST(link.TargetSelectionRange.Start)); ok {
+		return item, nil
+	}
+	return protocol.CallHierarchyItem{}, fmt.Errorf("%s refers to neither a local nor a field", node.Loc().String())
+}
+
+// mixinOperands returns the objects combined with `+` in source order without the object literals.
+// Plain references like `local a = b;` have the reference as operand
+func mixinOperands(node ast.Node) []ast.Node {
+	var operands []ast.Node
+	switch node := node.(type) {
+	case *ast.Binary:
+		if node.Op != ast.BopPlus {
+			return nil
+		}
+		operands = processing.FlattenBinary(node)
+		slices.Reverse(operands)
+	case *ast.Var, *ast.Index, *ast.Import:
+		operands = []ast.Node{node}
+	}
+	return slices.DeleteFunc(operands, func(operand ast.Node) bool {
+		switch operand := operand.(type) {
+		case *ast.DesugaredObject:
+			return true
+		case *ast.Var:
+			// `self` and `$` of objects. `std` isn't an object of the workspace
+			return operand.Id == "$" || operand.Id == "std"
+		}
+		return false
+	})
+}
+
+// operandName returns the name of the referenced object. The called function for calls like `lib.new() + { ... }`
+func operandName(operand ast.Node) string {
+	if apply, ok := operand.(*ast.Apply); ok {
+		operand = apply.Target
+	}
+	name, _ := calleeName(operand)
+	return name
+}
+
+// isDeclarationBody checks if the node is the body of a local or field
+func isDeclarationBody(root ast.Node, node ast.Node) bool {
+	path := processing.NodePath(root, node)
+	if len(path) < 2 {
+		return false
+	}
+	switch parent := path[len(path)-2].(type) {
+	case *ast.Local:
+		return slices.ContainsFunc(parent.Binds, func(bind ast.LocalBind) bool { return bind.Body == node })
+	case *ast.DesugaredObject:
+		return slices.ContainsFunc(parent.Locals, func(bind ast.LocalBind) bool { return bind.Body == node }) ||
+			slices.ContainsFunc(parent.Fields, func(field ast.DesugaredObjectField) bool { return field.Body == node })
+	}
+	return false
+}
+
+// isObjectExpression checks if the node is an object, a combination of objects via `+` or a whole file
+func isObjectExpression(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.DesugaredObject, *ast.Import:
+		return true
+	case *ast.Binary:
+		return node.Op == ast.BopPlus && slices.ContainsFunc(processing.FlattenBinary(node), func(operand ast.Node) bool {
+			_, ok := operand.(*ast.DesugaredObject)
+			return ok || len(mixinOperands(operand)) > 0
+		})
+	case *ast.Local:
+		return isObjectExpression(node.Body)
+	}
+	return false
+}
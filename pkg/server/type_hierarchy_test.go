@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func prepareTypeHierarchy(t *testing.T, server *Server, uri protocol.DocumentURI, content, cursorAt string) []protocol.TypeHierarchyItem {
+	t.Helper()
+	items, err := server.PrepareTypeHierarchy(context.Background(), &protocol.TypeHierarchyPrepareParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     rangeOf(t, content, cursorAt).Start,
+		},
+	})
+	require.NoError(t, err)
+	return items
+}
+
+func typeHierarchyNames(items []protocol.TypeHierarchyItem) []string {
+	var names []string
+	for _, item := range items {
+		names = append(names, filepath.Base(item.URI.SpanURI().Filename())+":"+item.Name)
+	}
+	return names
+}
+
+func TestPrepareTypeHierarchy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inLib         bool
+		cursorAt      string
+		expectedNames []string
+	}{
+		{
+			name:          "local combining objects",
+			cursorAt:      "derived =",
+			expectedNames: []string{"main.jsonnet:derived"},
+		},
+		{
+			name:          "field with object",
+			inLib:         true,
+			cursorAt:      "base",
+			expectedNames: []string{"lib.libsonnet:base"},
+		},
+		{
+			name:          "reference to a field",
+			cursorAt:      "mixin +",
+			expectedNames: []string{"lib.libsonnet:mixin"},
+		},
+		{
+			name:          "import",
+			cursorAt:      "import",
+			expectedNames: []string{"lib.libsonnet:lib.libsonnet"},
+		},
+		{
+			name:     "field with number",
+			cursorAt: "count",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			fixture := newTestFixture(t, "type-hierarchy")
+			libURI, libContent := fixture.open(t, server, "lib.libsonnet")
+			mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+			uri, content := mainURI, mainContent
+			if tc.inLib {
+				uri, content = libURI, libContent
+			}
+			assert.Equal(t, tc.expectedNames, typeHierarchyNames(prepareTypeHierarchy(t, server, uri, content, tc.cursorAt)))
+		})
+	}
+}
+
+func TestSupertypes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cursorAt      string
+		expectedNames []string
+	}{
+		{
+			name:          "combination of fields",
+			cursorAt:      "derived =",
+			expectedNames: []string{"lib.libsonnet:base", "lib.libsonnet:mixin"},
+		},
+		{
+			name:          "implicit plus",
+			cursorAt:      "final",
+			expectedNames: []string{"main.jsonnet:derived"},
+		},
+		{
+			name:          "import",
+			cursorAt:      "lib =",
+			expectedNames: []string{"lib.libsonnet:lib.libsonnet"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			fixture := newTestFixture(t, "type-hierarchy")
+			fixture.open(t, server, "lib.libsonnet")
+			mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+			items := prepareTypeHierarchy(t, server, mainURI, mainContent, tc.cursorAt)
+			require.Len(t, items, 1)
+
+			supertypes, err := server.Supertypes(context.Background(), &protocol.TypeHierarchySupertypesParams{Item: items[0]})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, typeHierarchyNames(supertypes))
+		})
+	}
+}
+
+func TestSubtypes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inLib         bool
+		cursorAt      string
+		expectedNames []string
+	}{
+		{
+			name:          "field of another file",
+			inLib:         true,
+			cursorAt:      "mixin",
+			expectedNames: []string{"main.jsonnet:derived"},
+		},
+		{
+			name:          "local",
+			cursorAt:      "derived =",
+			expectedNames: []string{"main.jsonnet:final"},
+		},
+		{
+			name:          "file",
+			cursorAt:      "import",
+			expectedNames: []string{"main.jsonnet:lib"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testServer(t, nil)
+			fixture := newTestFixture(t, "type-hierarchy")
+			libURI, libContent := fixture.open(t, server, "lib.libsonnet")
+			mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+			uri, content := mainURI, mainContent
+			if tc.inLib {
+				uri, content = libURI, libContent
+			}
+			items := prepareTypeHierarchy(t, server, uri, content, tc.cursorAt)
+			require.Len(t, items, 1)
+
+			subtypes, err := server.Subtypes(context.Background(), &protocol.TypeHierarchySubtypesParams{Item: items[0]})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, typeHierarchyNames(subtypes))
+		})
+	}
+}
@@ -76,7 +76,7 @@ func testServerWithFile(t *testing.T, stdlib []stdlib.Function, fileContent stri
 
 	server = testServer(t, stdlib)
 
-	tmpFile, err := os.CreateTemp("", "")
+	tmpFile, err := os.CreateTemp(t.TempDir(), "*.jsonnet")
 	require.NoError(t, err)
 
 	_, err = tmpFile.WriteString(fileContent)
@@ -84,3 +84,37 @@ func testServerWithFile(t *testing.T, stdlib []stdlib.Function, fileContent stri
 
 	return server, serverOpenTestFile(t, server, tmpFile.Name())
 }
+
+// testFixture is a copy of a directory in testdata. Tests can change its files without touching the testdata
+type testFixture struct {
+	dir string
+}
+
+func newTestFixture(t *testing.T, name string) testFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, os.DirFS(filepath.Join("testdata", name))))
+	return testFixture{dir: dir}
+}
+
+// path returns the absolute path of a file of the fixture
+func (f testFixture) path(name string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(name))
+}
+
+// open opens a file of the fixture and returns its URI and content
+func (f testFixture) open(t *testing.T, server *Server, name string) (protocol.DocumentURI, string) {
+	t.Helper()
+
+	uri := serverOpenTestFile(t, server, f.path(name))
+	return uri, f.read(t, name)
+}
+
+func (f testFixture) read(t *testing.T, name string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(f.path(name))
+	require.NoError(t, err)
+	return string(content)
+}
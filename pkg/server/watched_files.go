@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/server/config"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchedFiles are the files which can change the evaluation of other files
+var watchedFiles = []protocol.FileSystemWatcher{
+	{GlobPattern: "**/*.{jsonnet,libsonnet,json}"},
+	{GlobPattern: "**/*" + config.ExtCodeSuffix},
+	{GlobPattern: "**/.jsonnet-language-server.{json,jsonnet}"},
+}
+
+// Initialized registers the file watchers. Changes made outside of the editor are not sent otherwise
+func (s *Server) Initialized(ctx context.Context, _ *protocol.InitializedParams) error {
+	if !s.clientCapabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		return nil
+	}
+	err := s.client.RegisterCapability(ctx, &protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:              "workspace/didChangeWatchedFiles",
+			Method:          "workspace/didChangeWatchedFiles",
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{Watchers: watchedFiles},
+		}},
+	})
+	if err != nil {
+		log.Errorf("Initialized: registering file watchers: %v", err)
+	}
+	return nil
+}
+
+// DidChangeWatchedFiles drops everything derived from the changed files and updates the diagnostics of the open documents depending on them
+func (s *Server) DidChangeWatchedFiles(_ context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	// Lenses evaluate the imports of the documents
+	s.forgetCodeLenses("")
+	changed := map[string]struct{}{}
+	reloadExtCode, reloadProjectConfigs := false, false
+	for _, change := range params.Changes {
+		filename := change.URI.SpanURI().Filename()
+		if strings.HasSuffix(filename, config.ExtCodeSuffix) {
+			reloadExtCode = true
+		}
+		if isProjectConfig(filename) {
+			reloadProjectConfigs = true
+			continue
+		}
+
+		s.cache.Invalidate(filename)
+		changed[filename] = struct{}{}
+		for _, importer := range s.cache.GetTransitiveImporters(filename) {
+			changed[importer] = struct{}{}
+		}
+
+		// The index of open documents is updated by DidChange
+		if _, err := s.cache.Get(change.URI); err == nil {
+			continue
+		}
+		if change.Type == protocol.Deleted {
+			s.cache.SetImports(filename, nil)
+			s.removeFromIndex(filename)
+		} else {
+			s.addToIndex(filename)
+		}
+	}
+
+	if reloadExtCode {
+		s.reloadExtCode()
+	}
+	if reloadProjectConfigs || reloadExtCode {
+		// Project configs contain the ext code and can change how imports are resolved
+		s.resetProjectConfigs()
+		s.cache.InvalidateAll()
+	}
+
+	for _, uri := range s.cache.URIs() {
+		// Ext code and project configs can be used by every document
+		if _, ok := changed[uri.SpanURI().Filename()]; ok || reloadExtCode || reloadProjectConfigs {
+			s.queueDiagnostics(uri)
+		}
+	}
+	return nil
+}
+
+// reloadExtCode reads the ext code files again. They are only loaded together with the settings of the client
+func (s *Server) reloadExtCode() {
+	if s.settings == nil {
+		return
+	}
+	settings, err := config.NewConfiguration(s.settings)
+	if err != nil {
+		log.Errorf("DidChangeWatchedFiles: reloading ext code: %v", err)
+		return
+	}
+	s.configuration.ExtCode = settings.ExtCode
+	s.refreshWorkspaceFolders()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDidChangeWatchedFilesInvalidatesImports(t *testing.T) {
+	fixture := newTestFixture(t, "watched-files")
+	libFile := fixture.path("lib.libsonnet")
+	server := testServer(t, nil)
+	mainURI, mainContent := fixture.open(t, server, "main.jsonnet")
+
+	definitionLine := func() uint32 {
+		links, err := server.Definition(context.Background(), &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: mainURI},
+				Position:     rangeOf(t, mainContent, "a\n").Start,
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		return links[0].Range.Start.Line
+	}
+	assert.Equal(t, uint32(0), definitionLine())
+
+	require.NoError(t, os.WriteFile(libFile, []byte("{\n  b: 1,\n  a: 2,\n}\n"), 0o600))
+	// Cached until the change is reported
+	assert.Equal(t, uint32(0), definitionLine())
+	require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: protocol.URIFromPath(libFile), Type: protocol.Changed}},
+	}))
+	assert.Equal(t, uint32(2), definitionLine())
+}
+
+func TestDidChangeWatchedFilesUpdatesIndex(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "new.libsonnet")
+	server := testServer(t, nil)
+	notify := func(changeType protocol.FileChangeType) {
+		require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+			Changes: []protocol.FileEvent{{URI: protocol.URIFromPath(filename), Type: changeType}},
+		}))
+	}
+
+	require.NoError(t, os.WriteFile(filename, []byte("{ field: 1 }\n"), 0o600))
+	notify(protocol.Created)
+	assert.True(t, server.index.Contains(filename))
+
+	require.NoError(t, os.Remove(filename))
+	notify(protocol.Deleted)
+	assert.False(t, server.index.Contains(filename))
+}
+
+func TestDidChangeWatchedFilesReloadsExtCode(t *testing.T) {
+	dir := t.TempDir()
+	extCodeFile := filepath.Join(dir, "env.extcode.jsonnet")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	server := testServer(t, nil)
+	require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{"formatting": map[string]any{}},
+	}))
+	assert.Empty(t, server.configuration.ExtCode)
+
+	require.NoError(t, os.WriteFile(extCodeFile, []byte("{ stage: 'dev' }"), 0o600))
+	require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: protocol.URIFromPath(extCodeFile), Type: protocol.Created}},
+	}))
+	assert.Equal(t, map[string]string{"env": "{ stage: 'dev' }"}, server.configuration.ExtCode)
+}
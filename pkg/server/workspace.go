@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/grafana/jsonnet-language-server/pkg/server/config"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// workspaceFolder is a folder opened in the client. Documents in it are evaluated with its jpaths and ext code
+type workspaceFolder struct {
+	protocol.WorkspaceFolder
+	path string
+	// The relative jpaths of the client settings and the folder itself. The workspace files are indexed in them
+	jpaths []string
+	// The ext code of the settings merged with the ext code files found from the folder
+	extCode map[string]string
+}
+
+// newWorkspaceFolder resolves the folder with the current configuration
+func (s *Server) newWorkspaceFolder(folder protocol.WorkspaceFolder) *workspaceFolder {
+	path := protocol.DocumentURI(folder.URI).SpanURI().Filename()
+	extCode := s.configuration.ExtCode
+	if s.settings != nil {
+		// Ext code files are only loaded together with the settings of the client
+		var err error
+		if extCode, err = config.ExtCodeIn(s.settings, path); err != nil {
+			log.Errorf("Loading ext code files of %s: %v", path, err)
+			extCode = s.configuration.ExtCode
+		}
+	}
+	return &workspaceFolder{
+		WorkspaceFolder: folder,
+		path:            path,
+		jpaths:          folderJPaths(path, s.configuration.RelativeJPaths()),
+		extCode:         extCode,
+	}
+}
+
+// folderJPaths returns the relative jpaths resolved in the folder followed by the folder itself
+func folderJPaths(path string, relativeJPaths []string) []string {
+	var jpaths []string
+	for _, relative := range relativeJPaths {
+		jpaths = append(jpaths, filepath.Join(path, relative))
+	}
+	// JPaths are searched from the end. Imports relative to the folder have precedence
+	return append(jpaths, path)
+}
+
+// setWorkspaceFolders replaces all workspace folders
+func (s *Server) setWorkspaceFolders(folders []protocol.WorkspaceFolder) {
+	s.foldersMutex.Lock()
+	defer s.foldersMutex.Unlock()
+
+	s.folders = nil
+	for _, folder := range folders {
+		s.folders = append(s.folders, s.newWorkspaceFolder(folder))
+	}
+}
+
+// refreshWorkspaceFolders resolves the workspace folders again after the configuration changed
+func (s *Server) refreshWorkspaceFolders() {
+	s.foldersMutex.Lock()
+	defer s.foldersMutex.Unlock()
+
+	for i, folder := range s.folders {
+		s.folders[i] = s.newWorkspaceFolder(folder.WorkspaceFolder)
+	}
+}
+
+// workspaceFolderOf returns the innermost workspace folder containing the file. Nil if the file is outside of all folders
+func (s *Server) workspaceFolderOf(filename string) *workspaceFolder {
+	s.foldersMutex.RLock()
+	defer s.foldersMutex.RUnlock()
+
+	var found *workspaceFolder
+	for _, folder := range s.folders {
+		if !strings.HasPrefix(filename, folder.path+string(filepath.Separator)) {
+			continue
+		}
+		if found == nil || len(folder.path) > len(found.path) {
+			found = folder
+		}
+	}
+	return found
+}
+
+// jpaths returns the jpaths used for the file: the configured ones followed by the ones of its workspace folder
+func (s *Server) jpaths(filename string) []string {
+	configuration := s.configurationFor(filename)
+	jpaths := slices.Clone(configuration.JPaths)
+	if folder := s.workspaceFolderOf(filename); folder != nil {
+		// Project config files can set other relative jpaths
+		jpaths = append(jpaths, folderJPaths(folder.path, configuration.RelativeJPaths())...)
+	}
+	return jpaths
+}
+
+// extVars returns the ext vars and ext code used for the file
+func (s *Server) extVars(filename string) (map[string]string, map[string]string) {
+	if project := s.projectConfiguration(filename); project != nil {
+		return project.ExtVars, project.ExtCode
+	}
+	if folder := s.workspaceFolderOf(filename); folder != nil {
+		return s.configuration.ExtVars, folder.extCode
+	}
+	return s.configuration.ExtVars, s.configuration.ExtCode
+}
+
+// indexFolders returns all folders whose files can be imported by the documents of the workspace
+func (s *Server) indexFolders() []string {
+	s.foldersMutex.RLock()
+	defer s.foldersMutex.RUnlock()
+
+	folders := slices.Clone(s.configuration.JPaths)
+	for _, folder := range s.folders {
+		for _, jpath := range folder.jpaths {
+			if !slices.Contains(folders, jpath) {
+				folders = append(folders, jpath)
+			}
+		}
+	}
+	return folders
+}
+
+func (s *Server) DidChangeWorkspaceFolders(_ context.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
+	s.foldersMutex.Lock()
+	var removedPaths []string
+	for _, removed := range params.Event.Removed {
+		s.folders = slices.DeleteFunc(s.folders, func(folder *workspaceFolder) bool {
+			if folder.URI != removed.URI {
+				return false
+			}
+			removedPaths = append(removedPaths, folder.path)
+			return true
+		})
+	}
+	for _, added := range params.Event.Added {
+		s.folders = append(s.folders, s.newWorkspaceFolder(added))
+	}
+	s.foldersMutex.Unlock()
+
+	// Files of removed folders that are still imported via other folders are indexed again
+	for _, path := range removedPaths {
+		for _, file := range s.index.Files() {
+			if _, err := s.cache.Get(protocol.URIFromPath(file)); err == nil {
+				continue
+			}
+			if strings.HasPrefix(file, path+string(filepath.Separator)) {
+				s.index.Remove(file)
+			}
+		}
+	}
+	go s.indexWorkspace(s.indexFolders())
+
+	// The imports of all documents might resolve differently now
+	s.cache.InvalidateAll()
+	s.forgetCodeLenses("")
+	for _, uri := range s.cache.URIs() {
+		s.queueDiagnostics(uri)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// buildWorkspaceEdit creates a workspace edit in the format supported by the client
+func (s *Server) buildWorkspaceEdit(edits map[protocol.DocumentURI][]protocol.TextEdit) protocol.WorkspaceEdit {
+	var response protocol.WorkspaceEdit
+	workspaceEditCapabilities := s.clientCapabilities.Workspace.WorkspaceEdit
+	if workspaceEditCapabilities != nil && workspaceEditCapabilities.DocumentChanges {
+		for fileURI, edit := range edits {
+			doc, err := s.cache.Get(fileURI)
+			version := int32(0)
+			if err == nil {
+				version = doc.Item.Version
+			}
+			response.DocumentChanges = append(response.DocumentChanges, protocol.DocumentChanges{
+				TextDocumentEdit: &protocol.TextDocumentEdit{
+					Edits: edit,
+					TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: protocol.TextDocumentIdentifier{
+							URI: fileURI,
+						},
+						Version: version,
+					},
+				},
+			})
+		}
+	} else {
+		response.Changes = edits
+	}
+	return response
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+
+	position "github.com/grafana/jsonnet-language-server/pkg/position_conversion"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+)
+
+// Clients filter the result further while typing. There is no need to send every match
+const maxWorkspaceSymbols = 256
+
+func (s *Server) Symbol(_ context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	symbols := s.index.Search(params.Query, maxWorkspaceSymbols)
+
+	result := make([]protocol.SymbolInformation, 0, len(symbols))
+	for _, symbol := range symbols {
+		result = append(result, protocol.SymbolInformation{
+			Name:          symbol.Name,
+			Kind:          symbol.Kind,
+			ContainerName: symbol.ContainerName(),
+			Location: protocol.Location{
+				URI:   protocol.URIFromPath(symbol.Filename),
+				Range: position.RangeASTToProtocol(symbol.SelectionRange),
+			},
+		})
+	}
+	return result, nil
+}
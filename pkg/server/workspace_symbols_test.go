@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceSymbol(t *testing.T) {
+	server := testServer(t, nil)
+	server.indexWorkspace([]string{"testdata"})
+	require.True(t, server.index.Ready())
+
+	symbols, err := server.Symbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: "objfunc"})
+	require.NoError(t, err)
+	require.NotEmpty(t, symbols)
+	assert.Equal(t, protocol.SymbolInformation{
+		Name: "objFunc",
+		Kind: protocol.Method,
+		Location: protocol.Location{
+			URI: absURI(t, "testdata/functions.libsonnet"),
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 6, Character: 2},
+				End:   protocol.Position{Line: 6, Character: 9},
+			},
+		},
+	}, symbols[0])
+
+	// Open documents are indexed with their current content
+	fileURI := serverOpenTestFile(t, server, "testdata/functions.libsonnet")
+	err = server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: fileURI},
+			Version:                2,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "{ renamedFunc(arg):: arg }"}},
+	})
+	require.NoError(t, err)
+
+	symbols, err = server.Symbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: "objFunc"})
+	require.NoError(t, err)
+	for _, symbol := range symbols {
+		assert.NotEqual(t, fileURI, symbol.Location.URI)
+	}
+	symbols, err = server.Symbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: "renamedFunc"})
+	require.NoError(t, err)
+	require.NotEmpty(t, symbols)
+	assert.Equal(t, "renamedFunc", symbols[0].Name)
+	assert.Equal(t, fileURI, symbols[0].Location.URI)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/jsonnet-language-server/pkg/server/config"
+	"github.com/jdbaldry/go-language-server-protocol/lsp/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func workspaceFolderOfDir(dir string) protocol.WorkspaceFolder {
+	return protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(dir)), Name: filepath.Base(dir)}
+}
+
+func TestWorkspaceFolderJPaths(t *testing.T) {
+	fixture := newTestFixture(t, "workspace-jpaths")
+	server := testServer(t, nil)
+	require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{"formatting": map[string]any{}, "paths": map[string]any{"relative_jpaths": []string{"lib"}}},
+	}))
+	require.NoError(t, server.DidChangeWorkspaceFolders(context.Background(), &protocol.DidChangeWorkspaceFoldersParams{
+		Event: protocol.WorkspaceFoldersChangeEvent{
+			Added: []protocol.WorkspaceFolder{workspaceFolderOfDir(fixture.path("a")), workspaceFolderOfDir(fixture.path("b"))},
+		},
+	}))
+
+	evaluate := func(name string) (string, error) {
+		filename := fixture.path(name)
+		return server.getVM(filename).EvaluateAnonymousSnippet(filename, fixture.read(t, name))
+	}
+	result, err := evaluate("a/main.jsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, "\"from a\"\n", result)
+	result, err = evaluate("b/main.jsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, "\"from b\"\n", result)
+	_, err = evaluate("outside/main.jsonnet")
+	assert.Error(t, err)
+
+	require.NoError(t, server.DidChangeWorkspaceFolders(context.Background(), &protocol.DidChangeWorkspaceFoldersParams{
+		Event: protocol.WorkspaceFoldersChangeEvent{
+			Removed: []protocol.WorkspaceFolder{workspaceFolderOfDir(fixture.path("b"))},
+		},
+	}))
+	_, err = evaluate("b/main.jsonnet")
+	assert.Error(t, err)
+	result, err = evaluate("a/main.jsonnet")
+	require.NoError(t, err)
+	assert.Equal(t, "\"from a\"\n", result)
+}
+
+func TestWorkspaceFolderProjectRelativeJPaths(t *testing.T) {
+	dir := newTestFixture(t, "workspace-relative-jpaths").dir
+	server := testServer(t, nil)
+	server.setWorkspaceFolders([]protocol.WorkspaceFolder{workspaceFolderOfDir(dir)})
+
+	// The relative jpaths of the project config are resolved in the workspace folder
+	assert.Equal(t, []string{filepath.Join(dir, "vendor"), dir}, server.jpaths(filepath.Join(dir, "app", "main.jsonnet")))
+	assert.Equal(t, []string{dir}, server.jpaths(filepath.Join(dir, "main.jsonnet")))
+}
+
+func TestWorkspaceFolderExtCode(t *testing.T) {
+	fixture := newTestFixture(t, "workspace-ext-code")
+	server := testServer(t, nil)
+	require.NoError(t, server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]any{"formatting": map[string]any{}, "paths": map[string]any{"ext_code": map[string]any{"find_upwards": true}}},
+	}))
+	server.setWorkspaceFolders([]protocol.WorkspaceFolder{workspaceFolderOfDir(fixture.path("a")), workspaceFolderOfDir(fixture.path("b"))})
+
+	evaluate := func(folder string) string {
+		filename := fixture.path(folder + "/main.jsonnet")
+		result, err := server.getVM(filename).EvaluateAnonymousSnippet(filename, "[std.extVar('name'), std.extVar('shared')]")
+		require.NoError(t, err)
+		return result
+	}
+	// The ext code files are searched from each folder
+	assert.Equal(t, "[\n   \"a\",\n   \"parent\"\n]\n", evaluate("a"))
+	assert.Equal(t, "[\n   \"b\",\n   \"parent\"\n]\n", evaluate("b"))
+
+	changed := fixture.path("b/name" + config.ExtCodeSuffix)
+	require.NoError(t, os.WriteFile(changed, []byte("'changed'"), 0o600))
+	require.NoError(t, server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: protocol.URIFromPath(changed), Type: protocol.Changed}},
+	}))
+	assert.Equal(t, "[\n   \"changed\",\n   \"parent\"\n]\n", evaluate("b"))
+}
+
+func TestWorkspaceFolderOf(t *testing.T) {
+	server := testServer(t, nil)
+	server.setWorkspaceFolders([]protocol.WorkspaceFolder{
+		workspaceFolderOfDir("/workspace"),
+		workspaceFolderOfDir("/workspace/nested"),
+		workspaceFolderOfDir("/other"),
+	})
+
+	testCases := []struct {
+		filename     string
+		expectedPath string
+	}{
+		{filename: "/workspace/main.jsonnet", expectedPath: "/workspace"},
+		{filename: "/workspace/nested/lib/main.jsonnet", expectedPath: "/workspace/nested"},
+		{filename: "/workspace-other/main.jsonnet"},
+		{filename: "/main.jsonnet"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			folder := server.workspaceFolderOf(tc.filename)
+			if tc.expectedPath == "" {
+				assert.Nil(t, folder)
+				return
+			}
+			require.NotNil(t, folder)
+			assert.Equal(t, tc.expectedPath, folder.path)
+		})
+	}
+}
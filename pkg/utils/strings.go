@@ -11,3 +11,25 @@ func FirstWord(s string) string {
 	}
 	return words[0]
 }
+
+// EditDistance returns the Levenshtein distance between a and b
+func EditDistance(a, b string) int {
+	aRunes, bRunes := []rune(a), []rune(b)
+	prev := make([]int, len(bRunes)+1)
+	curr := make([]int, len(bRunes)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(aRunes); i++ {
+		curr[0] = i
+		for j := 1; j <= len(bRunes); j++ {
+			cost := 1
+			if aRunes[i-1] == bRunes[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(bRunes)]
+}